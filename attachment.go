@@ -0,0 +1,39 @@
+package support
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AttachmentNameMaxLength is the maximum number of characters in the file name of an attachment
+const AttachmentNameMaxLength = 255
+
+type AttachmentRepository interface {
+	Attachment(ctx context.Context, id string) (*Attachment, error)
+	Attachments(ctx context.Context, operators ...*Operator) ([]*Attachment, error)
+	CreateAttachment(ctx context.Context, attachment *Attachment) (*Attachment, error)
+	// BindAttachments attaches the pending attachments identified by ids to the ticket.
+	// Attachments that already belong to a ticket are left untouched and reported as an error
+	BindAttachments(ctx context.Context, ticketID primitive.ObjectID, ids ...primitive.ObjectID) error
+}
+
+// Attachment is a file that has been uploaded to a ticket. The content of the file is kept in a
+// blob store under its SHA-256 digest, so identical files share a single blob
+type Attachment struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	// TicketID is nil while the attachment is pending, uploaded ahead of the ticket that it is submitted with
+	TicketID    *primitive.ObjectID `json:"ticketID,omitempty" bson:"ticketID,omitempty"`
+	UploadedBy  primitive.ObjectID  `json:"uploadedBy" bson:"uploadedBy"`
+	Name        string              `json:"name" bson:"name"`
+	ContentType string              `json:"contentType" bson:"contentType"`
+	Size        int64               `json:"size" bson:"size"`
+	SHA256      string              `json:"sha256" bson:"sha256"`
+	CreatedAt   time.Time           `json:"createdAt" bson:"createdAt"`
+
+	// URL is a signed link to the content of the attachment that is valid until URLExpiresAt.
+	// It is generated every time the attachment is retrieved and never stored
+	URL          string     `json:"url,omitempty" bson:"-"`
+	URLExpiresAt *time.Time `json:"urlExpiresAt,omitempty" bson:"-"`
+}
@@ -0,0 +1,85 @@
+package support
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditRepository stores the audit trail. Events are append only, so they can neither be updated nor deleted
+type AuditRepository interface {
+	AuditEvents(ctx context.Context, operators ...*Operator) ([]*AuditEvent, error)
+	CreateAuditEvent(ctx context.Context, event *AuditEvent) (*AuditEvent, error)
+}
+
+// AuditEntity is the type of entity that an audit event describes a change to
+type AuditEntity string
+
+const (
+	AuditEntityAttachment       AuditEntity = "attachment"
+	AuditEntityCategory         AuditEntity = "category"
+	AuditEntityComment          AuditEntity = "comment"
+	AuditEntityFieldDefinition  AuditEntity = "fieldDefinition"
+	AuditEntityQueue            AuditEntity = "queue"
+	AuditEntitySLAPolicy        AuditEntity = "slaPolicy"
+	AuditEntityTicket           AuditEntity = "ticket"
+	AuditEntityTicketDefinition AuditEntity = "ticketDefinition"
+	AuditEntityTicketStatus     AuditEntity = "ticketStatus"
+	AuditEntityUser             AuditEntity = "user"
+)
+
+func (e AuditEntity) String() string {
+	return string(e)
+}
+
+// AuditAction is the kind of change that an audit event describes
+type AuditAction string
+
+const (
+	AuditActionCreate         AuditAction = "create"
+	AuditActionUpdate         AuditAction = "update"
+	AuditActionDelete         AuditAction = "delete"
+	AuditActionMove           AuditAction = "move"
+	AuditActionReassign       AuditAction = "reassign"
+	AuditActionAssign         AuditAction = "assign"
+	AuditActionUnassign       AuditAction = "unassign"
+	AuditActionBreach         AuditAction = "breach"
+	AuditActionDisable        AuditAction = "disable"
+	AuditActionEnable         AuditAction = "enable"
+	AuditActionChangePassword AuditAction = "changePassword"
+	AuditActionResetPassword  AuditAction = "resetPassword"
+	AuditActionVerifyEmail    AuditAction = "verifyEmail"
+)
+
+func (a AuditAction) String() string {
+	return string(a)
+}
+
+// AuditEvent records a single change that was made to an entity, who made it and as part of which request
+type AuditEvent struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+
+	// ActorID is the user that made the change. It is nil for changes
+	// made by unauthenticated requests such as registration or a password reset
+	ActorID *primitive.ObjectID `json:"actorID,omitempty" bson:"actorID,omitempty"`
+
+	Entity   AuditEntity        `json:"entityType" bson:"entityType"`
+	EntityID primitive.ObjectID `json:"entityID" bson:"entityID"`
+
+	// ParentID is the entity that the changed entity belongs to, such as the ticket of a comment
+	ParentID *primitive.ObjectID `json:"parentID,omitempty" bson:"parentID,omitempty"`
+
+	Action    AuditAction    `json:"action" bson:"action"`
+	Changes   []*AuditChange `json:"changes,omitempty" bson:"changes,omitempty"`
+	RequestID string         `json:"requestID,omitempty" bson:"requestID,omitempty"`
+	CreatedAt time.Time      `json:"createdAt" bson:"createdAt"`
+}
+
+// AuditChange is the value of a single attribute of an entity before and after a change.
+// Before is nil for entities that were created and After is nil for entities that were deleted
+type AuditChange struct {
+	Field  string      `json:"field" bson:"field"`
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
@@ -13,16 +13,35 @@ type CategoryRepository interface {
 	Categories(ctx context.Context, operators ...*Operator) ([]*Category, error)
 	CreateCategory(ctx context.Context, category *Category) (*Category, error)
 	UpdateCategory(ctx context.Context, id string, category *Category) (*Category, error)
+	DeleteCategory(ctx context.Context, id string) error
 }
 
 type Category struct {
-	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
-	ParentID  *primitive.ObjectID `json:"parentID" bson:"parentID"`
-	Name      string              `json:"name" bson:"name"`
-	CreatedBy primitive.ObjectID  `json:"createdBy" bson:"createdBy"`
-	CreatedAt time.Time           `json:"createdAt" bson:"createdAt"`
-	UpdatedBy primitive.ObjectID  `json:"updatedBy" bson:"updatedBy"`
-	UpdatedAt time.Time           `json:"updatedAt" bson:"updatedAt"`
+	ID       primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ParentID *primitive.ObjectID `json:"parentID" bson:"parentID"`
+	Name     string              `json:"name" bson:"name"`
+
+	// Definitions are the ticket definitions that may be used to submit tickets in this category.
+	// Definitions are inherited, so they may also be used in every category nested beneath this one
+	Definitions []primitive.ObjectID `json:"definitions" bson:"definitions"`
+
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedBy primitive.ObjectID `json:"updatedBy" bson:"updatedBy"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// CategoryNode is a category along with the categories nested beneath it
+type CategoryNode struct {
+	*Category
+	Children []*CategoryNode `json:"children"`
+}
+
+// CategoryDefinition is a ticket definition that may be used in a category
+// along with the category whose association permits it
+type CategoryDefinition struct {
+	*ExpandedTicketDefinition
+	GrantedBy primitive.ObjectID `json:"grantedBy"`
 }
 
 func (o *Category) VerifyAttributes() error {
@@ -12,6 +12,8 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/embersyndicate/support/internal/attachment"
+	"github.com/embersyndicate/support/internal/mailer"
 	"github.com/embersyndicate/support/internal/mongo"
 	"github.com/go-redis/redis/v8"
 	"github.com/newrelic/go-agent/v3/newrelic"
@@ -202,3 +204,28 @@ func makeRedis(cfg config) *redis.Client {
 
 	return redisClient
 }
+
+func newMailer(cfg config) mailer.Mailer {
+
+	if cfg.Mail.Driver == smtpMailDriver {
+		return mailer.NewSMTP(cfg.Mail.SMTP.Host, cfg.Mail.SMTP.Port, cfg.Mail.SMTP.User, cfg.Mail.SMTP.Pass, cfg.Mail.From)
+	}
+
+	return mailer.NewFile(cfg.Mail.Folder, cfg.Mail.From)
+}
+
+func newBlobStore(cfg config) (attachment.BlobStore, error) {
+
+	if cfg.Attachments.Driver == s3BlobDriver {
+		return attachment.NewS3Store(attachment.S3Config{
+			Endpoint:  cfg.Attachments.S3.Endpoint,
+			Region:    cfg.Attachments.S3.Region,
+			Bucket:    cfg.Attachments.S3.Bucket,
+			AccessKey: cfg.Attachments.S3.AccessKey,
+			SecretKey: cfg.Attachments.S3.SecretKey,
+			PathStyle: cfg.Attachments.S3.PathStyle,
+		})
+	}
+
+	return attachment.NewFileStore(cfg.Attachments.Folder), nil
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/embersyndicate/support/internal/key"
+	"github.com/embersyndicate/support/internal/password"
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/lestrrat-go/jwx/jwa"
 )
 
 type config struct {
@@ -32,10 +36,71 @@ type config struct {
 	}
 
 	Server struct {
-		Port uint `envconfig:"SERVER_PORT" required:"true"`
+		Port uint   `envconfig:"SERVER_PORT" required:"true"`
+		URL  string `envconfig:"SERVER_URL"`
+	}
+
+	Keys struct {
+		Algorithm jwa.SignatureAlgorithm `envconfig:"KEY_ALGORITHM" default:"RS256"`
+	}
+
+	Password struct {
+		MinLength    int                  `envconfig:"PASSWORD_MIN_LENGTH" default:"12"`
+		MinScore     int                  `envconfig:"PASSWORD_MIN_SCORE" default:"3"`
+		BreachedList string               `envconfig:"PASSWORD_BREACHED_LIST"`
+		RemoteCheck  password.RemoteCheck `envconfig:"PASSWORD_REMOTE_CHECK" default:"fail-open"`
+	}
+
+	Portal struct {
+		URL string `envconfig:"PORTAL_URL" required:"true"`
+	}
+
+	Mail struct {
+		Driver mailDriver `envconfig:"MAIL_DRIVER" default:"file"`
+		From   string     `envconfig:"MAIL_FROM" required:"true"`
+		Folder string     `envconfig:"MAIL_FOLDER" default:"_data/mail"`
+
+		SMTP struct {
+			Host string `envconfig:"MAIL_SMTP_HOST"`
+			Port uint   `envconfig:"MAIL_SMTP_PORT" default:"587"`
+			User string `envconfig:"MAIL_SMTP_USER"`
+			Pass string `envconfig:"MAIL_SMTP_PASS"`
+		}
+	}
+
+	SLA struct {
+		Interval time.Duration `envconfig:"SLA_WORKER_INTERVAL" default:"1m"`
+	}
+
+	Attachments struct {
+		Driver    blobDriver    `envconfig:"ATTACHMENT_DRIVER" default:"file"`
+		Folder    string        `envconfig:"ATTACHMENT_FOLDER" default:"_data/attachments"`
+		MaxSize   int64         `envconfig:"ATTACHMENT_MAX_SIZE" default:"10485760"`
+		Types     []string      `envconfig:"ATTACHMENT_TYPES" default:"image/png,image/jpeg,image/gif,image/webp,text/plain,application/pdf,application/zip,application/x-gzip"`
+		URLSecret string        `envconfig:"ATTACHMENT_URL_SECRET" required:"true"`
+		URLTTL    time.Duration `envconfig:"ATTACHMENT_URL_TTL" default:"15m"`
+
+		S3 struct {
+			Endpoint  string `envconfig:"ATTACHMENT_S3_ENDPOINT"`
+			Region    string `envconfig:"ATTACHMENT_S3_REGION" default:"us-east-1"`
+			Bucket    string `envconfig:"ATTACHMENT_S3_BUCKET"`
+			AccessKey string `envconfig:"ATTACHMENT_S3_ACCESS_KEY"`
+			SecretKey string `envconfig:"ATTACHMENT_S3_SECRET_KEY"`
+			PathStyle bool   `envconfig:"ATTACHMENT_S3_PATH_STYLE"`
+		}
 	}
 }
 
+type mailDriver string
+
+const smtpMailDriver mailDriver = "smtp"
+const fileMailDriver mailDriver = "file"
+
+type blobDriver string
+
+const s3BlobDriver blobDriver = "s3"
+const fileBlobDriver blobDriver = "file"
+
 type environment string
 
 const production environment = "production"
@@ -57,6 +122,16 @@ func (c config) validateEnvironment() bool {
 	return false
 }
 
+func (c config) validateKeyAlgorithm() bool {
+	for _, alg := range key.SupportedAlgorithms {
+		if c.Keys.Algorithm == alg {
+			return true
+		}
+	}
+
+	return false
+}
+
 func loadConfig() (cfg config, err error) {
 	err = godotenv.Load("app.env")
 	if err != nil {
@@ -72,6 +147,30 @@ func loadConfig() (cfg config, err error) {
 		return config{}, fmt.Errorf("invalid env %s declared", cfg.Env)
 	}
 
+	if cfg.Mail.Driver != smtpMailDriver && cfg.Mail.Driver != fileMailDriver {
+		return config{}, fmt.Errorf("invalid mail driver %s declared, expected one of %s or %s", cfg.Mail.Driver, smtpMailDriver, fileMailDriver)
+	}
+
+	if cfg.Mail.Driver == smtpMailDriver && cfg.Mail.SMTP.Host == "" {
+		return config{}, fmt.Errorf("MAIL_SMTP_HOST is required when the smtp mail driver is declared")
+	}
+
+	if cfg.Attachments.Driver != s3BlobDriver && cfg.Attachments.Driver != fileBlobDriver {
+		return config{}, fmt.Errorf("invalid attachment driver %s declared, expected one of %s or %s", cfg.Attachments.Driver, s3BlobDriver, fileBlobDriver)
+	}
+
+	if cfg.Attachments.Driver == s3BlobDriver && cfg.Attachments.S3.Bucket == "" {
+		return config{}, fmt.Errorf("ATTACHMENT_S3_BUCKET is required when the s3 attachment driver is declared")
+	}
+
+	if cfg.SLA.Interval <= 0 {
+		return config{}, fmt.Errorf("SLA_WORKER_INTERVAL must be a positive duration")
+	}
+
+	if !cfg.validateKeyAlgorithm() {
+		return config{}, fmt.Errorf("invalid key algorithm %s declared, expected one of %v", cfg.Keys.Algorithm, key.SupportedAlgorithms)
+	}
+
 	return
 
 }
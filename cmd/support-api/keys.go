@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+
+	"github.com/embersyndicate/support/internal/key"
+	"github.com/embersyndicate/support/internal/token"
+	"github.com/urfave/cli/v2"
+)
+
+func keysCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "keys",
+		Usage: "Manages the key ring that is used to sign tokens",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "rotate",
+				Usage: "Generates a new active signing key and retires the current key. Retired keys continue to be published until the tokens they signed have expired",
+				Action: func(c *cli.Context) error {
+
+					cfg, err := loadConfig()
+					if err != nil {
+						log.Fatalf("failed to load configuration: %s", err)
+					}
+
+					logger, err := loadLogger(cfg, "keys")
+					if err != nil {
+						log.Fatalf("failed to load logger: %s", err)
+					}
+
+					keyServ := key.New(logger, cfg.Keys.Algorithm, token.AccessTokenTTL)
+
+					// Loading the keys may already have generated a new active key, rotating
+					// again would needlessly retire that key before it has signed anything
+					if !keyServ.Generated() {
+						err = keyServ.Rotate()
+						if err != nil {
+							logger.WithError(err).Fatal("failed to rotate keys")
+						}
+					}
+
+					logger.WithField("kid", keyServ.GetPublicJWK().KeyID()).Info("keys rotated successfully")
+
+					return nil
+
+				},
+			},
+		},
+	}
+}
@@ -33,6 +33,9 @@ func main() {
 	app.UsageText = "ember-support"
 	app.Commands = []*cli.Command{
 		serverCommand(),
+		workerCommand(),
+		keysCommand(),
+		migrateCommand(),
 		testCommand(),
 	}
 
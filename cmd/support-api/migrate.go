@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/embersyndicate/support/internal/audit"
+	"github.com/embersyndicate/support/internal/category"
+	"github.com/embersyndicate/support/internal/mongo"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+func migrateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "migrate",
+		Usage: "Migrates existing data to the shape expected by this release",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "duplicate-users",
+				Usage: "Reports the users whose username or email only differ by case. They have to be renamed or deleted before upgrading to a release that enforces case-insensitive unique usernames and emails, which otherwise fails to start",
+				Action: func(c *cli.Context) error {
+
+					basics := basics("migrate")
+
+					duplicates, err := mongo.DuplicateUsers(context.Background(), basics.db)
+					if err != nil {
+						basics.logger.WithError(err).Fatal("failed to find duplicate users")
+					}
+
+					for _, duplicate := range duplicates {
+						ids := make([]string, 0, len(duplicate.UserIDs))
+						for _, id := range duplicate.UserIDs {
+							ids = append(ids, id.Hex())
+						}
+
+						basics.logger.WithFields(logrus.Fields{
+							"column":  duplicate.Column,
+							"value":   duplicate.Value,
+							"userIDs": strings.Join(ids, ","),
+						}).Warn("users share a value that has to be unique")
+					}
+
+					if len(duplicates) > 0 {
+						basics.logger.WithField("duplicates", len(duplicates)).Fatal("duplicate users have to be resolved before upgrading")
+					}
+
+					basics.logger.Info("no duplicate users found")
+
+					return nil
+
+				},
+			},
+			{
+				Name:  "category-definitions",
+				Usage: "Associates every category with the ticket definitions its existing tickets were submitted with, so that those definitions remain permitted in the category. Run once before upgrading to a release that binds ticket definitions to categories",
+				Action: func(c *cli.Context) error {
+
+					basics := basics("migrate")
+
+					repos := initializeRepositories(basics)
+
+					auditServ := audit.New(repos.audit, repos.ticket)
+					categoryServ := category.New(repos.category, repos.ticket, auditServ)
+
+					updated, err := categoryServ.BackfillDefinitions(context.Background())
+					if err != nil {
+						basics.logger.WithError(err).WithField("updated", updated).Fatal("failed to backfill category definitions")
+					}
+
+					basics.logger.WithField("updated", updated).Info("category definitions backfilled successfully")
+
+					return nil
+
+				},
+			},
+		},
+	}
+}
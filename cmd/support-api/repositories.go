@@ -6,15 +6,34 @@ import (
 )
 
 type repositories struct {
-	category support.CategoryRepository
-	ticket   support.TicketRepository
-	user     support.UserRepository
+	attachment support.AttachmentRepository
+	audit      support.AuditRepository
+	category   support.CategoryRepository
+	comment    support.CommentRepository
+	queue      support.QueueRepository
+	sla        support.SLARepository
+	ticket     support.TicketRepository
+	user       support.UserRepository
 }
 
 func initializeRepositories(basics *app) repositories {
 
 	repos := repositories{}
 
+	repos.attachment, err = mongo.NewAttachmentRepository(basics.db)
+	if err != nil {
+		basics.logger.WithError(err).Fatal("failed to initialize attachment repository")
+	}
+
+	basics.logger.Info("attachment repository initialized")
+
+	repos.audit, err = mongo.NewAuditRepository(basics.db)
+	if err != nil {
+		basics.logger.WithError(err).Fatal("failed to initialize audit repository")
+	}
+
+	basics.logger.Info("audit repository initialized")
+
 	repos.category, err = mongo.NewCategoryRepository(basics.db)
 	if err != nil {
 		basics.logger.WithError(err).Fatal("failed to initialize category repository")
@@ -22,6 +41,27 @@ func initializeRepositories(basics *app) repositories {
 
 	basics.logger.Info("category repository initialized")
 
+	repos.comment, err = mongo.NewCommentRepository(basics.db)
+	if err != nil {
+		basics.logger.WithError(err).Fatal("failed to initialize comment repository")
+	}
+
+	basics.logger.Info("comment repository initialized")
+
+	repos.queue, err = mongo.NewQueueRepository(basics.db)
+	if err != nil {
+		basics.logger.WithError(err).Fatal("failed to initialize queue repository")
+	}
+
+	basics.logger.Info("queue repository initialized")
+
+	repos.sla, err = mongo.NewSLARepository(basics.db)
+	if err != nil {
+		basics.logger.WithError(err).Fatal("failed to initialize sla repository")
+	}
+
+	basics.logger.Info("sla repository initialized")
+
 	repos.ticket, err = mongo.NewTicketRepository(basics.db)
 	if err != nil {
 		basics.logger.WithError(err).Fatal("failed to initialize ticket repository")
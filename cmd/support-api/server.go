@@ -8,9 +8,15 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/embersyndicate/support/internal/attachment"
+	"github.com/embersyndicate/support/internal/audit"
 	"github.com/embersyndicate/support/internal/category"
+	"github.com/embersyndicate/support/internal/comment"
 	"github.com/embersyndicate/support/internal/key"
+	"github.com/embersyndicate/support/internal/password"
+	"github.com/embersyndicate/support/internal/queue"
 	"github.com/embersyndicate/support/internal/server"
+	"github.com/embersyndicate/support/internal/sla"
 	"github.com/embersyndicate/support/internal/ticket"
 	"github.com/embersyndicate/support/internal/token"
 	"github.com/embersyndicate/support/internal/user"
@@ -33,19 +39,57 @@ func serverCommand() *cli.Command {
 			}
 			client.Transport = newrelic.NewRoundTripper(client.Transport)
 
-			categoryServ := category.New(repos.category)
-			keyServ := key.New(basics.logger)
-			ticketServ := ticket.New(repos.ticket)
-			tokenServ := token.New(keyServ)
-			userServ := user.New(client, keyServ, tokenServ, repos.user)
+			auditServ := audit.New(repos.audit, repos.ticket)
+			categoryServ := category.New(repos.category, repos.ticket, auditServ)
+			slaServ := sla.New(repos.sla, repos.ticket, categoryServ, auditServ, basics.redis)
+			commentServ := comment.New(repos.comment, repos.ticket, slaServ, auditServ)
+			keyServ := key.New(basics.logger, basics.cfg.Keys.Algorithm, token.AccessTokenTTL)
+			queueServ := queue.New(repos.queue, repos.ticket, repos.user, categoryServ, auditServ)
+			ticketServ := ticket.New(repos.ticket, repos.attachment, categoryServ, queueServ, slaServ, auditServ)
+			tokenServ := token.New(keyServ, basics.redis)
+			policy, err := password.New(password.Config{
+				MinLength:    basics.cfg.Password.MinLength,
+				MinScore:     basics.cfg.Password.MinScore,
+				BreachedList: basics.cfg.Password.BreachedList,
+				RemoteCheck:  basics.cfg.Password.RemoteCheck,
+			}, client)
+			if err != nil {
+				basics.logger.WithError(err).Fatal("failed to initialize password policy")
+			}
+
+			blobs, err := newBlobStore(basics.cfg)
+			if err != nil {
+				basics.logger.WithError(err).Fatal("failed to initialize attachment blob store")
+			}
+
+			attachmentServ, err := attachment.New(attachment.Config{
+				MaxSize: basics.cfg.Attachments.MaxSize,
+				Types:   basics.cfg.Attachments.Types,
+				Secret:  []byte(basics.cfg.Attachments.URLSecret),
+				URLTTL:  basics.cfg.Attachments.URLTTL,
+				BaseURL: basics.cfg.Server.URL,
+			}, blobs, repos.attachment, repos.ticket, auditServ)
+			if err != nil {
+				basics.logger.WithError(err).Fatal("failed to initialize attachment service")
+			}
+
+			userServ, err := user.New(policy, keyServ, tokenServ, auditServ, newMailer(basics.cfg), basics.cfg.Portal.URL, basics.redis, repos.user)
+			if err != nil {
+				basics.logger.WithError(err).Fatal("failed to initialize user service")
+			}
 
 			s := server.New(
 				basics.cfg.Server.Port,
 				basics.logger,
 				basics.redis,
 				basics.newrelic,
+				attachmentServ,
+				auditServ,
 				categoryServ,
+				commentServ,
 				keyServ,
+				queueServ,
+				slaServ,
 				ticketServ,
 				tokenServ,
 				userServ,
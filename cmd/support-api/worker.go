@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/embersyndicate/support/internal/audit"
+	"github.com/embersyndicate/support/internal/category"
+	"github.com/embersyndicate/support/internal/sla"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/urfave/cli/v2"
+)
+
+func workerCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "worker",
+		Usage: "Initializes the background worker that marks tickets that have missed their SLA targets as breached",
+		Action: func(c *cli.Context) error {
+
+			basics := basics("worker")
+
+			repos := initializeRepositories(basics)
+
+			auditServ := audit.New(repos.audit, repos.ticket)
+			categoryServ := category.New(repos.category, repos.ticket, auditServ)
+			slaServ := sla.New(repos.sla, repos.ticket, categoryServ, auditServ, basics.redis)
+
+			interval := basics.cfg.SLA.Interval
+
+			detect := func() {
+				txn := basics.newrelic.StartTransaction("sla breach detection")
+				defer txn.End()
+
+				// A pass never runs into the next one, so a slow pass is picked up again by the next tick
+				ctx, cancel := context.WithTimeout(newrelic.NewContext(context.Background(), txn), interval)
+				defer cancel()
+
+				breaches, err := slaServ.DetectBreaches(ctx, time.Now())
+				if err != nil {
+					txn.NoticeError(err)
+					basics.logger.WithError(err).WithField("breaches", breaches).Error("failed to detect sla breaches")
+					return
+				}
+
+				if breaches > 0 {
+					basics.logger.WithField("breaches", breaches).Info("sla breaches detected")
+				}
+			}
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			osSignals := make(chan os.Signal, 1)
+			signal.Notify(osSignals, os.Interrupt, syscall.SIGTERM)
+
+			basics.logger.WithField("interval", interval).Info("worker started")
+
+			detect()
+
+			for {
+				select {
+				case <-ticker.C:
+					detect()
+
+				case sig := <-osSignals:
+					basics.logger.WithField("sig", sig).Info("interrupt signal received, worker stopped")
+
+					basics.logger.Info("shutting down newrelic application")
+					basics.newrelic.Shutdown(time.Second * 5)
+					basics.logger.Info("newrelic application shutdown successfully")
+
+					return nil
+				}
+			}
+
+		},
+	}
+}
@@ -0,0 +1,46 @@
+package support
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CommentMaxLength is the maximum number of characters in the body of a comment
+const CommentMaxLength = 10000
+
+type CommentRepository interface {
+	Comment(ctx context.Context, id string) (*Comment, error)
+	Comments(ctx context.Context, operators ...*Operator) ([]*Comment, error)
+	CreateComment(ctx context.Context, comment *Comment) (*Comment, error)
+	UpdateComment(ctx context.Context, id string, comment *Comment) (*Comment, error)
+	DeleteComment(ctx context.Context, id string) error
+}
+
+// Comment is a message in the conversation that takes place on a ticket between the user that
+// submitted it and our agents. Internal comments are notes that are only visible to agents
+type Comment struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TicketID  primitive.ObjectID `json:"ticketID" bson:"ticketID"`
+	AuthorID  primitive.ObjectID `json:"authorID" bson:"authorID"`
+	Body      string             `json:"body" bson:"body"`
+	Internal  bool               `json:"internal" bson:"internal"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	EditedAt  *time.Time         `json:"editedAt,omitempty" bson:"editedAt,omitempty"`
+}
+
+func (o *Comment) ValidateAttributes() error {
+
+	if o.Body == "" {
+		return fmt.Errorf("body is required, received empty value")
+	}
+
+	if len([]rune(o.Body)) > CommentMaxLength {
+		return fmt.Errorf("body cannot be longer than %d characters", CommentMaxLength)
+	}
+
+	return nil
+
+}
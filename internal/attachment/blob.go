@@ -0,0 +1,18 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrBlobNotFound is returned by a BlobStore when no blob is stored under the requested key
+var ErrBlobNotFound = errors.New("blob does not exist")
+
+// BlobStore keeps the content of attachments. Blobs are immutable, so a key that
+// has been written to always refers to the same content
+type BlobStore interface {
+	Exists(ctx context.Context, key string) (bool, error)
+	Put(ctx context.Context, key string, content io.ReadSeeker, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
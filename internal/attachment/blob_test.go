@@ -0,0 +1,207 @@
+package attachment
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+
+	testBlobStore(t, NewFileStore(t.TempDir()))
+
+	t.Run("rejects keys that escape the folder", func(t *testing.T) {
+
+		store := NewFileStore(t.TempDir())
+		for _, key := range []string{"", "ab", "../etc", "ab/cd", `ab\cd`, "ab.cd"} {
+			_, err := store.Exists(context.Background(), key)
+			if err == nil {
+				t.Errorf("expected key %q to be rejected", key)
+			}
+
+			err = store.Put(context.Background(), key, strings.NewReader("content"), 7, "text/plain")
+			if err == nil {
+				t.Errorf("expected key %q to be rejected", key)
+			}
+		}
+
+	})
+
+}
+
+func TestS3Store(t *testing.T) {
+
+	server := httptest.NewServer(newS3StandIn("attachments"))
+	defer server.Close()
+
+	store, err := NewS3Store(S3Config{
+		Endpoint:  server.URL,
+		Region:    "us-east-1",
+		Bucket:    "attachments",
+		AccessKey: "access",
+		SecretKey: "secret",
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create s3 store: %s", err)
+	}
+
+	testBlobStore(t, store)
+
+}
+
+// testBlobStore checks the behaviour that the attachment service relies on from every BlobStore
+func testBlobStore(t *testing.T, store BlobStore) {
+
+	ctx := context.Background()
+	key := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	content := []byte("printer is on fire")
+
+	t.Run("missing blob", func(t *testing.T) {
+
+		exists, err := store.Exists(ctx, key)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if exists {
+			t.Fatalf("expected blob %s not to exist", key)
+		}
+
+		_, err = store.Get(ctx, key)
+		if !errors.Is(err, ErrBlobNotFound) {
+			t.Fatalf("expected ErrBlobNotFound, got %v", err)
+		}
+
+	})
+
+	t.Run("put and get", func(t *testing.T) {
+
+		err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "text/plain")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		exists, err := store.Exists(ctx, key)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if !exists {
+			t.Fatalf("expected blob %s to exist", key)
+		}
+
+		assertBlob(t, store, key, content)
+
+	})
+
+	t.Run("put is repeatable", func(t *testing.T) {
+
+		err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "text/plain")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		assertBlob(t, store, key, content)
+
+	})
+
+	t.Run("blobs are kept apart", func(t *testing.T) {
+
+		other := "60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752"
+		otherContent := []byte("vpn is down")
+
+		err := store.Put(ctx, other, bytes.NewReader(otherContent), int64(len(otherContent)), "text/plain")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		assertBlob(t, store, key, content)
+		assertBlob(t, store, other, otherContent)
+
+	})
+
+}
+
+func assertBlob(t *testing.T, store BlobStore, key string, expected []byte) {
+
+	t.Helper()
+
+	blob, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer blob.Close()
+
+	actual, err := ioutil.ReadAll(blob)
+	if err != nil {
+		t.Fatalf("failed to read blob %s: %s", key, err)
+	}
+
+	if !bytes.Equal(actual, expected) {
+		t.Fatalf("expected blob %s to contain %q, got %q", key, expected, actual)
+	}
+
+}
+
+// s3StandIn implements the subset of the S3 API used by the S3 BlobStore for a single path style bucket
+type s3StandIn struct {
+	bucket  string
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newS3StandIn(bucket string) *s3StandIn {
+	return &s3StandIn{
+		bucket:  bucket,
+		objects: make(map[string][]byte),
+	}
+}
+
+func (s *s3StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	prefix := "/" + s.bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.Error(w, "unknown bucket", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.objects[key] = body
+		w.WriteHeader(http.StatusOK)
+	case http.MethodHead, http.MethodGet:
+		object, ok := s.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(object)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+
+}
@@ -0,0 +1,111 @@
+package attachment
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type fileStore struct {
+	folder string
+}
+
+// NewFileStore returns a BlobStore that keeps every blob as a file in folder.
+// Blobs are spread across sub folders named after the first two characters of their key
+func NewFileStore(folder string) BlobStore {
+	return &fileStore{
+		folder: folder,
+	}
+}
+
+func (s *fileStore) Exists(ctx context.Context, key string) (bool, error) {
+
+	path, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to stat blob %s: %w", key, err)
+	}
+
+	return true, nil
+
+}
+
+func (s *fileStore) Put(ctx context.Context, key string, content io.ReadSeeker, size int64, contentType string) error {
+
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create blob folder: %w", err)
+	}
+
+	// The blob is written to a temporary file first so that a partially written blob is never visible
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+key+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob %s: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, content)
+	if err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write blob %s: %w", key, err)
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write blob %s: %w", key, err)
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return fmt.Errorf("failed to write blob %s: %w", key, err)
+	}
+
+	return nil
+
+}
+
+func (s *fileStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob %s: %w", key, err)
+	}
+
+	return file, nil
+
+}
+
+// path returns the location of the blob, refusing keys that would escape the folder of the store
+func (s *fileStore) path(key string) (string, error) {
+
+	if len(key) < 3 || strings.ContainsAny(key, `/\.`) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+
+	return filepath.Join(s.folder, key[:2], key), nil
+
+}
@@ -0,0 +1,127 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3Config describes the bucket that a S3 BlobStore keeps its blobs in. Endpoint and PathStyle
+// allow the store to be pointed at an S3 compatible service such as MinIO instead of AWS
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+}
+
+type s3Store struct {
+	client *s3.S3
+	bucket string
+}
+
+// NewS3Store returns a BlobStore that keeps every blob as an object in a S3 bucket.
+// Credentials are read from the environment when no access key is configured
+func NewS3Store(config S3Config) (BlobStore, error) {
+
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("bucket is required, received empty value")
+	}
+
+	awsConfig := aws.NewConfig().
+		WithRegion(config.Region).
+		WithS3ForcePathStyle(config.PathStyle)
+
+	if config.Endpoint != "" {
+		awsConfig = awsConfig.WithEndpoint(config.Endpoint)
+	}
+
+	if config.AccessKey != "" {
+		awsConfig = awsConfig.WithCredentials(credentials.NewStaticCredentials(config.AccessKey, config.SecretKey, ""))
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize s3 session: %w", err)
+	}
+
+	return &s3Store{
+		client: s3.New(sess),
+		bucket: config.Bucket,
+	}, nil
+
+}
+
+func (s *s3Store) Exists(ctx context.Context, key string) (bool, error) {
+
+	_, err := s.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to stat blob %s: %w", key, err)
+	}
+
+	return true, nil
+
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, content io.ReadSeeker, size int64, contentType string) error {
+
+	_, err := s.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          content,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write blob %s: %w", key, err)
+	}
+
+	return nil
+
+}
+
+func (s *s3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+
+	object, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob %s: %w", key, err)
+	}
+
+	return object.Body, nil
+
+}
+
+// isNotFound reports whether the error was caused by a missing object. HEAD requests carry no
+// body, so a missing object is reported through the status code rather than an error code
+func isNotFound(err error) bool {
+
+	var aerr awserr.RequestFailure
+	if errors.As(err, &aerr) {
+		return aerr.StatusCode() == http.StatusNotFound
+	}
+
+	return false
+
+}
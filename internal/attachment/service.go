@@ -0,0 +1,385 @@
+package attachment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/internal"
+	"github.com/embersyndicate/support/internal/audit"
+	"github.com/embersyndicate/support/pkg/middleware"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Config controls the files that may be attached to tickets and the links that are handed out to download them
+type Config struct {
+	// MaxSize is the maximum size of an attachment in bytes
+	MaxSize int64
+	// Types are the media types that may be attached. The type of a file is detected from its content
+	Types []string
+	// Secret is the key that download links are signed with
+	Secret []byte
+	// URLTTL is how long a download link remains valid
+	URLTTL time.Duration
+	// BaseURL is the address of the API, download links are relative when it is empty
+	BaseURL string
+}
+
+type Service interface {
+	support.AttachmentRepository
+	TicketAttachments(ctx context.Context, ticketID string) ([]*support.Attachment, error)
+	UploadAttachment(ctx context.Context, ticketID, name string, content io.Reader) (*support.Attachment, error)
+	OpenAttachment(ctx context.Context, id, expires, signature string) (*support.Attachment, io.ReadCloser, error)
+	MaxSize() int64
+}
+
+type service struct {
+	support.AttachmentRepository
+	config  Config
+	types   map[string]bool
+	blobs   BlobStore
+	tickets support.TicketRepository
+	audit   audit.Service
+}
+
+func New(config Config, blobs BlobStore, attachment support.AttachmentRepository, tickets support.TicketRepository, audit audit.Service) (Service, error) {
+
+	if config.MaxSize <= 0 {
+		return nil, fmt.Errorf("max size must be greater than zero, got %d", config.MaxSize)
+	}
+
+	if len(config.Secret) == 0 {
+		return nil, fmt.Errorf("secret is required, received empty value")
+	}
+
+	if config.URLTTL <= 0 {
+		return nil, fmt.Errorf("url ttl must be greater than zero, got %s", config.URLTTL)
+	}
+
+	types := make(map[string]bool, len(config.Types))
+	for _, t := range config.Types {
+		types[strings.ToLower(strings.TrimSpace(t))] = true
+	}
+
+	return &service{
+		AttachmentRepository: attachment,
+		config:               config,
+		types:                types,
+		blobs:                blobs,
+		tickets:              tickets,
+		audit:                audit,
+	}, nil
+
+}
+
+// Attachment returns the attachment along with a signed link to its content. Pending attachments
+// are only returned to the user that uploaded them and all others to the users that can read their ticket
+// MaxSize returns the maximum size of an attachment in bytes
+func (s *service) MaxSize() int64 {
+	return s.config.MaxSize
+}
+
+func (s *service) Attachment(ctx context.Context, id string) (*support.Attachment, error) {
+
+	attachment, err := s.AttachmentRepository.Attachment(ctx, id)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("failed to fetch attachment %s", id))
+	}
+
+	if attachment.TicketID != nil {
+		_, err = internal.ReadableTicket(ctx, s.tickets, attachment.TicketID.Hex())
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		userID, err := middleware.GetUserObjectIDFromContext(ctx)
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+			return nil, fmt.Errorf("failed to retrieve user id from context")
+		}
+
+		if attachment.UploadedBy != userID {
+			return nil, internal.NewInternalError(internal.LevelForbidden, fmt.Sprintf("attachment %s was not uploaded by you", id))
+		}
+	}
+
+	s.sign(attachment)
+
+	return attachment, nil
+
+}
+
+// TicketAttachments returns the attachments of the ticket, oldest first, along with signed links to their content
+func (s *service) TicketAttachments(ctx context.Context, ticketID string) ([]*support.Attachment, error) {
+
+	ticket, err := internal.ReadableTicket(ctx, s.tickets, ticketID)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := s.AttachmentRepository.Attachments(
+		ctx,
+		support.NewEqualOperator("ticketID", ticket.ID),
+		support.NewOrderOperator("createdAt", support.SortAsc),
+	)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to fetch attachments of ticket %s", ticketID))
+	}
+
+	for _, attachment := range attachments {
+		s.sign(attachment)
+	}
+
+	return attachments, nil
+
+}
+
+// UploadAttachment stores the content as an attachment of the ticket. Without a ticketID the attachment
+// is pending until it is submitted as the value of a file field. The type of the content is detected
+// from the content itself, and content that has already been stored is not stored a second time.
+// Uploading the same file to the same ticket twice returns the existing attachment
+func (s *service) UploadAttachment(ctx context.Context, ticketID, name string, content io.Reader) (*support.Attachment, error) {
+
+	userID, err := middleware.GetUserObjectIDFromContext(ctx)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to retrieve user id from context")
+	}
+
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "" || name == "." || name == "/" {
+		return nil, internal.NewInternalError(internal.LevelBad, "name is required, received empty value")
+	}
+
+	if len([]rune(name)) > support.AttachmentNameMaxLength {
+		return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("name cannot be longer than %d characters", support.AttachmentNameMaxLength))
+	}
+
+	var ticket *support.Ticket
+	if ticketID != "" {
+		ticket, err = internal.ReadableTicket(ctx, s.tickets, ticketID)
+		if err != nil {
+			return nil, err
+		}
+
+		if ticket.SubmittedBy != userID && !middleware.HasPermissionFromContext(ctx, support.PermissionUpdateAllTickets.String()) {
+			return nil, internal.NewInternalError(internal.LevelForbidden, "files may only be attached to a ticket by its submitter or staff")
+		}
+	}
+
+	// The content is buffered to disk, since its digest is needed before it can be stored
+	tmp, err := ioutil.TempFile("", "attachment-*")
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to buffer attachment")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(content, s.config.MaxSize+1))
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelBad, "failed to read attachment")
+	}
+
+	if size == 0 {
+		return nil, internal.NewInternalError(internal.LevelBad, "attachment is empty")
+	}
+
+	if size > s.config.MaxSize {
+		return nil, internal.NewInternalError(internal.LevelTooLarge, fmt.Sprintf("attachments cannot be larger than %d bytes", s.config.MaxSize))
+	}
+
+	contentType, err := s.detectType(tmp)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to detect the type of the attachment")
+	}
+
+	if !s.types[contentType] {
+		return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("attachments of type %s are not allowed", contentType))
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	existing, err := s.AttachmentRepository.Attachments(ctx, s.duplicateOperators(userID, ticket, sum)...)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to fetch existing attachments")
+	}
+
+	if len(existing) > 0 {
+		s.sign(existing[0])
+		return existing[0], nil
+	}
+
+	exists, err := s.blobs.Exists(ctx, sum)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to store attachment")
+	}
+
+	if !exists {
+		_, err = tmp.Seek(0, io.SeekStart)
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+			return nil, internal.NewInternalError(internal.LevelInternal, "failed to store attachment")
+		}
+
+		err = s.blobs.Put(ctx, sum, tmp, size, contentType)
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+			return nil, internal.NewInternalError(internal.LevelInternal, "failed to store attachment")
+		}
+	}
+
+	attachment := &support.Attachment{
+		UploadedBy:  userID,
+		Name:        name,
+		ContentType: contentType,
+		Size:        size,
+		SHA256:      sum,
+		CreatedAt:   time.Now(),
+	}
+	if ticket != nil {
+		attachment.TicketID = &ticket.ID
+	}
+
+	attachment, err = s.AttachmentRepository.CreateAttachment(ctx, attachment)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to create attachment")
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityAttachment,
+		EntityID: attachment.ID,
+		ParentID: attachment.TicketID,
+		Action:   support.AuditActionCreate,
+	}, nil, attachment)
+
+	if ticket != nil {
+		err = s.tickets.TouchTicket(ctx, ticket.ID, attachment.CreatedAt)
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+		}
+	}
+
+	s.sign(attachment)
+
+	return attachment, nil
+
+}
+
+// OpenAttachment returns the attachment identified by a download link along with its content.
+// The signature of the link is the only authorization required, so links may be embedded in pages
+func (s *service) OpenAttachment(ctx context.Context, id, expires, signature string) (*support.Attachment, io.ReadCloser, error) {
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || !hmac.Equal([]byte(signature), []byte(s.signature(id, expires))) {
+		return nil, nil, internal.NewInternalError(internal.LevelForbidden, "download link is invalid")
+	}
+
+	if time.Now().Unix() > expiresAt {
+		return nil, nil, internal.NewInternalError(internal.LevelForbidden, "download link has expired")
+	}
+
+	attachment, err := s.AttachmentRepository.Attachment(ctx, id)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("failed to fetch attachment %s", id))
+	}
+
+	content, err := s.blobs.Get(ctx, attachment.SHA256)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to open attachment %s", id))
+	}
+
+	return attachment, content, nil
+
+}
+
+// duplicateOperators matches an attachment with the same content that was uploaded to the same ticket,
+// or for pending attachments, a pending attachment with the same content that was uploaded by the same user
+func (s *service) duplicateOperators(userID primitive.ObjectID, ticket *support.Ticket, sum string) []*support.Operator {
+
+	operators := []*support.Operator{
+		support.NewEqualOperator("sha256", sum),
+		support.NewLimitOperator(1),
+	}
+
+	if ticket != nil {
+		return append(operators, support.NewEqualOperator("ticketID", ticket.ID))
+	}
+
+	return append(operators,
+		support.NewEqualOperator("uploadedBy", userID),
+		support.NewExistsOperator("ticketID", false),
+	)
+
+}
+
+// detectType returns the media type of the buffered content without any parameters
+func (s *service) detectType(content io.ReadSeeker) (string, error) {
+
+	_, err := content.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+
+	// DetectContentType considers at most the first 512 bytes
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(content, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	if err != nil {
+		return "", err
+	}
+
+	return mediaType, nil
+
+}
+
+// sign sets the signed download link of the attachment, which is served by the download endpoint of the API
+func (s *service) sign(attachment *support.Attachment) {
+
+	expiresAt := time.Now().Add(s.config.URLTTL).Truncate(time.Second)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", s.signature(attachment.ID.Hex(), expires))
+
+	attachment.URL = fmt.Sprintf("%s/v1/attachments/%s/download?%s", strings.TrimSuffix(s.config.BaseURL, "/"), attachment.ID.Hex(), query.Encode())
+	attachment.URLExpiresAt = &expiresAt
+
+}
+
+func (s *service) signature(id, expires string) string {
+
+	mac := hmac.New(sha256.New, s.config.Secret)
+	_, _ = mac.Write([]byte(id + ":" + expires))
+
+	return hex.EncodeToString(mac.Sum(nil))
+
+}
@@ -0,0 +1,272 @@
+package attachment
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/internal"
+	"github.com/embersyndicate/support/internal/audit"
+	"github.com/embersyndicate/support/pkg/middleware"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const testMaxSize = 16
+
+func TestSignature(t *testing.T) {
+
+	s := newTestService(t, NewFileStore(t.TempDir()))
+	other := newTestService(t, NewFileStore(t.TempDir()))
+	other.config.Secret = []byte("another secret")
+
+	signature := s.signature("5fd0c1a2b3c4d5e6f7a8b9c0", "1606824000")
+
+	if signature != s.signature("5fd0c1a2b3c4d5e6f7a8b9c0", "1606824000") {
+		t.Errorf("expected the signature to be deterministic")
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+	}{
+		{name: "different id", signature: s.signature("5fd0c1a2b3c4d5e6f7a8b9c1", "1606824000")},
+		{name: "different expiry", signature: s.signature("5fd0c1a2b3c4d5e6f7a8b9c0", "1606824001")},
+		{name: "shifted separator", signature: s.signature("5fd0c1a2b3c4d5e6f7a8b9c0:1606824000", "")},
+		{name: "different secret", signature: other.signature("5fd0c1a2b3c4d5e6f7a8b9c0", "1606824000")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			if test.signature == signature {
+				t.Errorf("expected signature to differ from %s", signature)
+			}
+
+		})
+	}
+
+}
+
+func TestOpenAttachment(t *testing.T) {
+
+	blobs := NewFileStore(t.TempDir())
+	s := newTestService(t, blobs)
+	repo := s.AttachmentRepository.(*attachmentRepository)
+
+	content := []byte("printer is on fire")
+	attachment := repo.add(&support.Attachment{Name: "report.txt", SHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"})
+	err := blobs.Put(context.Background(), attachment.SHA256, bytes.NewReader(content), int64(len(content)), "text/plain")
+	if err != nil {
+		t.Fatalf("failed to store blob: %s", err)
+	}
+
+	id := attachment.ID.Hex()
+	future := strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	valid := s.signature(id, future)
+
+	tests := []struct {
+		name      string
+		id        string
+		expires   string
+		signature string
+		err       string
+	}{
+		{name: "valid link", id: id, expires: future, signature: valid},
+		{name: "expired link", id: id, expires: past, signature: s.signature(id, past), err: "download link has expired"},
+		{name: "expiry extended", id: id, expires: strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10), signature: valid, err: "download link is invalid"},
+		{name: "signature of another attachment", id: primitive.NewObjectID().Hex(), expires: future, signature: valid, err: "download link is invalid"},
+		{name: "tampered signature", id: id, expires: future, signature: strings.Repeat("0", len(valid)), err: "download link is invalid"},
+		{name: "truncated signature", id: id, expires: future, signature: valid[:len(valid)-1], err: "download link is invalid"},
+		{name: "upper case signature", id: id, expires: future, signature: strings.ToUpper(valid), err: "download link is invalid"},
+		{name: "missing signature", id: id, expires: future, signature: "", err: "download link is invalid"},
+		{name: "non numeric expiry", id: id, expires: "tomorrow", signature: s.signature(id, "tomorrow"), err: "download link is invalid"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			opened, blob, err := s.OpenAttachment(context.Background(), test.id, test.expires, test.signature)
+			if test.err != "" {
+				assertInternalError(t, err, internal.LevelForbidden, test.err)
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer blob.Close()
+
+			if opened.ID != attachment.ID {
+				t.Errorf("expected attachment %s, got %s", attachment.ID.Hex(), opened.ID.Hex())
+			}
+
+			actual, err := ioutil.ReadAll(blob)
+			if err != nil {
+				t.Fatalf("failed to read attachment: %s", err)
+			}
+
+			if !bytes.Equal(actual, content) {
+				t.Errorf("expected content %q, got %q", content, actual)
+			}
+
+		})
+	}
+
+	t.Run("signed url", func(t *testing.T) {
+
+		s.sign(attachment)
+
+		link, err := url.Parse(attachment.URL)
+		if err != nil {
+			t.Fatalf("failed to parse url %s: %s", attachment.URL, err)
+		}
+
+		if expected := fmt.Sprintf("/v1/attachments/%s/download", id); link.Path != expected {
+			t.Errorf("expected path %s, got %s", expected, link.Path)
+		}
+
+		if expires := link.Query().Get("expires"); expires != strconv.FormatInt(attachment.URLExpiresAt.Unix(), 10) {
+			t.Errorf("expected expires to match the expiry of the url, got %s", expires)
+		}
+
+		_, blob, err := s.OpenAttachment(context.Background(), id, link.Query().Get("expires"), link.Query().Get("signature"))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		blob.Close()
+
+	})
+
+}
+
+func TestUploadAttachmentSize(t *testing.T) {
+
+	ctx := middleware.SetUserIDOnContext(context.Background(), primitive.NewObjectID().Hex())
+
+	tests := []struct {
+		name  string
+		size  int
+		level internal.Level
+		err   string
+	}{
+		{name: "empty", size: 0, level: internal.LevelBad, err: "attachment is empty"},
+		{name: "single byte", size: 1},
+		{name: "max size", size: testMaxSize},
+		{name: "one byte over max size", size: testMaxSize + 1, level: internal.LevelTooLarge, err: fmt.Sprintf("attachments cannot be larger than %d bytes", testMaxSize)},
+		{name: "far over max size", size: testMaxSize * 1024, level: internal.LevelTooLarge, err: fmt.Sprintf("attachments cannot be larger than %d bytes", testMaxSize)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			blobs := NewFileStore(t.TempDir())
+			s := newTestService(t, blobs)
+
+			attachment, err := s.UploadAttachment(ctx, "", "notes.txt", strings.NewReader(strings.Repeat("a", test.size)))
+			if test.err != "" {
+				assertInternalError(t, err, test.level, test.err)
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if attachment.Size != int64(test.size) {
+				t.Errorf("expected size %d, got %d", test.size, attachment.Size)
+			}
+
+			assertBlob(t, blobs, attachment.SHA256, []byte(strings.Repeat("a", test.size)))
+
+		})
+	}
+
+}
+
+func newTestService(t *testing.T, blobs BlobStore) *service {
+
+	t.Helper()
+
+	s, err := New(Config{
+		MaxSize: testMaxSize,
+		Types:   []string{"text/plain"},
+		Secret:  []byte("secret"),
+		URLTTL:  time.Minute,
+	}, blobs, newAttachmentRepository(), nil, auditService{})
+	if err != nil {
+		t.Fatalf("failed to create attachment service: %s", err)
+	}
+
+	return s.(*service)
+
+}
+
+func assertInternalError(t *testing.T, err error, level internal.Level, message string) {
+
+	t.Helper()
+
+	var ierr internal.InternalError
+	if !errors.As(err, &ierr) {
+		t.Fatalf("expected an internal error %q, got %v", message, err)
+	}
+
+	if ierr.Level != level || ierr.Message != message {
+		t.Fatalf("expected error %q of level %v, got %q of level %v", message, level, ierr.Message, ierr.Level)
+	}
+
+}
+
+// attachmentRepository keeps attachments in memory
+type attachmentRepository struct {
+	attachments map[string]*support.Attachment
+}
+
+func newAttachmentRepository() *attachmentRepository {
+	return &attachmentRepository{attachments: make(map[string]*support.Attachment)}
+}
+
+func (r *attachmentRepository) add(attachment *support.Attachment) *support.Attachment {
+	attachment.ID = primitive.NewObjectID()
+	r.attachments[attachment.ID.Hex()] = attachment
+	return attachment
+}
+
+func (r *attachmentRepository) Attachment(ctx context.Context, id string) (*support.Attachment, error) {
+
+	attachment, ok := r.attachments[id]
+	if !ok {
+		return nil, fmt.Errorf("attachment %s does not exist", id)
+	}
+
+	return attachment, nil
+
+}
+
+func (r *attachmentRepository) Attachments(ctx context.Context, operators ...*support.Operator) ([]*support.Attachment, error) {
+	return []*support.Attachment{}, nil
+}
+
+func (r *attachmentRepository) CreateAttachment(ctx context.Context, attachment *support.Attachment) (*support.Attachment, error) {
+	return r.add(attachment), nil
+}
+
+func (r *attachmentRepository) BindAttachments(ctx context.Context, ticketID primitive.ObjectID, ids ...primitive.ObjectID) error {
+	return nil
+}
+
+// auditService discards every event
+type auditService struct {
+	audit.Service
+}
+
+func (auditService) Record(ctx context.Context, event *support.AuditEvent, before, after interface{}) {
+}
@@ -0,0 +1,226 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/internal"
+	"github.com/embersyndicate/support/pkg/middleware"
+)
+
+// redacted is the value recorded in place of the attributes listed in redactedFields
+const redacted = "[redacted]"
+
+// redactedFields are attributes whose values must never be written to the audit trail
+var redactedFields = map[string]bool{
+	"password": true,
+}
+
+// personalFields are the attributes of a user that are anonymised once the user is deleted,
+// so their values are redacted as well to keep them from outliving the user in the audit trail
+var personalFields = map[string]bool{
+	"first_name": true,
+	"last_name":  true,
+	"email":      true,
+	"username":   true,
+}
+
+// ignoredFields are attributes that change alongside every other change, so recording them adds nothing
+var ignoredFields = map[string]bool{
+	"updatedAt": true,
+	"updatedBy": true,
+}
+
+type Service interface {
+	support.AuditRepository
+	Record(ctx context.Context, event *support.AuditEvent, before, after interface{})
+	TicketHistory(ctx context.Context, ticketID string) ([]*support.AuditEvent, error)
+}
+
+type service struct {
+	support.AuditRepository
+	tickets support.TicketRepository
+}
+
+func New(audit support.AuditRepository, tickets support.TicketRepository) Service {
+	return &service{
+		AuditRepository: audit,
+		tickets:         tickets,
+	}
+}
+
+// Snapshot captures the current state of an entity so that it can be handed to Record as the
+// before state once the entity has been changed. Entities are commonly changed in place, so
+// passing the entity itself as the before state would record the state after the change
+func Snapshot(entity interface{}) map[string]interface{} {
+
+	snapshot, err := flatten(entity)
+	if err != nil {
+		return nil
+	}
+
+	return snapshot
+
+}
+
+// Record appends the event to the audit trail, filling in the actor, request and time of the change
+// and the changes between the before and after states of the entity. Either state may be nil when
+// an entity is created or deleted. The change that the event describes has already been made by the
+// time it is recorded, so a failure to record it is logged rather than returned
+func (s *service) Record(ctx context.Context, event *support.AuditEvent, before, after interface{}) {
+
+	if userID, err := middleware.GetUserObjectIDFromContext(ctx); err == nil {
+		event.ActorID = &userID
+	}
+
+	event.RequestID = middleware.GetRequestID(ctx)
+	event.CreatedAt = time.Now()
+
+	redact := redactedFields
+	if event.Entity == support.AuditEntityUser {
+		redact = make(map[string]bool, len(redactedFields)+len(personalFields))
+		for field := range redactedFields {
+			redact[field] = true
+		}
+		for field := range personalFields {
+			redact[field] = true
+		}
+	}
+
+	changes, err := diff(before, after, redact)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, fmt.Errorf("failed to compute changes of %s %s: %w", event.Entity, event.EntityID.Hex(), err))
+		return
+	}
+	event.Changes = changes
+
+	_, err = s.AuditRepository.CreateAuditEvent(ctx, event)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, fmt.Errorf("failed to record %s of %s %s: %w", event.Action, event.Entity, event.EntityID.Hex(), err))
+	}
+
+}
+
+func (s *service) AuditEvents(ctx context.Context, operators ...*support.Operator) ([]*support.AuditEvent, error) {
+
+	events, err := s.AuditRepository.AuditEvents(ctx, operators...)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to fetch audit events")
+	}
+
+	return events, nil
+
+}
+
+// TicketHistory returns the changes that have been made to the ticket and its comments, oldest first.
+// Users that cannot read every ticket only see the changes made to the ticket itself and not the values
+// that were changed, since those may include hidden fields
+func (s *service) TicketHistory(ctx context.Context, ticketID string) ([]*support.AuditEvent, error) {
+
+	ticket, err := internal.ReadableTicket(ctx, s.tickets, ticketID)
+	if err != nil {
+		return nil, err
+	}
+
+	staff := middleware.HasPermissionFromContext(ctx, support.PermissionReadAllTickets.String())
+
+	filter := support.NewEqualOperator("entityID", ticket.ID)
+	if staff {
+		filter = support.NewOrOperator(filter, support.NewEqualOperator("parentID", ticket.ID))
+	}
+
+	events, err := s.AuditEvents(ctx, filter, support.NewOrderOperator("createdAt", support.SortAsc))
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelInternal, err.Error())
+	}
+
+	if !staff {
+		for _, event := range events {
+			event.Changes = nil
+		}
+	}
+
+	return events, nil
+
+}
+
+// diff returns the attributes whose values differ between the before and after states of an entity,
+// ordered by the name of the attribute. Attributes are named after the json representation of the entity.
+// The values of the attributes listed in redact are replaced, recording only that they changed
+func diff(before, after interface{}, redact map[string]bool) ([]*support.AuditChange, error) {
+
+	b, err := flatten(before)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := flatten(after)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(b)+len(a))
+	for field := range b {
+		fields = append(fields, field)
+	}
+	for field := range a {
+		if _, ok := b[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := make([]*support.AuditChange, 0)
+	for _, field := range fields {
+		if ignoredFields[field] || reflect.DeepEqual(b[field], a[field]) {
+			continue
+		}
+
+		change := &support.AuditChange{Field: field, Before: b[field], After: a[field]}
+		if redact[field] {
+			if change.Before != nil {
+				change.Before = redacted
+			}
+			if change.After != nil {
+				change.After = redacted
+			}
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+
+}
+
+// flatten converts an entity into a map of its json attributes. Snapshots are returned as is
+func flatten(entity interface{}) (map[string]interface{}, error) {
+
+	if entity == nil || reflect.ValueOf(entity).Kind() == reflect.Ptr && reflect.ValueOf(entity).IsNil() {
+		return map[string]interface{}{}, nil
+	}
+
+	if snapshot, ok := entity.(map[string]interface{}); ok {
+		return snapshot, nil
+	}
+
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	var flattened = make(map[string]interface{})
+	err = json.Unmarshal(data, &flattened)
+	if err != nil {
+		return nil, err
+	}
+
+	return flattened, nil
+
+}
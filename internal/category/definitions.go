@@ -0,0 +1,312 @@
+package category
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/internal"
+	"github.com/embersyndicate/support/internal/audit"
+	"github.com/embersyndicate/support/pkg/middleware"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CategoryDefinitions returns the enabled ticket definitions that may be used in the category, including those
+// inherited from its ancestors, with their field definitions expanded. Definitions associated with the category
+// itself are listed first, followed by those of its parent and so on up the tree
+func (s *service) CategoryDefinitions(ctx context.Context, id string) ([]*support.CategoryDefinition, error) {
+
+	granted, order, err := s.resolveDefinitions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*support.CategoryDefinition, 0, len(order))
+	if len(order) == 0 {
+		return result, nil
+	}
+
+	definitions, err := s.tickets.TicketDefinitions(ctx, support.NewInOperator("_id", order))
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to fetch ticket definitions")
+	}
+
+	byID := make(map[primitive.ObjectID]*support.TicketDefinition, len(definitions))
+	fieldIDs := make([]primitive.ObjectID, 0)
+	for _, definition := range definitions {
+		byID[definition.ID] = definition
+		fieldIDs = append(fieldIDs, definition.Fields...)
+	}
+
+	fields, err := s.tickets.FieldDefinitions(ctx, support.NewInOperator("_id", fieldIDs))
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to fetch field definitions")
+	}
+
+	for _, definitionID := range order {
+		definition, ok := byID[definitionID]
+		if !ok || definition.Disabled {
+			continue
+		}
+
+		result = append(result, &support.CategoryDefinition{
+			ExpandedTicketDefinition: support.ExpandTicketDefinition(definition, fields),
+			GrantedBy:                granted[definitionID],
+		})
+	}
+
+	return result, nil
+
+}
+
+// DefinitionPermitted reports whether the definition may be used to submit tickets in the category
+func (s *service) DefinitionPermitted(ctx context.Context, categoryID, definitionID primitive.ObjectID) (bool, error) {
+
+	granted, _, err := s.resolveDefinitions(ctx, categoryID.Hex())
+	if err != nil {
+		return false, err
+	}
+
+	_, ok := granted[definitionID]
+
+	return ok, nil
+
+}
+
+// AddCategoryDefinition permits the definition to be used in the category and the categories nested beneath it
+func (s *service) AddCategoryDefinition(ctx context.Context, id, definitionID string) (*support.Category, error) {
+
+	category, err := s.Category(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	_definitionID, err := primitive.ObjectIDFromHex(definitionID)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("unable to cast %s to ObjectID", definitionID))
+	}
+
+	for _, existing := range category.Definitions {
+		if existing == _definitionID {
+			return category, nil
+		}
+	}
+
+	category.Definitions = append(category.Definitions, _definitionID)
+
+	return s.UpdateCategory(ctx, id, category)
+
+}
+
+// RemoveCategoryDefinition removes the association between the category and the definition. Definitions
+// that are inherited from an ancestor have to be removed from the ancestor that they are associated with
+func (s *service) RemoveCategoryDefinition(ctx context.Context, id, definitionID string) (*support.Category, error) {
+
+	category, err := s.Category(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	definitions := make([]primitive.ObjectID, 0, len(category.Definitions))
+	for _, existing := range category.Definitions {
+		if existing.Hex() != definitionID {
+			definitions = append(definitions, existing)
+		}
+	}
+
+	if len(definitions) == len(category.Definitions) {
+		return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("definition %s is not associated with category %s", definitionID, id))
+	}
+
+	category.Definitions = definitions
+
+	return s.UpdateCategory(ctx, id, category)
+
+}
+
+// BackfillDefinitions associates every category with the ticket definitions that its tickets were submitted with,
+// unless the category already permits them. Tickets created before definitions were bound to categories would
+// otherwise be rejected by DefinitionPermitted. Definitions that no longer exist and categories that have been
+// deleted are skipped, so the backfill may be run any number of times. It returns the number of categories that were updated
+func (s *service) BackfillDefinitions(ctx context.Context) (int, error) {
+
+	used, err := s.tickets.CategoryTicketDefinitions(ctx)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return 0, fmt.Errorf("failed to fetch the ticket definitions used in each category")
+	}
+
+	ids := make([]primitive.ObjectID, 0)
+	for _, definitionIDs := range used {
+		ids = append(ids, definitionIDs...)
+	}
+
+	definitions, err := s.tickets.TicketDefinitions(ctx, support.NewInOperator("_id", ids))
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return 0, fmt.Errorf("failed to fetch ticket definitions")
+	}
+
+	exists := make(map[primitive.ObjectID]bool, len(definitions))
+	for _, definition := range definitions {
+		exists[definition.ID] = true
+	}
+
+	categories, err := s.Categories(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, category := range categories {
+		granted, _, err := s.resolveDefinitions(ctx, category.ID.Hex())
+		if err != nil {
+			return updated, err
+		}
+
+		before := audit.Snapshot(category)
+
+		missing := 0
+		for _, definitionID := range used[category.ID] {
+			if _, ok := granted[definitionID]; ok || !exists[definitionID] {
+				continue
+			}
+
+			category.Definitions = append(category.Definitions, definitionID)
+			missing++
+		}
+
+		if missing == 0 {
+			continue
+		}
+
+		category.UpdatedAt = time.Now()
+
+		_, err = s.CategoryRepository.UpdateCategory(ctx, category.ID.Hex(), category)
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+			return updated, fmt.Errorf("failed to update category %s", category.ID.Hex())
+		}
+
+		s.audit.Record(ctx, &support.AuditEvent{
+			Entity:   support.AuditEntityCategory,
+			EntityID: category.ID,
+			Action:   support.AuditActionUpdate,
+		}, before, category)
+
+		updated++
+	}
+
+	return updated, nil
+
+}
+
+// validateReassignment confirms that the tickets of the category, which are moved into the target, and the tickets of its
+// descendants, which inherit from the target instead of the category once they are nested beneath it, only use
+// definitions that remain permitted after the category has been reassigned
+func (s *service) validateReassignment(ctx context.Context, category, target *support.Category, descendants []*support.Category) error {
+
+	moved := make(map[primitive.ObjectID]bool, len(descendants))
+	ids := []primitive.ObjectID{category.ID}
+	for _, descendant := range descendants {
+		moved[descendant.ID] = true
+		ids = append(ids, descendant.ID)
+	}
+
+	used, err := s.tickets.CategoryTicketDefinitions(ctx, support.NewInOperator("categoryID", ids))
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to fetch the ticket definitions used in category %s", category.ID.Hex()))
+	}
+
+	inherited, _, err := s.resolveDefinitions(ctx, target.ID.Hex())
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		definitions, ok := used[id]
+		if !ok {
+			continue
+		}
+
+		// The tickets of the category itself end up in the target, while descendants keep
+		// the definitions that are granted by a category that is moved along with them
+		kept := make(map[primitive.ObjectID]primitive.ObjectID)
+		if id != category.ID {
+			kept, _, err = s.resolveDefinitions(ctx, id.Hex())
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, definitionID := range definitions {
+			if grantedBy, ok := kept[definitionID]; ok && moved[grantedBy] {
+				continue
+			}
+
+			if _, ok := inherited[definitionID]; ok {
+				continue
+			}
+
+			return internal.NewInternalError(internal.LevelConflict, fmt.Sprintf("tickets of category %s use definition %s, which is not permitted in category %s", id.Hex(), definitionID.Hex(), target.ID.Hex()))
+		}
+	}
+
+	return nil
+
+}
+
+// resolveDefinitions walks from the category up to the root of the tree, collecting the definitions associated
+// with each category. It returns the category that grants each definition, nearest first, and the order in which they were found
+func (s *service) resolveDefinitions(ctx context.Context, id string) (map[primitive.ObjectID]primitive.ObjectID, []primitive.ObjectID, error) {
+
+	category, err := s.Category(ctx, id)
+	if err != nil {
+		return nil, nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	ancestors, err := s.Ancestors(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chain := []*support.Category{category}
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		chain = append(chain, ancestors[i])
+	}
+
+	granted := make(map[primitive.ObjectID]primitive.ObjectID)
+	order := make([]primitive.ObjectID, 0)
+	for _, c := range chain {
+		for _, definitionID := range c.Definitions {
+			if _, ok := granted[definitionID]; ok {
+				continue
+			}
+
+			granted[definitionID] = c.ID
+			order = append(order, definitionID)
+		}
+	}
+
+	return granted, order, nil
+
+}
+
+// validateDefinitions confirms that every definition associated with the category exists
+func (s *service) validateDefinitions(ctx context.Context, category *support.Category) error {
+
+	for _, definitionID := range category.Definitions {
+		_, err := s.tickets.TicketDefinition(ctx, definitionID.Hex())
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+			return internal.NewInternalError(internal.LevelBad, fmt.Sprintf("unable to resolve %s definition id to valid ticket definition", definitionID.Hex()))
+		}
+	}
+
+	return nil
+
+}
@@ -6,23 +6,41 @@ import (
 	"time"
 
 	"github.com/embersyndicate/support"
-
+	"github.com/embersyndicate/support/internal"
+	"github.com/embersyndicate/support/internal/audit"
 	"github.com/embersyndicate/support/pkg/middleware"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Service interface {
 	support.CategoryRepository
+	Tree(ctx context.Context) ([]*support.CategoryNode, error)
+	Ancestors(ctx context.Context, id string) ([]*support.Category, error)
+	Descendants(ctx context.Context, id string) ([]*support.Category, error)
+	MoveCategory(ctx context.Context, id string, parentID *primitive.ObjectID) (*support.Category, error)
+	ReassignCategory(ctx context.Context, id, to string) error
+
+	CategoryDefinitions(ctx context.Context, id string) ([]*support.CategoryDefinition, error)
+	DefinitionPermitted(ctx context.Context, categoryID, definitionID primitive.ObjectID) (bool, error)
+	AddCategoryDefinition(ctx context.Context, id, definitionID string) (*support.Category, error)
+	RemoveCategoryDefinition(ctx context.Context, id, definitionID string) (*support.Category, error)
+	BackfillDefinitions(ctx context.Context) (int, error)
 }
 
 type service struct {
 	// cache  support.CategoryRepository
 	support.CategoryRepository
+
+	tickets support.TicketRepository
+	audit   audit.Service
 }
 
-func New(category support.CategoryRepository) Service {
+func New(category support.CategoryRepository, tickets support.TicketRepository, audit audit.Service) Service {
 
 	s := &service{
 		CategoryRepository: category,
+		tickets:            tickets,
+		audit:              audit,
 	}
 
 	return s
@@ -59,6 +77,18 @@ func (s *service) CreateCategory(ctx context.Context, category *support.Category
 		return nil, err
 	}
 
+	if category.ParentID != nil {
+		_, err = s.parent(ctx, *category.ParentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.validateDefinitions(ctx, category)
+	if err != nil {
+		return nil, err
+	}
+
 	userID, err := middleware.GetUserObjectIDFromContext(ctx)
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
@@ -77,23 +107,57 @@ func (s *service) CreateCategory(ctx context.Context, category *support.Category
 		return nil, fmt.Errorf("failed to create category: %w", err)
 	}
 
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityCategory,
+		EntityID: category.ID,
+		Action:   support.AuditActionCreate,
+	}, nil, category)
+
 	return category, err
 
 }
 
 func (s *service) UpdateCategory(ctx context.Context, id string, category *support.Category) (*support.Category, error) {
+	return s.update(ctx, id, category, support.AuditActionUpdate)
+}
+
+// update persists the changes that have been made to the category, recording them in the audit trail as the provided action
+func (s *service) update(ctx context.Context, id string, category *support.Category, action support.AuditAction) (*support.Category, error) {
 
 	err := category.VerifyAttributes()
 	if err != nil {
 		return nil, err
 	}
 
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("unable to cast %s to ObjectID", id))
+	}
+
+	if category.ParentID != nil {
+		err = s.validateParent(ctx, _id, *category.ParentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.validateDefinitions(ctx, category)
+	if err != nil {
+		return nil, err
+	}
+
 	userID, err := middleware.GetUserObjectIDFromContext(ctx)
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
 		return nil, fmt.Errorf("invalid user id: %w", err)
 	}
 
+	// The provided category has commonly been changed in place, so the stored category is the state before the change
+	current, err := s.Category(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
 	category.UpdatedAt = time.Now()
 	category.UpdatedBy = userID
 
@@ -103,6 +167,263 @@ func (s *service) UpdateCategory(ctx context.Context, id string, category *suppo
 		return nil, fmt.Errorf("failed to update category %s", id)
 	}
 
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityCategory,
+		EntityID: category.ID,
+		Action:   action,
+	}, current, category)
+
 	return category, err
 
 }
+
+// Tree returns every category nested beneath its parent. Categories whose parent
+// no longer exists are returned at the root of the tree alongside top level categories
+func (s *service) Tree(ctx context.Context) ([]*support.CategoryNode, error) {
+
+	categories, err := s.Categories(ctx, support.NewOrderOperator("name", support.SortAsc))
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[primitive.ObjectID]*support.CategoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.ID] = &support.CategoryNode{Category: category, Children: make([]*support.CategoryNode, 0)}
+	}
+
+	roots := make([]*support.CategoryNode, 0)
+	for _, category := range categories {
+		node := nodes[category.ID]
+		if category.ParentID != nil {
+			if parent, ok := nodes[*category.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+
+		roots = append(roots, node)
+	}
+
+	return roots, nil
+
+}
+
+// Ancestors returns the parents of the category, starting at the root of the tree and ending with its immediate parent
+func (s *service) Ancestors(ctx context.Context, id string) ([]*support.Category, error) {
+
+	category, err := s.Category(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	ancestors := make([]*support.Category, 0)
+	seen := map[primitive.ObjectID]bool{category.ID: true}
+	for category.ParentID != nil {
+		if seen[*category.ParentID] {
+			return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("category %s is part of a cycle", category.ID.Hex()))
+		}
+		seen[*category.ParentID] = true
+
+		category, err = s.Category(ctx, category.ParentID.Hex())
+		if err != nil {
+			break
+		}
+
+		ancestors = append([]*support.Category{category}, ancestors...)
+	}
+
+	return ancestors, nil
+
+}
+
+// Descendants returns every category nested beneath the category, nearest first
+func (s *service) Descendants(ctx context.Context, id string) ([]*support.Category, error) {
+
+	category, err := s.Category(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	descendants := make([]*support.Category, 0)
+	seen := map[primitive.ObjectID]bool{category.ID: true}
+	frontier := []primitive.ObjectID{category.ID}
+	for len(frontier) > 0 {
+		children, err := s.Categories(ctx, support.NewInOperator("parentID", frontier), support.NewOrderOperator("name", support.SortAsc))
+		if err != nil {
+			return nil, err
+		}
+
+		frontier = frontier[:0]
+		for _, child := range children {
+			if seen[child.ID] {
+				continue
+			}
+			seen[child.ID] = true
+
+			descendants = append(descendants, child)
+			frontier = append(frontier, child.ID)
+		}
+	}
+
+	return descendants, nil
+
+}
+
+// MoveCategory nests the category beneath the parent, or moves it to the root of the tree when parentID is nil
+func (s *service) MoveCategory(ctx context.Context, id string, parentID *primitive.ObjectID) (*support.Category, error) {
+
+	category, err := s.Category(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	category.ParentID = parentID
+
+	return s.update(ctx, id, category, support.AuditActionMove)
+
+}
+
+// DeleteCategory deletes the category. Categories that still have tickets or child categories cannot be deleted,
+// those have to be reassigned to another category with ReassignCategory first
+func (s *service) DeleteCategory(ctx context.Context, id string) error {
+
+	category, err := s.Category(ctx, id)
+	if err != nil {
+		return internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	children, err := s.Categories(ctx, support.NewEqualOperator("parentID", category.ID), support.NewLimitOperator(1))
+	if err != nil {
+		return err
+	}
+
+	if len(children) > 0 {
+		return internal.NewInternalError(internal.LevelConflict, fmt.Sprintf("category %s has child categories and cannot be deleted", category.Name))
+	}
+
+	tickets, err := s.tickets.Tickets(ctx, support.NewEqualOperator("categoryID", category.ID), support.NewLimitOperator(1))
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, "failed to fetch tickets of category")
+	}
+
+	if len(tickets) > 0 {
+		return internal.NewInternalError(internal.LevelConflict, fmt.Sprintf("category %s is referenced by tickets and cannot be deleted", category.Name))
+	}
+
+	err = s.CategoryRepository.DeleteCategory(ctx, id)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to delete category %s", id))
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityCategory,
+		EntityID: category.ID,
+		Action:   support.AuditActionDelete,
+	}, category, nil)
+
+	return nil
+
+}
+
+// ReassignCategory moves the tickets and child categories of the category into the to category.
+// The move is refused when any of the affected tickets uses a definition that would no longer be permitted
+func (s *service) ReassignCategory(ctx context.Context, id, to string) error {
+
+	category, err := s.Category(ctx, id)
+	if err != nil {
+		return internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	target, err := s.Category(ctx, to)
+	if err != nil {
+		return internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	// Nesting the children beneath one of their own descendants would form a cycle, so refuse before anything is moved
+	descendants, err := s.Descendants(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, descendant := range descendants {
+		if descendant.ID == target.ID {
+			return internal.NewInternalError(internal.LevelBad, "a category cannot be reassigned to one of its descendants")
+		}
+	}
+
+	err = s.validateReassignment(ctx, category, target, descendants)
+	if err != nil {
+		return err
+	}
+
+	children, err := s.Categories(ctx, support.NewEqualOperator("parentID", category.ID))
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		_, err = s.MoveCategory(ctx, child.ID.Hex(), &target.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.tickets.ReassignTicketCategory(ctx, category.ID, target.ID)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to reassign tickets of category %s", id))
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityCategory,
+		EntityID: category.ID,
+		Action:   support.AuditActionReassign,
+	}, nil, map[string]interface{}{"reassignedTo": target.ID.Hex()})
+
+	return nil
+
+}
+
+// parent fetches the category that is to become the parent of another category
+func (s *service) parent(ctx context.Context, parentID primitive.ObjectID) (*support.Category, error) {
+
+	parent, err := s.CategoryRepository.Category(ctx, parentID.Hex())
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("parent category %s does not exist", parentID.Hex()))
+	}
+
+	return parent, nil
+
+}
+
+// validateParent confirms that the parent exists and that nesting
+// the category beneath it would not make the category its own ancestor
+func (s *service) validateParent(ctx context.Context, id, parentID primitive.ObjectID) error {
+
+	parent, err := s.parent(ctx, parentID)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[primitive.ObjectID]bool)
+	for {
+		if parent.ID == id {
+			return internal.NewInternalError(internal.LevelBad, "a category cannot be nested beneath itself or one of its descendants")
+		}
+
+		if parent.ParentID == nil || seen[parent.ID] {
+			return nil
+		}
+		seen[parent.ID] = true
+
+		// An ancestor that no longer exists ends the chain, the category cannot be beneath itself past that point
+		parent, err = s.CategoryRepository.Category(ctx, parent.ParentID.Hex())
+		if err != nil {
+			return nil
+		}
+	}
+
+}
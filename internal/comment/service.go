@@ -0,0 +1,226 @@
+package comment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/internal"
+	"github.com/embersyndicate/support/internal/audit"
+	"github.com/embersyndicate/support/internal/sla"
+	"github.com/embersyndicate/support/pkg/middleware"
+)
+
+type Service interface {
+	support.CommentRepository
+	TicketComments(ctx context.Context, ticketID string) ([]*support.Comment, error)
+}
+
+type service struct {
+	support.CommentRepository
+	tickets support.TicketRepository
+	slas    sla.Service
+	audit   audit.Service
+}
+
+func New(comment support.CommentRepository, tickets support.TicketRepository, slas sla.Service, audit audit.Service) Service {
+	return &service{
+		CommentRepository: comment,
+		tickets:           tickets,
+		slas:              slas,
+		audit:             audit,
+	}
+}
+
+func (s *service) Comment(ctx context.Context, id string) (*support.Comment, error) {
+
+	comment, err := s.CommentRepository.Comment(ctx, id)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to fetch comment %s", id)
+	}
+
+	if comment.Internal && !middleware.HasPermissionFromContext(ctx, support.PermissionInternalComments.String()) {
+		return nil, fmt.Errorf("failed to fetch comment %s", id)
+	}
+
+	return comment, nil
+
+}
+
+// TicketComments returns the conversation that has taken place on the ticket, oldest comment first.
+// Internal comments are only returned to users that are allowed to read them
+func (s *service) TicketComments(ctx context.Context, ticketID string) ([]*support.Comment, error) {
+
+	ticket, err := internal.ReadableTicket(ctx, s.tickets, ticketID)
+	if err != nil {
+		return nil, err
+	}
+
+	operators := []*support.Operator{
+		support.NewEqualOperator("ticketID", ticket.ID),
+		support.NewOrderOperator("createdAt", support.SortAsc),
+	}
+	if !middleware.HasPermissionFromContext(ctx, support.PermissionInternalComments.String()) {
+		operators = append(operators, support.NewEqualOperator("internal", false))
+	}
+
+	comments, err := s.CommentRepository.Comments(ctx, operators...)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to fetch comments of ticket %s", ticketID))
+	}
+
+	return comments, nil
+
+}
+
+// CreateComment adds the comment to the conversation of the ticket identified by comment.TicketID
+// and marks the ticket as updated. The first public reply of an agent meets the first response target of the ticket
+func (s *service) CreateComment(ctx context.Context, comment *support.Comment) (*support.Comment, error) {
+
+	err := comment.ValidateAttributes()
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	userID, err := middleware.GetUserObjectIDFromContext(ctx)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to retrieve user id from context")
+	}
+
+	ticket, err := internal.ReadableTicket(ctx, s.tickets, comment.TicketID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.Internal && !middleware.HasPermissionFromContext(ctx, support.PermissionInternalComments.String()) {
+		return nil, internal.NewInternalError(internal.LevelForbidden, "only agents may leave internal comments")
+	}
+
+	now := time.Now()
+	comment.TicketID = ticket.ID
+	comment.AuthorID = userID
+	comment.CreatedAt = now
+	comment.EditedAt = nil
+
+	comment, err = s.CommentRepository.CreateComment(ctx, comment)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to create comment")
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityComment,
+		EntityID: comment.ID,
+		ParentID: &comment.TicketID,
+		Action:   support.AuditActionCreate,
+	}, nil, comment)
+
+	err = s.tickets.TouchTicket(ctx, ticket.ID, now)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to update ticket %s", ticket.ID.Hex()))
+	}
+
+	// The comment has already been created, so failing to record the response is logged rather than returned
+	err = s.slas.RecordResponse(ctx, ticket, comment)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+	}
+
+	return comment, nil
+
+}
+
+// UpdateComment replaces the body of the comment identified by id. Comments may only be edited by their author
+// and only their body may be changed. All other attributes of the provided comment are ignored
+func (s *service) UpdateComment(ctx context.Context, id string, comment *support.Comment) (*support.Comment, error) {
+
+	err := comment.ValidateAttributes()
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	current, err := s.authored(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := audit.Snapshot(current)
+
+	now := time.Now()
+	current.Body = comment.Body
+	current.EditedAt = &now
+
+	current, err = s.CommentRepository.UpdateComment(ctx, id, current)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to update comment %s", id))
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityComment,
+		EntityID: current.ID,
+		ParentID: &current.TicketID,
+		Action:   support.AuditActionUpdate,
+	}, before, current)
+
+	return current, nil
+
+}
+
+// DeleteComment removes the comment identified by id from the conversation. Comments may only be deleted by their author
+func (s *service) DeleteComment(ctx context.Context, id string) error {
+
+	comment, err := s.authored(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = s.CommentRepository.DeleteComment(ctx, id)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to delete comment %s", id))
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityComment,
+		EntityID: comment.ID,
+		ParentID: &comment.TicketID,
+		Action:   support.AuditActionDelete,
+	}, comment, nil)
+
+	return nil
+
+}
+
+// authored fetches the comment identified by id, confirming that it was written by the user making the request
+// and that they are still able to read the ticket that it belongs to
+func (s *service) authored(ctx context.Context, id string) (*support.Comment, error) {
+
+	userID, err := middleware.GetUserObjectIDFromContext(ctx)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to retrieve user id from context")
+	}
+
+	comment, err := s.Comment(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	if comment.AuthorID != userID {
+		return nil, internal.NewInternalError(internal.LevelForbidden, "comments may only be changed by their author")
+	}
+
+	_, err = internal.ReadableTicket(ctx, s.tickets, comment.TicketID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+
+}
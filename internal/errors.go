@@ -2,6 +2,8 @@ package internal
 
 import (
 	"errors"
+	"regexp"
+	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -9,13 +11,21 @@ import (
 type Level int
 
 const (
-	LevelInternal Level = 500
-	LevelBad      Level = 400
+	LevelInternal  Level = 500
+	LevelBad       Level = 400
+	LevelForbidden Level = 403
+	LevelConflict  Level = 409
+	LevelTooLarge  Level = 413
+	LevelTooMany   Level = 429
 )
 
 type InternalError struct {
 	Level   Level
 	Message string
+	Errors  []FieldError
+
+	// RetryAfter is how long a client should wait before retrying a LevelTooMany request
+	RetryAfter time.Duration
 }
 
 func (i InternalError) Error() string {
@@ -26,8 +36,32 @@ func NewInternalError(level Level, message string) InternalError {
 	return InternalError{Level: level, Message: message}
 }
 
+// FieldError describes a single input that failed validation so that
+// clients can highlight the offending input instead of parsing a message
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// NewValidationError returns a LevelBad InternalError carrying the list of inputs that failed validation
+func NewValidationError(message string, errs []FieldError) InternalError {
+	return InternalError{Level: LevelBad, Message: message, Errors: errs}
+}
+
+// NewConflictError returns a LevelConflict InternalError naming the field whose value is already in use
+func NewConflictError(message string, field string) InternalError {
+	return InternalError{Level: LevelConflict, Message: message, Errors: []FieldError{{Field: field, Message: "is already in use"}}}
+}
+
+// NewTooManyError returns a LevelTooMany InternalError telling the client how long to wait before retrying
+func NewTooManyError(message string, retryAfter time.Duration) InternalError {
+	return InternalError{Level: LevelTooMany, Message: message, RetryAfter: retryAfter}
+}
+
 const duplicateKeyError = 11000
 
+var duplicateKeyIndexRegexp = regexp.MustCompile(`index: (\S+) dup key`)
+
 func IsUniqueConstrainViolation(exception error) bool {
 
 	var bwe mongo.BulkWriteException
@@ -51,3 +85,37 @@ func IsUniqueConstrainViolation(exception error) bool {
 
 	return false
 }
+
+// DuplicateKeyIndex returns the name of the unique index that the exception violated,
+// or an empty string when the exception is not a unique constraint violation
+func DuplicateKeyIndex(exception error) string {
+
+	var messages []string
+
+	var bwe mongo.BulkWriteException
+	if errors.As(exception, &bwe) {
+		for _, errs := range bwe.WriteErrors {
+			if errs.Code == duplicateKeyError {
+				messages = append(messages, errs.Message)
+			}
+		}
+	}
+
+	var we mongo.WriteException
+	if errors.As(exception, &we) {
+		for _, errs := range we.WriteErrors {
+			if errs.Code == duplicateKeyError {
+				messages = append(messages, errs.Message)
+			}
+		}
+	}
+
+	for _, message := range messages {
+		match := duplicateKeyIndexRegexp.FindStringSubmatch(message)
+		if len(match) == 2 {
+			return match[1]
+		}
+	}
+
+	return ""
+}
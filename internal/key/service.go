@@ -1,6 +1,10 @@
 package key
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -9,27 +13,35 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/sirupsen/logrus"
 )
 
 var (
 	folder             = "_data/keys"
-	privatePEMFileName = fmt.Sprintf("%s/private.pem", folder)
-	publicPEMFileName  = fmt.Sprintf("%s/public.pem", folder)
+	ringFileName       = fmt.Sprintf("%s/ring.json", folder)
+	legacyPEMFileName  = "private.pem"
+	privatePEMFileName = fmt.Sprintf("%s/%s", folder, legacyPEMFileName)
 )
 
-// type Service interface {
-// 	LoadKeys() error
-// 	GetJWKS() Set
-// 	GetJWKSBytes() []byte
-// 	GetJWK() jwk.Key
-// 	GetPrivate() *rsa.PrivateKey
-// }
+// SupportedAlgorithms are the signing algorithms that the key service is able to generate keys for
+var SupportedAlgorithms = []jwa.SignatureAlgorithm{
+	jwa.RS256, jwa.ES256, jwa.EdDSA,
+}
 
 type Service interface {
 	LoadKeys() error
+	// Generated reports whether loading the keys generated a new active key, either because
+	// the key ring did not exist yet or because the configured algorithm had changed
+	Generated() bool
+	Rotate() error
+	GetSigningAlgorithm() jwa.SignatureAlgorithm
 	GetPublicJWKS() Set
 	GetPublicJWKSBytes() ([]byte, error)
 	GetPublicJWK() jwk.Key
@@ -41,17 +53,53 @@ type Set struct {
 	Keys []jwk.Key `json:"keys"`
 }
 
-type service struct {
-	key        *rsa.PrivateKey
+// metadata describes a single key of the key ring. The newest key that has not
+// been retired is the active key and is used to sign new tokens. Retired keys are
+// kept so that tokens they signed can still be verified until those tokens expire
+type metadata struct {
+	KeyID     string                 `json:"kid"`
+	Algorithm jwa.SignatureAlgorithm `json:"alg"`
+	File      string                 `json:"file"`
+	CreatedAt time.Time              `json:"createdAt"`
+	RetiredAt *time.Time             `json:"retiredAt,omitempty"`
+}
+
+type ringKey struct {
+	metadata
+	key        crypto.Signer
 	publicJWK  jwk.Key
 	privateJWK jwk.Key
-	logger     *logrus.Logger
 }
 
-func New(logger *logrus.Logger) Service {
+type service struct {
+	// algorithm is the algorithm of newly generated keys
+	algorithm jwa.SignatureAlgorithm
+
+	// retention is how long a retired key continues to be published
+	// and should be at least as long as the lifetime of a token
+	retention time.Duration
+	logger    *logrus.Logger
+
+	mx       sync.RWMutex
+	keys     []*ringKey
+	active   *ringKey
+	modified time.Time
+
+	// generated is set when LoadKeys generated a new active key
+	generated bool
+}
+
+func New(logger *logrus.Logger, algorithm jwa.SignatureAlgorithm, retention time.Duration) Service {
 	s := &service{
-		logger: logger,
+		logger:    logger,
+		algorithm: algorithm,
+		retention: retention,
 	}
+
+	if !validAlgorithm(algorithm) {
+		s.logger.WithField("alg", algorithm).Fatal("unsupported signing algorithm")
+	}
+
 	err := s.LoadKeys()
 	if err != nil {
 		s.logger.WithError(err).Fatal("failed to load keys")
@@ -61,37 +109,117 @@ func New(logger *logrus.Logger) Service {
 
 }
 
+func validAlgorithm(algorithm jwa.SignatureAlgorithm) bool {
+	for _, v := range SupportedAlgorithms {
+		if v == algorithm {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LoadKeys loads the key ring from disk, creating the ring if it does not exist yet.
+// Deployments that predate the key ring have their existing key imported as the first key of the ring
 func (s *service) LoadKeys() error {
 
-	_, privateErr := os.Stat(privatePEMFileName)
-	_, publicErr := os.Stat(publicPEMFileName)
+	if _, err := os.Stat(ringFileName); os.IsNotExist(err) {
+		err = s.initializeRing()
+		if err != nil {
+			return fmt.Errorf("failed to initialize key ring: %w", err)
+		}
+	}
+
+	if err := s.loadKeys(); err != nil {
+		return fmt.Errorf("failed to load keys: %w", err)
+	}
+
+	// The configured algorithm has changed since the active key was generated,
+	// rotate so that new tokens are signed with a key of the configured algorithm
+	if s.GetSigningAlgorithm() != s.algorithm {
+		s.logger.WithField("alg", s.algorithm).Info("active key does not match configured algorithm, rotating keys")
 
-	// Keys exist on disk, load them into memory
-	if privateErr == nil && publicErr == nil {
-		if err := s.loadKeys(); err != nil {
-			return fmt.Errorf("failed to load keys: %w", err)
+		err := s.Rotate()
+		if err != nil {
+			return err
 		}
-		return nil
+
+		s.generated = true
 	}
 
-	err := s.generateKeys()
+	return nil
+
+}
+
+func (s *service) Generated() bool {
+	return s.generated
+}
+
+// GetSigningAlgorithm returns the algorithm of the active key
+func (s *service) GetSigningAlgorithm() jwa.SignatureAlgorithm {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return s.active.Algorithm
+}
+
+// Rotate generates a new active key and retires the current active key. Retired keys
+// whose retention has elapsed are removed from the ring and from disk
+func (s *service) Rotate() error {
+
+	ring, err := readRing()
 	if err != nil {
-		return fmt.Errorf("failed to load keys: %w", err)
+		return err
 	}
 
-	err = s.loadKeys()
+	now := time.Now().In(time.UTC)
+	for _, m := range ring {
+		if m.RetiredAt == nil {
+			m.RetiredAt = &now
+		}
+	}
+
+	entry, err := generateKey(s.algorithm)
 	if err != nil {
-		return fmt.Errorf("failed to load keys: %w", err)
+		return err
 	}
 
-	return nil
+	kept := []*metadata{entry}
+	for _, m := range ring {
+		if now.Sub(*m.RetiredAt) > s.retention {
+			err = os.Remove(filepath.Join(folder, m.File))
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove expired key %s: %w", m.KeyID, err)
+			}
+			continue
+		}
+		kept = append(kept, m)
+	}
+
+	err = writeRing(kept)
+	if err != nil {
+		return err
+	}
+
+	return s.loadKeys()
 
 }
 
+// GetPublicJWKS returns the public keys of every key in the ring that may have signed a token that has not expired yet
 func (s *service) GetPublicJWKS() Set {
+	s.reloadIfModified()
+
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
 	var jwks Set
-	jwks.Keys = make([]jwk.Key, 1)
-	jwks.Keys[0] = s.publicJWK
+	jwks.Keys = make([]jwk.Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		if k.RetiredAt != nil && time.Since(*k.RetiredAt) > s.retention {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, k.publicJWK)
+	}
 
 	return jwks
 
@@ -109,191 +237,353 @@ func (s *service) GetPublicJWKSBytes() ([]byte, error) {
 
 }
 
+// GetPublicJWK returns the public key of the active key
 func (s *service) GetPublicJWK() jwk.Key {
-	return s.publicJWK
+	s.reloadIfModified()
+
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return s.active.publicJWK
 }
 
+// GetPrivateJWK returns the private key of the active key
 func (s *service) GetPrivateJWK() jwk.Key {
-	return s.privateJWK
+	s.reloadIfModified()
+
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return s.active.privateJWK
 }
 
 func (s *service) GetPrivateJWKS() []jwk.Key {
-	var jwks Set
-	jwks.Keys = make([]jwk.Key, 1)
-	jwks.Keys[0] = s.privateJWK
+	s.reloadIfModified()
 
-	return jwks.Keys
-}
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	keys := make([]jwk.Key, len(s.keys))
+	for i, k := range s.keys {
+		keys[i] = k.privateJWK
+	}
 
-func (s *service) GetPrivateKey() *rsa.PrivateKey {
-	return s.key
+	return keys
 }
 
-func (s *service) GetPublicKey() rsa.PublicKey {
-	return s.key.PublicKey
+// reloadIfModified reloads the ring when it has been changed on disk,
+// allowing a running server to pick up a key that was rotated by another process
+func (s *service) reloadIfModified() {
+
+	info, err := os.Stat(ringFileName)
+	if err != nil {
+		return
+	}
+
+	s.mx.RLock()
+	modified := s.modified
+	s.mx.RUnlock()
+
+	if !info.ModTime().After(modified) {
+		return
+	}
+
+	err = s.loadKeys()
+	if err != nil {
+		s.logger.WithError(err).Error("failed to reload key ring, continuing with previously loaded keys")
+	}
+
 }
 
 func (s *service) loadKeys() error {
 
-	if s.key != nil {
-		err := s.setPublicJWKFromKey()
+	info, err := os.Stat(ringFileName)
+	if err != nil {
+		return fmt.Errorf("unable to stat key ring: %w", err)
+	}
+
+	ring, err := readRing()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*ringKey, 0, len(ring))
+	var active *ringKey
+	for _, m := range ring {
+		privateKey, err := readPrivateKey(filepath.Join(folder, m.File))
+		if err != nil {
+			return fmt.Errorf("failed to load key %s: %w", m.KeyID, err)
+		}
+
+		// Rings written before algorithms were configurable only contain RSA keys
+		if m.Algorithm == "" {
+			m.Algorithm = jwa.RS256
+		}
+
+		k := &ringKey{metadata: *m, key: privateKey}
+
+		k.publicJWK, err = buildJWK(privateKey.Public(), m.KeyID, m.Algorithm)
 		if err != nil {
 			return err
 		}
 
-		err = s.setPrivateJWKFromKey()
+		k.privateJWK, err = buildJWK(privateKey, m.KeyID, m.Algorithm)
 		if err != nil {
 			return err
 		}
+
+		keys = append(keys, k)
+
+		if k.RetiredAt == nil && (active == nil || k.CreatedAt.After(active.CreatedAt)) {
+			active = k
+		}
 	}
 
-	keyFile, err := os.OpenFile(privatePEMFileName, os.O_RDONLY, 0400)
-	if err != nil {
-		return fmt.Errorf("unable open private key file: %w", err)
+	if active == nil {
+		return fmt.Errorf("key ring does not contain an active key")
 	}
 
-	privateBytes, err := ioutil.ReadAll(keyFile)
-	if err != nil {
-		return fmt.Errorf("unable to read private key data: %w", err)
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.keys = keys
+	s.active = active
+	s.modified = info.ModTime()
+
+	return nil
+
+}
+
+// initializeRing creates the key ring, importing the key of a deployment
+// that predates the key ring or generating a fresh key otherwise
+func (s *service) initializeRing() error {
+
+	if _, err := os.Stat(folder); os.IsNotExist(err) {
+		err = os.MkdirAll(folder, 0755)
+		if err != nil {
+			return fmt.Errorf("failed to create %s dir for keys: %w", folder, err)
+		}
 	}
 
-	priPem, _ := pem.Decode(privateBytes)
+	if _, err := os.Stat(privatePEMFileName); err == nil {
+		privateKey, err := readPrivateKey(privatePEMFileName)
+		if err != nil {
+			return fmt.Errorf("failed to import existing key: %w", err)
+		}
 
-	privateKey, err := x509.ParsePKCS1PrivateKey(priPem.Bytes)
-	if err != nil {
-		return fmt.Errorf("unable to parse private key data: %w", err)
+		kid, err := keyID(privateKey)
+		if err != nil {
+			return err
+		}
+
+		s.logger.WithField("kid", kid).Info("importing existing key into key ring")
+
+		return writeRing([]*metadata{{
+			KeyID:     kid,
+			Algorithm: jwa.RS256,
+			File:      legacyPEMFileName,
+			CreatedAt: time.Now().In(time.UTC),
+		}})
 	}
 
-	s.key = privateKey
-	err = s.setPublicJWKFromKey()
+	entry, err := generateKey(s.algorithm)
 	if err != nil {
 		return err
 	}
 
-	err = s.setPrivateJWKFromKey()
+	err = writeRing([]*metadata{entry})
 	if err != nil {
 		return err
 	}
-	return err
+
+	s.generated = true
+
+	return nil
+
 }
 
-func (s *service) setPublicJWKFromKey() error {
+func readRing() ([]*metadata, error) {
 
-	set, err := jwk.New(s.key.PublicKey)
+	data, err := ioutil.ReadFile(ringFileName)
 	if err != nil {
-		return fmt.Errorf("failed to create jwk from public key: %w", err)
+		return nil, fmt.Errorf("unable to read key ring: %w", err)
 	}
 
-	err = jwk.AssignKeyID(set)
+	var ring = make([]*metadata, 0)
+	err = json.Unmarshal(data, &ring)
 	if err != nil {
-		return fmt.Errorf("failed to assign key id to jwk: %w", err)
+		return nil, fmt.Errorf("unable to decode key ring: %w", err)
 	}
 
-	err = set.Set("alg", "RS256")
+	return ring, nil
+
+}
+
+// writeRing writes the ring to a temporary file and renames it over
+// the ring so that readers never observe a partially written ring
+func writeRing(ring []*metadata) error {
+
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].CreatedAt.After(ring[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(ring, "", "    ")
 	if err != nil {
-		return fmt.Errorf("failed to set alg on jwk: %w", err)
+		return fmt.Errorf("failed to encode key ring: %w", err)
 	}
 
-	err = set.Set("use", "sig")
+	tmp := ringFileName + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
 	if err != nil {
-		return fmt.Errorf("failed to set use on jwk: %w", err)
+		return fmt.Errorf("failed to write key ring: %w", err)
 	}
 
-	s.publicJWK = set
+	err = os.Rename(tmp, ringFileName)
+	if err != nil {
+		return fmt.Errorf("failed to replace key ring: %w", err)
+	}
 
 	return nil
 
 }
 
-func (s *service) setPrivateJWKFromKey() error {
+// readPrivateKey reads a PKCS8 encoded private key, falling back
+// to PKCS1 for RSA keys that were written by earlier releases
+func readPrivateKey(file string) (crypto.Signer, error) {
 
-	set, err := jwk.New(s.key)
+	privateBytes, err := ioutil.ReadFile(file)
 	if err != nil {
-		return fmt.Errorf("failed to create jwk from private key: %w", err)
+		return nil, fmt.Errorf("unable to read private key data: %w", err)
 	}
 
-	err = jwk.AssignKeyID(set)
-	if err != nil {
-		return fmt.Errorf("failed to assign key id to jwk: %w", err)
+	priPem, _ := pem.Decode(privateBytes)
+	if priPem == nil {
+		return nil, fmt.Errorf("unable to decode private key pem")
 	}
 
-	err = set.Set("alg", "RS256")
-	if err != nil {
-		return fmt.Errorf("failed to set alg on jwk: %w", err)
+	if priPem.Type == "RSA PRIVATE KEY" {
+		privateKey, err := x509.ParsePKCS1PrivateKey(priPem.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse private key data: %w", err)
+		}
+
+		return privateKey, nil
 	}
 
-	err = set.Set("use", "sig")
+	privateKey, err := x509.ParsePKCS8PrivateKey(priPem.Bytes)
 	if err != nil {
-		return fmt.Errorf("failed to set use on jwk: %w", err)
+		return nil, fmt.Errorf("unable to parse private key data: %w", err)
 	}
 
-	s.privateJWK = set
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
 
-	return nil
+	return signer, nil
 
 }
 
-// Generate Keys removes any trace of existing keys and generates
-// a fresh RSA Key pair. This is a very destructive function
-// and is only called if public or private key is missing
-// when the service is initialized
-func (s *service) generateKeys() error {
+func generatePrivateKey(algorithm jwa.SignatureAlgorithm) (crypto.Signer, error) {
 
-	if _, err := os.Stat(folder); os.IsNotExist(err) {
-		err = os.Mkdir(folder, 0755)
-		if err != nil {
-			return fmt.Errorf("failed to create %s dir for rsa keys: %w", folder, err)
-		}
+	switch algorithm {
+	case jwa.RS256:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case jwa.ES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwa.EdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
 	}
 
-	_, privateErr := os.Stat(privatePEMFileName)
-	_, publicErr := os.Stat(publicPEMFileName)
+	return nil, fmt.Errorf("unsupported signing algorithm %s", algorithm)
+
+}
+
+// generateKey generates a fresh key for the algorithm, writes it to disk as PKCS8, and returns its metadata
+func generateKey(algorithm jwa.SignatureAlgorithm) (*metadata, error) {
 
-	if privateErr == nil {
-		os.RemoveAll(privatePEMFileName)
+	private, err := generatePrivateKey(algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key pair: %w", err)
 	}
 
-	if publicErr == nil {
-		os.RemoveAll(publicPEMFileName)
+	kid, err := keyID(private)
+	if err != nil {
+		return nil, err
 	}
 
-	private, err := rsa.GenerateKey(rand.Reader, 4096)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
 	if err != nil {
-		return fmt.Errorf("failed to generate private key pair: %w", err)
+		return nil, fmt.Errorf("failed to marshal private key: %w", err)
 	}
 
-	// dump private key to file
 	privateBlock := &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(private),
+		Type:  "PRIVATE KEY",
+		Bytes: der,
 	}
 
-	privatePem, err := os.Create(privatePEMFileName)
+	file := fmt.Sprintf("%s.pem", kid)
+
+	privatePem, err := os.OpenFile(filepath.Join(folder, file), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
 	if err != nil {
-		return fmt.Errorf("failed to create private key pem file: %w", err)
+		return nil, fmt.Errorf("failed to create private key pem file: %w", err)
 	}
+	defer privatePem.Close()
 
 	err = pem.Encode(privatePem, privateBlock)
 	if err != nil {
-		return fmt.Errorf("failed to encode private Key and store in pem file: %w", err)
+		return nil, fmt.Errorf("failed to encode private Key and store in pem file: %w", err)
 	}
 
-	// dump the public key to file
-	publicBlock := &pem.Block{
-		Type:  "RSA PUBLIC KEY",
-		Bytes: x509.MarshalPKCS1PublicKey(&private.PublicKey),
+	return &metadata{
+		KeyID:     kid,
+		Algorithm: algorithm,
+		File:      file,
+		CreatedAt: time.Now().In(time.UTC),
+	}, nil
+
+}
+
+// keyID derives the id of a key from the thumbprint of its jwk
+func keyID(key interface{}) (string, error) {
+
+	set, err := jwk.New(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create jwk from key: %w", err)
+	}
+
+	err = jwk.AssignKeyID(set)
+	if err != nil {
+		return "", fmt.Errorf("failed to assign key id to jwk: %w", err)
+	}
+
+	return set.KeyID(), nil
+
+}
+
+func buildJWK(key interface{}, kid string, algorithm jwa.SignatureAlgorithm) (jwk.Key, error) {
+
+	set, err := jwk.New(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create jwk from key: %w", err)
 	}
 
-	publicPem, err := os.Create(publicPEMFileName)
+	err = set.Set(jwk.KeyIDKey, kid)
 	if err != nil {
-		return fmt.Errorf("failed to create pem file for public key: %w", err)
+		return nil, fmt.Errorf("failed to set kid on jwk: %w", err)
 	}
 
-	err = pem.Encode(publicPem, publicBlock)
+	err = set.Set("alg", algorithm.String())
 	if err != nil {
-		return fmt.Errorf("failed to encode publie key and store in pem file: %w", err)
+		return nil, fmt.Errorf("failed to set alg on jwk: %w", err)
+	}
 
+	err = set.Set("use", "sig")
+	if err != nil {
+		return nil, fmt.Errorf("failed to set use on jwk: %w", err)
 	}
 
-	return nil
+	return set, nil
+
 }
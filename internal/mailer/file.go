@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fileMailer struct {
+	folder string
+	from   string
+}
+
+// NewFile returns a Mailer that writes every message to a .eml file in folder
+// instead of delivering it. It is intended for development environments
+func NewFile(folder, from string) Mailer {
+	return &fileMailer{
+		folder: folder,
+		from:   from,
+	}
+}
+
+func (m *fileMailer) Send(ctx context.Context, message *Message) error {
+
+	err := message.VerifyAttributes()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(m.folder, 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create mail folder: %w", err)
+	}
+
+	file := filepath.Join(m.folder, fmt.Sprintf("%d.eml", time.Now().UnixNano()))
+
+	err = ioutil.WriteFile(file, message.bytes(m.from), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write message to %s: %w", file, err)
+	}
+
+	return nil
+
+}
@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory is a Mailer that keeps every message it is asked to send. It is intended for tests
+type Memory struct {
+	mx       sync.Mutex
+	messages []*Message
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Send(ctx context.Context, message *Message) error {
+
+	err := message.VerifyAttributes()
+	if err != nil {
+		return err
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.messages = append(m.messages, message)
+
+	return nil
+
+}
+
+// Messages returns the messages that have been sent so far
+func (m *Memory) Messages() []*Message {
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	messages := make([]*Message, len(m.messages))
+	copy(messages, m.messages)
+
+	return messages
+
+}
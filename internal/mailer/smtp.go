@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+)
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTP returns a Mailer that delivers messages through an SMTP server. PLAIN
+// authentication is used when a username is provided, which net/smtp only
+// permits over TLS or to localhost
+func NewSMTP(host string, port uint, username, password, from string) Mailer {
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &smtpMailer{
+		addr: fmt.Sprintf("%s:%d", host, port),
+		auth: auth,
+		from: from,
+	}
+
+}
+
+func (m *smtpMailer) Send(ctx context.Context, message *Message) error {
+
+	err := message.VerifyAttributes()
+	if err != nil {
+		return err
+	}
+
+	err = smtp.SendMail(m.addr, m.auth, m.from, []string{message.To}, message.bytes(m.from))
+	if err != nil {
+		return fmt.Errorf("failed to send message to %s: %w", message.To, err)
+	}
+
+	return nil
+
+}
@@ -0,0 +1,144 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/embersyndicate/support"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type attachmentRepository struct {
+	attachments *mongo.Collection
+}
+
+func NewAttachmentRepository(d *mongo.Database) (support.AttachmentRepository, error) {
+
+	a := d.Collection("attachments")
+
+	_, err := a.Indexes().CreateMany(
+		context.TODO(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{
+					bson.E{Key: "ticketID", Value: 1},
+					bson.E{Key: "createdAt", Value: 1},
+				},
+				Options: &options.IndexOptions{
+					Name: newString("ticketAttachments"),
+				},
+			},
+			{
+				Keys: bson.D{
+					bson.E{Key: "uploadedBy", Value: 1},
+					bson.E{Key: "sha256", Value: 1},
+				},
+				Options: &options.IndexOptions{
+					Name: newString("uploadedAttachments"),
+				},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachmentRepository{
+		attachments: a,
+	}, nil
+
+}
+
+func (r *attachmentRepository) Attachment(ctx context.Context, id string) (*support.Attachment, error) {
+
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to cast %s to ObjectID", id)
+	}
+
+	attachments, err := r.Attachments(ctx, support.NewEqualOperator("_id", _id), support.NewLimitOperator(1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(attachments) == 0 {
+		return nil, fmt.Errorf("attachment does not exist")
+	}
+
+	return attachments[0], nil
+
+}
+
+func (r *attachmentRepository) Attachments(ctx context.Context, operators ...*support.Operator) ([]*support.Attachment, error) {
+
+	var attachments = make([]*support.Attachment, 0)
+
+	filters, err := BuildFilters(operators...)
+	if err != nil {
+		return attachments, err
+	}
+
+	options, err := BuildFindOptions(operators...)
+	if err != nil {
+		return attachments, err
+	}
+
+	result, err := r.attachments.Find(ctx, filters, options)
+	if err != nil {
+		return attachments, err
+	}
+
+	err = result.All(ctx, &attachments)
+
+	return attachments, err
+
+}
+
+func (r *attachmentRepository) CreateAttachment(ctx context.Context, attachment *support.Attachment) (*support.Attachment, error) {
+
+	result, err := r.attachments.InsertOne(ctx, attachment)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment.ID = result.InsertedID.(primitive.ObjectID)
+
+	return attachment, err
+
+}
+
+func (r *attachmentRepository) BindAttachments(ctx context.Context, ticketID primitive.ObjectID, ids ...primitive.ObjectID) error {
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// The same attachment may be the value of several fields
+	unique := make(map[primitive.ObjectID]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+
+	filter := primitive.D{
+		primitive.E{Key: "_id", Value: primitive.D{primitive.E{Key: "$in", Value: ids}}},
+		primitive.E{Key: "ticketID", Value: primitive.D{primitive.E{Key: "$exists", Value: false}}},
+	}
+
+	update := primitive.D{primitive.E{Key: "$set", Value: primitive.D{primitive.E{Key: "ticketID", Value: ticketID}}}}
+
+	result, err := r.attachments.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	// An attachment that is no longer pending was attached to another ticket after it was validated
+	if result.ModifiedCount != int64(len(unique)) {
+		return fmt.Errorf("%d of %d attachments were no longer pending", int64(len(unique))-result.ModifiedCount, len(unique))
+	}
+
+	return nil
+
+}
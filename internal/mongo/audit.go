@@ -0,0 +1,107 @@
+package mongo
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/embersyndicate/support"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type auditRepository struct {
+	events *mongo.Collection
+}
+
+func NewAuditRepository(d *mongo.Database) (support.AuditRepository, error) {
+
+	// The values of a change are free form, so embedded documents are decoded into maps
+	// rather than the default primitive.D, which does not serialize into a json object
+	registry := bson.NewRegistryBuilder().
+		RegisterTypeMapEntry(bsontype.EmbeddedDocument, reflect.TypeOf(bson.M{})).
+		Build()
+
+	e := d.Collection("auditEvents", options.Collection().SetRegistry(registry))
+
+	_, err := e.Indexes().CreateMany(
+		context.TODO(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.D{
+					bson.E{Key: "entityID", Value: 1},
+					bson.E{Key: "createdAt", Value: 1},
+				},
+				Options: &options.IndexOptions{
+					Name: newString("auditEntity"),
+				},
+			},
+			{
+				Keys: bson.D{
+					bson.E{Key: "parentID", Value: 1},
+					bson.E{Key: "createdAt", Value: 1},
+				},
+				Options: &options.IndexOptions{
+					Name:   newString("auditParent"),
+					Sparse: newBool(true),
+				},
+			},
+			{
+				Keys: bson.D{
+					bson.E{Key: "createdAt", Value: -1},
+				},
+				Options: &options.IndexOptions{
+					Name: newString("auditCreatedAt"),
+				},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auditRepository{
+		events: e,
+	}, nil
+
+}
+
+func (r *auditRepository) AuditEvents(ctx context.Context, operators ...*support.Operator) ([]*support.AuditEvent, error) {
+
+	var events = make([]*support.AuditEvent, 0)
+
+	filters, err := BuildFilters(operators...)
+	if err != nil {
+		return events, err
+	}
+
+	options, err := BuildFindOptions(operators...)
+	if err != nil {
+		return events, err
+	}
+
+	result, err := r.events.Find(ctx, filters, options)
+	if err != nil {
+		return events, err
+	}
+
+	err = result.All(ctx, &events)
+
+	return events, err
+
+}
+
+func (r *auditRepository) CreateAuditEvent(ctx context.Context, event *support.AuditEvent) (*support.AuditEvent, error) {
+
+	result, err := r.events.InsertOne(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+
+	event.ID = result.InsertedID.(primitive.ObjectID)
+
+	return event, err
+
+}
@@ -42,10 +42,18 @@ func (r *categoryRepository) Category(ctx context.Context, id string) (*support.
 }
 
 func (r *categoryRepository) Categories(ctx context.Context, operators ...*support.Operator) ([]*support.Category, error) {
-	filters := BuildFilters(operators...)
-	options := BuildFindOptions(operators...)
-
 	var categories = make([]*support.Category, 0)
+
+	filters, err := BuildFilters(operators...)
+	if err != nil {
+		return categories, err
+	}
+
+	options, err := BuildFindOptions(operators...)
+	if err != nil {
+		return categories, err
+	}
+
 	result, err := r.categories.Find(ctx, filters, options)
 	if err != nil {
 		return categories, err
@@ -83,3 +91,23 @@ func (r *categoryRepository) UpdateCategory(ctx context.Context, id string, cate
 
 	return category, err
 }
+
+func (r *categoryRepository) DeleteCategory(ctx context.Context, id string) error {
+
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("unable to cast %s to ObjectID", id)
+	}
+
+	result, err := r.categories.DeleteOne(ctx, primitive.D{primitive.E{Key: "_id", Value: _id}})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("category does not exist")
+	}
+
+	return nil
+
+}
@@ -0,0 +1,137 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/embersyndicate/support"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type commentRepository struct {
+	comments *mongo.Collection
+}
+
+func NewCommentRepository(d *mongo.Database) (support.CommentRepository, error) {
+
+	c := d.Collection("comments")
+
+	_, err := c.Indexes().CreateOne(
+		context.TODO(),
+		mongo.IndexModel{
+			Keys: bson.D{
+				bson.E{Key: "ticketID", Value: 1},
+				bson.E{Key: "createdAt", Value: 1},
+			},
+			Options: &options.IndexOptions{
+				Name: newString("ticketComments"),
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &commentRepository{
+		comments: c,
+	}, nil
+
+}
+
+func (r *commentRepository) Comment(ctx context.Context, id string) (*support.Comment, error) {
+
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to cast %s to ObjectID", id)
+	}
+
+	comments, err := r.Comments(ctx, support.NewEqualOperator("_id", _id), support.NewLimitOperator(1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(comments) == 0 {
+		return nil, fmt.Errorf("comment does not exist")
+	}
+
+	return comments[0], nil
+
+}
+
+func (r *commentRepository) Comments(ctx context.Context, operators ...*support.Operator) ([]*support.Comment, error) {
+
+	var comments = make([]*support.Comment, 0)
+
+	filters, err := BuildFilters(operators...)
+	if err != nil {
+		return comments, err
+	}
+
+	options, err := BuildFindOptions(operators...)
+	if err != nil {
+		return comments, err
+	}
+
+	result, err := r.comments.Find(ctx, filters, options)
+	if err != nil {
+		return comments, err
+	}
+
+	err = result.All(ctx, &comments)
+
+	return comments, err
+
+}
+
+func (r *commentRepository) CreateComment(ctx context.Context, comment *support.Comment) (*support.Comment, error) {
+
+	result, err := r.comments.InsertOne(ctx, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	comment.ID = result.InsertedID.(primitive.ObjectID)
+
+	return comment, err
+
+}
+
+func (r *commentRepository) UpdateComment(ctx context.Context, id string, comment *support.Comment) (*support.Comment, error) {
+
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to cast %s to ObjectID", id)
+	}
+
+	comment.ID = _id
+
+	update := primitive.D{primitive.E{Key: "$set", Value: comment}}
+
+	_, err = r.comments.UpdateOne(ctx, primitive.D{primitive.E{Key: "_id", Value: _id}}, update)
+
+	return comment, err
+
+}
+
+func (r *commentRepository) DeleteComment(ctx context.Context, id string) error {
+
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("unable to cast %s to ObjectID", id)
+	}
+
+	result, err := r.comments.DeleteOne(ctx, primitive.D{primitive.E{Key: "_id", Value: _id}})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("comment does not exist")
+	}
+
+	return nil
+
+}
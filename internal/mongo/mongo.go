@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"reflect"
+	"regexp"
 
 	"github.com/embersyndicate/support"
 	"github.com/newrelic/go-agent/_integrations/nrmongo"
@@ -48,108 +49,240 @@ const (
 	and              string = "$and"
 	or               string = "$or"
 	exists           string = "$exists"
+	regex            string = "$regex"
+	regexOptions     string = "$options"
+	size             string = "$size"
+	elemMatch        string = "$elemMatch"
 )
 
-func BuildFilters(operators ...*support.Operator) primitive.D {
+// comparisons maps the operations that compare a column to a single value to their mongo operator
+var comparisons = map[support.Operation]string{
+	support.EqualOp:              equal,
+	support.NotEqualOp:           notequal,
+	support.GreaterThanOp:        greaterthan,
+	support.GreaterThanEqualToOp: greaterthanequal,
+	support.LessThanOp:           lessthan,
+	support.LessThanEqualToOp:    lessthanequal,
+}
+
+// BuildFilters converts the provided operators into a mongo filter document.
+// Operators that are consumed by BuildFindOptions are ignored, any other operation
+// that cannot be represented, or whose value is not of the type the operation expects,
+// results in an error rather than a partial filter
+func BuildFilters(operators ...*support.Operator) (primitive.D, error) {
 
 	var ops = make(primitive.D, 0)
 	for _, a := range operators {
+		if a == nil {
+			return nil, fmt.Errorf("nil operator supplied")
+		}
+
 		switch a.Operation {
-		case support.EqualOp:
-			ops = append(ops, primitive.E{Key: a.Column, Value: primitive.D{primitive.E{Key: equal, Value: a.Value}}})
-		case support.NotEqualOp:
-			ops = append(ops, primitive.E{Key: a.Column, Value: primitive.D{primitive.E{Key: notequal, Value: a.Value}}})
-		case support.GreaterThanOp:
-			ops = append(ops, primitive.E{Key: a.Column, Value: primitive.D{primitive.E{Key: greaterthan, Value: a.Value}}})
-		case support.GreaterThanEqualToOp:
-			ops = append(ops, primitive.E{Key: a.Column, Value: primitive.D{primitive.E{Key: greaterthanequal, Value: a.Value}}})
-		case support.LessThanOp:
-			ops = append(ops, primitive.E{Key: a.Column, Value: primitive.D{primitive.E{Key: lessthan, Value: a.Value}}})
-		case support.LessThanEqualToOp:
-			ops = append(ops, primitive.E{Key: a.Column, Value: primitive.D{primitive.E{Key: lessthanequal, Value: a.Value}}})
+		case support.EqualOp, support.NotEqualOp,
+			support.GreaterThanOp, support.GreaterThanEqualToOp,
+			support.LessThanOp, support.LessThanEqualToOp:
+			if a.Column == "" {
+				return nil, fmt.Errorf("operation %s requires a column", a.Operation)
+			}
+
+			ops = append(ops, primitive.E{Key: a.Column, Value: primitive.D{primitive.E{Key: comparisons[a.Operation], Value: a.Value}}})
 		case support.ExistsOp:
-			ops = append(ops, primitive.E{Key: a.Column, Value: primitive.D{primitive.E{Key: exists, Value: a.Value.(bool)}}})
-		case support.OrOp:
-			switch o := a.Value.(type) {
-			case []*support.Operator:
-				arr := make(primitive.A, 0)
-
-				for _, op := range o {
-					arr = append(arr, BuildFilters(op))
-				}
-
-				ops = append(ops, primitive.E{Key: or, Value: arr})
-			default:
-				panic(fmt.Sprintf("invalid type %#T supplied, expected one of []*support.Operator", o))
-			}
-
-		case support.AndOp:
-			switch o := a.Value.(type) {
-			case []*support.Operator:
-				arr := make(primitive.A, 0)
-				for _, op := range o {
-					arr = append(arr, BuildFilters(op))
-				}
-
-				ops = append(ops, primitive.E{Key: and, Value: arr})
-			default:
-				panic(fmt.Sprintf("invalid type %#T supplied, expected one of []*support.Operator", o))
-			}
-
-		case support.InOp:
-			v := reflect.ValueOf(a.Value)
-			switch v.Kind() {
-			case reflect.Slice, reflect.Array:
-				arr := make(primitive.A, v.Len())
-				for i := 0; i < v.Len(); i++ {
-					if !v.Index(i).IsValid() {
-						continue
-					}
-					arr = append(arr, v.Index(i).Interface())
-				}
-
-				ops = append(ops, primitive.E{Key: a.Column, Value: primitive.D{primitive.E{Key: in, Value: arr}}})
-			default:
-				panic(fmt.Sprintf("invalid type %#T supplied, expected one of []*support.OpValue", a.Value))
-			}
-
-		case support.NotInOp:
-			v := reflect.ValueOf(a.Value)
-			switch v.Kind() {
-			case reflect.Slice, reflect.Array:
-				arr := make(primitive.A, v.Len())
-				for i := 0; i < v.Len(); i++ {
-					if !v.Index(i).IsValid() {
-						continue
-					}
-					arr = append(arr, v.Index(i).Interface())
-				}
-
-				ops = append(ops, primitive.E{Key: a.Column, Value: primitive.D{primitive.E{Key: notin, Value: arr}}})
-			default:
-				panic(fmt.Sprintf("invalid type %#T supplied, expected one of []*support.OpValue", a.Value))
+			b, ok := a.Value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("invalid type %T supplied for %s on %s, expected bool", a.Value, a.Operation, a.Column)
+			}
+
+			ops = append(ops, primitive.E{Key: a.Column, Value: primitive.D{primitive.E{Key: exists, Value: b}}})
+		case support.OrOp, support.AndOp:
+			group, err := buildGroup(a)
+			if err != nil {
+				return nil, err
+			}
+
+			key := and
+			if a.Operation == support.OrOp {
+				key = or
+			}
+
+			ops = append(ops, primitive.E{Key: key, Value: group})
+		case support.InOp, support.NotInOp:
+			arr, err := buildArray(a)
+			if err != nil {
+				return nil, err
+			}
+
+			key := in
+			if a.Operation == support.NotInOp {
+				key = notin
+			}
+
+			ops = append(ops, primitive.E{Key: a.Column, Value: primitive.D{primitive.E{Key: key, Value: arr}}})
+		case support.RegexOp, support.InsensitiveRegexOp, support.PrefixOp, support.EqualFoldOp:
+			pattern, ok := a.Value.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid type %T supplied for %s on %s, expected string", a.Value, a.Operation, a.Column)
+			}
+
+			if a.Operation == support.PrefixOp {
+				pattern = "^" + regexp.QuoteMeta(pattern)
+			}
+
+			if a.Operation == support.EqualFoldOp {
+				pattern = "^" + regexp.QuoteMeta(pattern) + "$"
+			}
+
+			// Patterns are restricted to the RE2 syntax understood by Go so that
+			// malformed patterns are rejected before they are sent to mongo
+			if _, err := regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid pattern supplied for %s on %s: %w", a.Operation, a.Column, err)
+			}
+
+			expr := primitive.D{primitive.E{Key: regex, Value: pattern}}
+			if a.Operation == support.InsensitiveRegexOp || a.Operation == support.EqualFoldOp {
+				expr = append(expr, primitive.E{Key: regexOptions, Value: "i"})
+			}
+
+			ops = append(ops, primitive.E{Key: a.Column, Value: expr})
+		case support.SizeOp:
+			n, err := toInt64(a.Value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid value %v supplied for %s on %s, expected a non-negative integer", a.Value, a.Operation, a.Column)
 			}
+
+			ops = append(ops, primitive.E{Key: a.Column, Value: primitive.D{primitive.E{Key: size, Value: n}}})
+		case support.ElemMatchOp:
+			o, ok := a.Value.([]*support.Operator)
+			if !ok || len(o) == 0 {
+				return nil, fmt.Errorf("invalid type %T supplied for %s on %s, expected a non empty []*support.Operator", a.Value, a.Operation, a.Column)
+			}
+
+			match, err := BuildFilters(o...)
+			if err != nil {
+				return nil, err
+			}
+
+			ops = append(ops, primitive.E{Key: a.Column, Value: primitive.D{primitive.E{Key: elemMatch, Value: match}}})
+		case support.LimitOp, support.SkipOp, support.OrderOp:
+			// Handled by BuildFindOptions
+		default:
+			return nil, fmt.Errorf("unsupported operation %q supplied", a.Operation)
 		}
 	}
 
-	return ops
+	return ops, nil
 
 }
 
-func BuildFindOptions(ops ...*support.Operator) *options.FindOptions {
+// buildGroup builds one filter document per operator of an or/and operator.
+// Groups may be nested to any depth
+func buildGroup(a *support.Operator) (primitive.A, error) {
+
+	o, ok := a.Value.([]*support.Operator)
+	if !ok {
+		return nil, fmt.Errorf("invalid type %T supplied for %s, expected []*support.Operator", a.Value, a.Operation)
+	}
+
+	if len(o) == 0 {
+		return nil, fmt.Errorf("%s requires at least one operator", a.Operation)
+	}
+
+	arr := make(primitive.A, 0, len(o))
+	for _, op := range o {
+		filter, err := BuildFilters(op)
+		if err != nil {
+			return nil, err
+		}
+
+		arr = append(arr, filter)
+	}
+
+	return arr, nil
+
+}
+
+func buildArray(a *support.Operator) (primitive.A, error) {
+
+	v := reflect.ValueOf(a.Value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+	default:
+		return nil, fmt.Errorf("invalid type %T supplied for %s on %s, expected a slice or array", a.Value, a.Operation, a.Column)
+	}
+
+	arr := make(primitive.A, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if !v.Index(i).IsValid() {
+			continue
+		}
+		arr = append(arr, v.Index(i).Interface())
+	}
+
+	return arr, nil
+
+}
+
+// BuildFindOptions converts the limit, skip and order operators into find options.
+// Multiple order operators are applied in the order they are supplied
+func BuildFindOptions(ops ...*support.Operator) (*options.FindOptions, error) {
 	var opts = options.Find()
+	var sort = make(primitive.D, 0)
 	for _, a := range ops {
+		if a == nil {
+			return nil, fmt.Errorf("nil operator supplied")
+		}
+
 		switch a.Operation {
 		case support.LimitOp:
-			opts.SetLimit(a.Value.(int64))
+			n, err := toInt64(a.Value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid value %v supplied for %s, expected a non-negative integer", a.Value, a.Operation)
+			}
+			opts.SetLimit(n)
 		case support.SkipOp:
-			opts.SetSkip(a.Value.(int64))
+			n, err := toInt64(a.Value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid value %v supplied for %s, expected a non-negative integer", a.Value, a.Operation)
+			}
+			opts.SetSkip(n)
 		case support.OrderOp:
-			opts.SetSort(primitive.D{primitive.E{Key: a.Column, Value: a.Value}})
+			n, err := toInt64(a.Value)
+			if err != nil || !support.Sort(n).IsValid() {
+				return nil, fmt.Errorf("invalid value %v supplied for %s on %s, expected one of 1 or -1", a.Value, a.Operation, a.Column)
+			}
+
+			if a.Column == "" {
+				return nil, fmt.Errorf("operation %s requires a column", a.Operation)
+			}
+
+			sort = append(sort, primitive.E{Key: a.Column, Value: n})
+		}
+	}
+
+	if len(sort) > 0 {
+		opts.SetSort(sort)
+	}
+
+	return opts, nil
+}
+
+func toInt64(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), nil
+	case int32:
+		return int64(n), nil
+	case int64:
+		return n, nil
+	case support.Sort:
+		return int64(n), nil
+	case float64:
+		if n != float64(int64(n)) {
+			return 0, fmt.Errorf("%v is not an integer", n)
 		}
+		return int64(n), nil
 	}
 
-	return opts
+	return 0, fmt.Errorf("invalid type %T, expected an integer", v)
 }
 
 func newBool(b bool) *bool {
@@ -0,0 +1,430 @@
+package mongo
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/embersyndicate/support"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBuildFilters(t *testing.T) {
+
+	id, _ := primitive.ObjectIDFromHex("5fd0c1a2b3c4d5e6f7a8b9c0")
+	date := time.Date(2020, time.December, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		operators []*support.Operator
+		expected  string
+		err       string
+	}{
+		{
+			name:      "none",
+			operators: []*support.Operator{},
+			expected:  `{}`,
+		},
+		{
+			name:      "equal",
+			operators: []*support.Operator{support.NewEqualOperator("statusID", id)},
+			expected:  `{"statusID":{"$eq":{"$oid":"5fd0c1a2b3c4d5e6f7a8b9c0"}}}`,
+		},
+		{
+			name:      "not equal",
+			operators: []*support.Operator{support.NewNotEqualOperator("name", "open")},
+			expected:  `{"name":{"$ne":"open"}}`,
+		},
+		{
+			name:      "greater than",
+			operators: []*support.Operator{support.NewGreaterThanOperator("createdAt", date)},
+			expected:  `{"createdAt":{"$gt":{"$date":"2020-12-01T12:00:00Z"}}}`,
+		},
+		{
+			name:      "greater than or equal",
+			operators: []*support.Operator{support.NewGreaterThanEqualToOperator("version", 2)},
+			expected:  `{"version":{"$gte":2}}`,
+		},
+		{
+			name:      "less than",
+			operators: []*support.Operator{support.NewLessThanOperator("version", 2.5)},
+			expected:  `{"version":{"$lt":2.5}}`,
+		},
+		{
+			name:      "less than or equal",
+			operators: []*support.Operator{support.NewLessThanEqualToOperator("version", int64(3))},
+			expected:  `{"version":{"$lte":3}}`,
+		},
+		{
+			name:      "comparison without column",
+			operators: []*support.Operator{support.NewEqualOperator("", 1)},
+			err:       "operation = requires a column",
+		},
+		{
+			name:      "multiple operators",
+			operators: []*support.Operator{support.NewEqualOperator("name", "a"), support.NewNotEqualOperator("deleted", true)},
+			expected:  `{"name":{"$eq":"a"},"deleted":{"$ne":true}}`,
+		},
+		{
+			name:      "in with typed values",
+			operators: []*support.Operator{support.NewInOperator("statusID", []primitive.ObjectID{id})},
+			expected:  `{"statusID":{"$in":[{"$oid":"5fd0c1a2b3c4d5e6f7a8b9c0"}]}}`,
+		},
+		{
+			name:      "in with strings",
+			operators: []*support.Operator{support.NewInOperator("name", []string{"a", "b"})},
+			expected:  `{"name":{"$in":["a","b"]}}`,
+		},
+		{
+			name:      "in with an array",
+			operators: []*support.Operator{support.NewInOperator("version", [2]int{1, 2})},
+			expected:  `{"version":{"$in":[1,2]}}`,
+		},
+		{
+			name:      "not in with interface values",
+			operators: []*support.Operator{support.NewNotInOperator("name", []interface{}{"a", 1})},
+			expected:  `{"name":{"$nin":["a",1]}}`,
+		},
+		{
+			name:      "in with an empty slice",
+			operators: []*support.Operator{support.NewInOperator("name", []string{})},
+			expected:  `{"name":{"$in":[]}}`,
+		},
+		{
+			name:      "in with a non slice value",
+			operators: []*support.Operator{support.NewInOperator("name", "a")},
+			err:       "invalid type string supplied for in on name, expected a slice or array",
+		},
+		{
+			name:      "not in with a nil value",
+			operators: []*support.Operator{support.NewNotInOperator("name", nil)},
+			err:       "invalid type <nil> supplied for not in on name, expected a slice or array",
+		},
+		{
+			name:      "exists",
+			operators: []*support.Operator{support.NewExistsOperator("assignedTo", false)},
+			expected:  `{"assignedTo":{"$exists":false}}`,
+		},
+		{
+			name:      "exists with a non bool value",
+			operators: []*support.Operator{{Column: "assignedTo", Operation: support.ExistsOp, Value: "true"}},
+			err:       "invalid type string supplied for exists on assignedTo, expected bool",
+		},
+		{
+			name: "or",
+			operators: []*support.Operator{support.NewOrOperator(
+				support.NewEqualOperator("name", "a"),
+				support.NewEqualOperator("name", "b"),
+			)},
+			expected: `{"$or":[{"name":{"$eq":"a"}},{"name":{"$eq":"b"}}]}`,
+		},
+		{
+			name: "nested and within or",
+			operators: []*support.Operator{support.NewOrOperator(
+				support.NewAndOperator(
+					support.NewEqualOperator("name", "a"),
+					support.NewExistsOperator("assignedTo", true),
+				),
+				support.NewOrOperator(
+					support.NewLessThanOperator("version", 2),
+				),
+			)},
+			expected: `{"$or":[{"$and":[{"name":{"$eq":"a"}},{"assignedTo":{"$exists":true}}]},{"$or":[{"version":{"$lt":2}}]}]}`,
+		},
+		{
+			name:      "empty group",
+			operators: []*support.Operator{support.NewAndOperator()},
+			err:       "and requires at least one operator",
+		},
+		{
+			name:      "group with an invalid value",
+			operators: []*support.Operator{{Operation: support.OrOp, Value: support.NewEqualOperator("name", "a")}},
+			err:       "invalid type *support.Operator supplied for or, expected []*support.Operator",
+		},
+		{
+			name:      "group containing an invalid operator",
+			operators: []*support.Operator{support.NewOrOperator(support.NewInOperator("name", "a"))},
+			err:       "invalid type string supplied for in on name, expected a slice or array",
+		},
+		{
+			name:      "regex",
+			operators: []*support.Operator{support.NewRegexOperator("name", "^a.*z$")},
+			expected:  `{"name":{"$regex":"^a.*z$"}}`,
+		},
+		{
+			name:      "insensitive regex",
+			operators: []*support.Operator{support.NewInsensitiveRegexOperator("name", "abc")},
+			expected:  `{"name":{"$regex":"abc","$options":"i"}}`,
+		},
+		{
+			name:      "prefix is quoted",
+			operators: []*support.Operator{support.NewPrefixOperator("name", "a.b*")},
+			expected:  `{"name":{"$regex":"^a\\.b\\*"}}`,
+		},
+		{
+			name:      "equal fold is quoted and anchored",
+			operators: []*support.Operator{support.NewEqualFoldOperator("email", "a+b@example.com")},
+			expected:  `{"email":{"$regex":"^a\\+b@example\\.com$","$options":"i"}}`,
+		},
+		{
+			name:      "invalid regex pattern",
+			operators: []*support.Operator{support.NewRegexOperator("name", "a(b")},
+			err:       "invalid pattern supplied for regex on name: error parsing regexp: missing closing ): `a(b`",
+		},
+		{
+			name:      "regex with a non string value",
+			operators: []*support.Operator{{Column: "name", Operation: support.InsensitiveRegexOp, Value: 1}},
+			err:       "invalid type int supplied for iregex on name, expected string",
+		},
+		{
+			name:      "size",
+			operators: []*support.Operator{support.NewSizeOperator("fields", 2)},
+			expected:  `{"fields":{"$size":2}}`,
+		},
+		{
+			name:      "size with a whole float",
+			operators: []*support.Operator{{Column: "fields", Operation: support.SizeOp, Value: float64(3)}},
+			expected:  `{"fields":{"$size":3}}`,
+		},
+		{
+			name:      "negative size",
+			operators: []*support.Operator{support.NewSizeOperator("fields", -1)},
+			err:       "invalid value -1 supplied for size on fields, expected a non-negative integer",
+		},
+		{
+			name:      "size with a fractional value",
+			operators: []*support.Operator{{Column: "fields", Operation: support.SizeOp, Value: 1.5}},
+			err:       "invalid value 1.5 supplied for size on fields, expected a non-negative integer",
+		},
+		{
+			name: "elem match",
+			operators: []*support.Operator{support.NewElemMatchOperator("fields",
+				support.NewEqualOperator("id", id),
+				support.NewEqualOperator("value", "a"),
+			)},
+			expected: `{"fields":{"$elemMatch":{"id":{"$eq":{"$oid":"5fd0c1a2b3c4d5e6f7a8b9c0"}},"value":{"$eq":"a"}}}}`,
+		},
+		{
+			name:      "empty elem match",
+			operators: []*support.Operator{support.NewElemMatchOperator("fields")},
+			err:       "invalid type []*support.Operator supplied for elem match on fields, expected a non empty []*support.Operator",
+		},
+		{
+			name:      "elem match containing an invalid operator",
+			operators: []*support.Operator{support.NewElemMatchOperator("fields", support.NewSizeOperator("values", -1))},
+			err:       "invalid value -1 supplied for size on values, expected a non-negative integer",
+		},
+		{
+			name: "find options are ignored",
+			operators: []*support.Operator{
+				support.NewEqualOperator("name", "a"),
+				support.NewLimitOperator(10),
+				support.NewSkipOperator(5),
+				support.NewOrderOperator("name", support.SortAsc),
+			},
+			expected: `{"name":{"$eq":"a"}}`,
+		},
+		{
+			name:      "unknown operation",
+			operators: []*support.Operator{{Column: "name", Operation: support.Operation("like"), Value: "a"}},
+			err:       `unsupported operation "like" supplied`,
+		},
+		{
+			name:      "nil operator",
+			operators: []*support.Operator{support.NewEqualOperator("name", "a"), nil},
+			err:       "nil operator supplied",
+		},
+		{
+			name:      "nil operator within group",
+			operators: []*support.Operator{support.NewAndOperator(nil)},
+			err:       "nil operator supplied",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			filter, err := BuildFilters(test.operators...)
+			assertError(t, err, test.err)
+			if test.err != "" {
+				return
+			}
+
+			assertJSON(t, filter, test.expected)
+
+		})
+	}
+
+}
+
+func TestBuildFindOptions(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		operators []*support.Operator
+		limit     *int64
+		skip      *int64
+		sort      string
+		err       string
+	}{
+		{
+			name:      "none",
+			operators: []*support.Operator{},
+		},
+		{
+			name: "limit and skip",
+			operators: []*support.Operator{
+				support.NewLimitOperator(10),
+				support.NewSkipOperator(20),
+			},
+			limit: newInt64(10),
+			skip:  newInt64(20),
+		},
+		{
+			name:      "zero skip",
+			operators: []*support.Operator{support.NewSkipOperator(0)},
+			skip:      newInt64(0),
+		},
+		{
+			name: "multiple sort keys in the order supplied",
+			operators: []*support.Operator{
+				support.NewOrderOperator("updatedAt", support.SortDesc),
+				support.NewOrderOperator("name", support.SortAsc),
+				{Column: "version", Operation: support.OrderOp, Value: support.SortDesc},
+			},
+			sort: `{"updatedAt":-1,"name":1,"version":-1}`,
+		},
+		{
+			name: "filters are ignored",
+			operators: []*support.Operator{
+				support.NewEqualOperator("name", "a"),
+				support.NewLimitOperator(1),
+			},
+			limit: newInt64(1),
+		},
+		{
+			name:      "negative limit",
+			operators: []*support.Operator{support.NewLimitOperator(-1)},
+			err:       "invalid value -1 supplied for limit, expected a non-negative integer",
+		},
+		{
+			name:      "limit with a string value",
+			operators: []*support.Operator{{Operation: support.LimitOp, Value: "10"}},
+			err:       "invalid value 10 supplied for limit, expected a non-negative integer",
+		},
+		{
+			name:      "fractional limit",
+			operators: []*support.Operator{{Operation: support.LimitOp, Value: 2.5}},
+			err:       "invalid value 2.5 supplied for limit, expected a non-negative integer",
+		},
+		{
+			name:      "negative skip",
+			operators: []*support.Operator{support.NewSkipOperator(-5)},
+			err:       "invalid value -5 supplied for skip, expected a non-negative integer",
+		},
+		{
+			name:      "skip with a nil value",
+			operators: []*support.Operator{{Operation: support.SkipOp}},
+			err:       "invalid value <nil> supplied for skip, expected a non-negative integer",
+		},
+		{
+			name:      "invalid sort direction",
+			operators: []*support.Operator{{Column: "name", Operation: support.OrderOp, Value: 2}},
+			err:       "invalid value 2 supplied for order on name, expected one of 1 or -1",
+		},
+		{
+			name:      "sort without column",
+			operators: []*support.Operator{support.NewOrderOperator("", support.SortAsc)},
+			err:       "operation order requires a column",
+		},
+		{
+			name:      "nil operator",
+			operators: []*support.Operator{support.NewLimitOperator(1), nil},
+			err:       "nil operator supplied",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			opts, err := BuildFindOptions(test.operators...)
+			assertError(t, err, test.err)
+			if test.err != "" {
+				return
+			}
+
+			assertInt64(t, "limit", opts.Limit, test.limit)
+			assertInt64(t, "skip", opts.Skip, test.skip)
+
+			if test.sort == "" {
+				if opts.Sort != nil {
+					t.Errorf("expected no sort, got %v", opts.Sort)
+				}
+				return
+			}
+
+			assertJSON(t, opts.Sort, test.sort)
+
+		})
+	}
+
+}
+
+// assertError fails the test when err does not match the expected message. An empty message expects no error
+func assertError(t *testing.T, err error, expected string) {
+
+	t.Helper()
+
+	if expected == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return
+	}
+
+	if err == nil {
+		t.Fatalf("expected error %q, got none", expected)
+	}
+
+	if err.Error() != expected {
+		t.Fatalf("expected error %q, got %q", expected, err.Error())
+	}
+
+}
+
+// assertJSON compares the relaxed extended JSON representation of the provided document with the expected JSON
+func assertJSON(t *testing.T, doc interface{}, expected string) {
+
+	t.Helper()
+
+	b, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		t.Fatalf("failed to marshal %v: %s", doc, err)
+	}
+
+	if actual := strings.TrimSpace(string(b)); actual != expected {
+		t.Errorf("expected %s, got %s", expected, actual)
+	}
+
+}
+
+func assertInt64(t *testing.T, name string, actual *int64, expected *int64) {
+
+	t.Helper()
+
+	switch {
+	case actual == nil && expected == nil:
+	case actual == nil:
+		t.Errorf("expected %s %d, got none", name, *expected)
+	case expected == nil:
+		t.Errorf("expected no %s, got %d", name, *actual)
+	case *actual != *expected:
+		t.Errorf("expected %s %d, got %d", name, *expected, *actual)
+	}
+
+}
+
+func newInt64(n int64) *int64 {
+	return &n
+}
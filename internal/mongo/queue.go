@@ -0,0 +1,169 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/embersyndicate/support"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type queueRepository struct {
+	queues *mongo.Collection
+}
+
+func NewQueueRepository(d *mongo.Database) (support.QueueRepository, error) {
+
+	q := d.Collection("queues")
+
+	_, err := q.Indexes().CreateMany(
+		context.TODO(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.M{
+					"name": 1,
+				},
+				Options: &options.IndexOptions{
+					Name:   newString("uniqueQueueName"),
+					Unique: newBool(true),
+				},
+			},
+			{
+				Keys: bson.M{
+					"categories": 1,
+				},
+				Options: &options.IndexOptions{
+					Name: newString("queueCategories"),
+				},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &queueRepository{
+		queues: q,
+	}, nil
+
+}
+
+func (r *queueRepository) Queue(ctx context.Context, id string) (*support.Queue, error) {
+
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to cast %s to ObjectID", id)
+	}
+
+	queues, err := r.Queues(ctx, support.NewEqualOperator("_id", _id), support.NewLimitOperator(1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(queues) == 0 {
+		return nil, fmt.Errorf("queue does not exist")
+	}
+
+	return queues[0], nil
+
+}
+
+func (r *queueRepository) Queues(ctx context.Context, operators ...*support.Operator) ([]*support.Queue, error) {
+
+	var queues = make([]*support.Queue, 0)
+
+	filters, err := BuildFilters(operators...)
+	if err != nil {
+		return queues, err
+	}
+
+	options, err := BuildFindOptions(operators...)
+	if err != nil {
+		return queues, err
+	}
+
+	result, err := r.queues.Find(ctx, filters, options)
+	if err != nil {
+		return queues, err
+	}
+
+	err = result.All(ctx, &queues)
+
+	return queues, err
+
+}
+
+func (r *queueRepository) CreateQueue(ctx context.Context, queue *support.Queue) (*support.Queue, error) {
+
+	result, err := r.queues.InsertOne(ctx, queue)
+	if err != nil {
+		return nil, err
+	}
+
+	queue.ID = result.InsertedID.(primitive.ObjectID)
+
+	return queue, err
+
+}
+
+func (r *queueRepository) UpdateQueue(ctx context.Context, id string, queue *support.Queue) (*support.Queue, error) {
+
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to cast %s to ObjectID", id)
+	}
+
+	queue.ID = _id
+
+	update := primitive.D{primitive.E{Key: "$set", Value: queue}}
+
+	_, err = r.queues.UpdateOne(ctx, primitive.D{primitive.E{Key: "_id", Value: _id}}, update)
+
+	return queue, err
+
+}
+
+func (r *queueRepository) DeleteQueue(ctx context.Context, id string) error {
+
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("unable to cast %s to ObjectID", id)
+	}
+
+	result, err := r.queues.DeleteOne(ctx, primitive.D{primitive.E{Key: "_id", Value: _id}})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("queue does not exist")
+	}
+
+	return nil
+
+}
+
+func (r *queueRepository) AdvanceQueue(ctx context.Context, id primitive.ObjectID) (int64, error) {
+
+	update := primitive.D{primitive.E{Key: "$inc", Value: primitive.D{primitive.E{Key: "cursor", Value: 1}}}}
+
+	var queue = new(support.Queue)
+	err := r.queues.FindOneAndUpdate(
+		ctx,
+		primitive.D{primitive.E{Key: "_id", Value: id}},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(queue)
+	if err == mongo.ErrNoDocuments {
+		return 0, fmt.Errorf("queue does not exist")
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return queue.Cursor, nil
+
+}
@@ -0,0 +1,160 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/embersyndicate/support"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type slaRepository struct {
+	policies *mongo.Collection
+}
+
+func NewSLARepository(d *mongo.Database) (support.SLARepository, error) {
+
+	p := d.Collection("slaPolicies")
+
+	_, err := p.Indexes().CreateMany(
+		context.TODO(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.M{
+					"name": 1,
+				},
+				Options: &options.IndexOptions{
+					Name:   newString("uniqueSLAPolicyName"),
+					Unique: newBool(true),
+				},
+			},
+			{
+				Keys: bson.M{
+					"categories": 1,
+				},
+				Options: &options.IndexOptions{
+					Name: newString("slaPolicyCategories"),
+				},
+			},
+			{
+				Keys: bson.M{
+					"definitions": 1,
+				},
+				Options: &options.IndexOptions{
+					Name: newString("slaPolicyDefinitions"),
+				},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &slaRepository{
+		policies: p,
+	}, nil
+
+}
+
+func (r *slaRepository) SLAPolicy(ctx context.Context, id string) (*support.SLAPolicy, error) {
+
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to cast %s to ObjectID", id)
+	}
+
+	policies, err := r.SLAPolicies(ctx, support.NewEqualOperator("_id", _id), support.NewLimitOperator(1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("sla policy does not exist")
+	}
+
+	return policies[0], nil
+
+}
+
+func (r *slaRepository) SLAPolicies(ctx context.Context, operators ...*support.Operator) ([]*support.SLAPolicy, error) {
+
+	var policies = make([]*support.SLAPolicy, 0)
+
+	filters, err := BuildFilters(operators...)
+	if err != nil {
+		return policies, err
+	}
+
+	options, err := BuildFindOptions(operators...)
+	if err != nil {
+		return policies, err
+	}
+
+	result, err := r.policies.Find(ctx, filters, options)
+	if err != nil {
+		return policies, err
+	}
+
+	err = result.All(ctx, &policies)
+
+	return policies, err
+
+}
+
+func (r *slaRepository) CreateSLAPolicy(ctx context.Context, policy *support.SLAPolicy) (*support.SLAPolicy, error) {
+
+	result, err := r.policies.InsertOne(ctx, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	policy.ID = result.InsertedID.(primitive.ObjectID)
+
+	return policy, err
+
+}
+
+func (r *slaRepository) UpdateSLAPolicy(ctx context.Context, id string, policy *support.SLAPolicy) (*support.SLAPolicy, error) {
+
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to cast %s to ObjectID", id)
+	}
+
+	policy.ID = _id
+
+	update := primitive.D{primitive.E{Key: "$set", Value: policy}}
+
+	// Business hours that have been removed are omitted from $set, so they have to be removed explicitly to be cleared
+	if policy.BusinessHours == nil {
+		update = append(update, primitive.E{Key: "$unset", Value: primitive.D{primitive.E{Key: "businessHours", Value: ""}}})
+	}
+
+	_, err = r.policies.UpdateOne(ctx, primitive.D{primitive.E{Key: "_id", Value: _id}}, update)
+
+	return policy, err
+
+}
+
+func (r *slaRepository) DeleteSLAPolicy(ctx context.Context, id string) error {
+
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("unable to cast %s to ObjectID", id)
+	}
+
+	result, err := r.policies.DeleteOne(ctx, primitive.D{primitive.E{Key: "_id", Value: _id}})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("sla policy does not exist")
+	}
+
+	return nil
+
+}
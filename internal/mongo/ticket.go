@@ -3,6 +3,7 @@ package mongo
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/embersyndicate/support"
 	"go.mongodb.org/mongo-driver/bson"
@@ -16,6 +17,8 @@ type ticketRepository struct {
 	ticketDefinitions *mongo.Collection
 	ticketStatuses    *mongo.Collection
 	fieldDefinitions  *mongo.Collection
+
+	ticketDefinitionVersions *mongo.Collection
 }
 
 func NewTicketRepository(d *mongo.Database) (support.TicketRepository, error) {
@@ -24,6 +27,7 @@ func NewTicketRepository(d *mongo.Database) (support.TicketRepository, error) {
 	td := d.Collection("ticketDefinitions")
 	ts := d.Collection("ticketStatuses")
 	tf := d.Collection("fieldDefinitions")
+	tv := d.Collection("ticketDefinitionVersions")
 
 	_, err := td.Indexes().CreateOne(
 		context.TODO(),
@@ -73,11 +77,74 @@ func NewTicketRepository(d *mongo.Database) (support.TicketRepository, error) {
 		return nil, err
 	}
 
+	_, err = tv.Indexes().CreateOne(
+		context.TODO(),
+		mongo.IndexModel{
+			Keys: bson.D{
+				bson.E{Key: "definitionID", Value: 1},
+				bson.E{Key: "version", Value: 1},
+			},
+			Options: &options.IndexOptions{
+				Name:   newString("uniqueTicketDefinitionVersion"),
+				Unique: newBool(true),
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = t.Indexes().CreateOne(
+		context.TODO(),
+		mongo.IndexModel{
+			Keys: bson.D{
+				bson.E{Key: "categoryID", Value: 1},
+				bson.E{Key: "assignedTo", Value: 1},
+				bson.E{Key: "createdAt", Value: 1},
+			},
+			Options: &options.IndexOptions{
+				Name: newString("ticketAssignment"),
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = t.Indexes().CreateMany(
+		context.TODO(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.M{
+					support.SLAColumnFirstResponseDue: 1,
+				},
+				Options: &options.IndexOptions{
+					Name:   newString("slaFirstResponseDue"),
+					Sparse: newBool(true),
+				},
+			},
+			{
+				Keys: bson.M{
+					support.SLAColumnResolutionDue: 1,
+				},
+				Options: &options.IndexOptions{
+					Name:   newString("slaResolutionDue"),
+					Sparse: newBool(true),
+				},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
 	return &ticketRepository{
 		tickets:           t,
 		ticketDefinitions: td,
 		ticketStatuses:    ts,
 		fieldDefinitions:  tf,
+
+		ticketDefinitionVersions: tv,
 	}, nil
 
 }
@@ -94,17 +161,25 @@ func (r *ticketRepository) Ticket(ctx context.Context, id string) (*support.Tick
 	}
 
 	if len(tickets) == 0 {
-		return nil, fmt.Errorf("category does not exist")
+		return nil, fmt.Errorf("ticket does not exist")
 	}
 
 	return tickets[0], nil
 }
 
 func (r *ticketRepository) Tickets(ctx context.Context, operators ...*support.Operator) ([]*support.Ticket, error) {
-	filters := BuildFilters(operators...)
-	options := BuildFindOptions(operators...)
-
 	var tickets = make([]*support.Ticket, 0)
+
+	filters, err := BuildFilters(operators...)
+	if err != nil {
+		return tickets, err
+	}
+
+	options, err := BuildFindOptions(operators...)
+	if err != nil {
+		return tickets, err
+	}
+
 	result, err := r.tickets.Find(ctx, filters, options)
 	if err != nil {
 		return tickets, err
@@ -137,7 +212,42 @@ func (r *ticketRepository) UpdateTicket(ctx context.Context, id string, ticket *
 
 	ticket.ID = _id
 
-	update := primitive.D{primitive.E{Key: "$set", Value: ticket}}
+	// Only the attributes that may change after submission are written, so that
+	// concurrent changes to the other attributes, such as the assignee, are preserved
+	set := primitive.D{
+		primitive.E{Key: "fields", Value: ticket.Fields},
+		primitive.E{Key: "statusID", Value: ticket.StatusID},
+		primitive.E{Key: "updatedAt", Value: ticket.UpdateAt},
+	}
+	unset := primitive.D{}
+
+	// Of the SLA, only the attributes that follow the status of the ticket are written. The times at which
+	// targets were met or missed are recorded by StampTicketSLA and must not be overwritten by a stale copy
+	if ticket.SLA != nil {
+		columns := []struct {
+			name  string
+			value *time.Time
+		}{
+			{name: support.SLAColumnFirstResponseDue, value: ticket.SLA.FirstResponseDue},
+			{name: support.SLAColumnResolutionDue, value: ticket.SLA.ResolutionDue},
+			{name: support.SLAColumnPausedAt, value: ticket.SLA.PausedAt},
+			{name: support.SLAColumnResolvedAt, value: ticket.SLA.ResolvedAt},
+		}
+
+		for _, column := range columns {
+			if column.value == nil {
+				unset = append(unset, primitive.E{Key: column.name, Value: ""})
+				continue
+			}
+
+			set = append(set, primitive.E{Key: column.name, Value: column.value})
+		}
+	}
+
+	update := primitive.D{primitive.E{Key: "$set", Value: set}}
+	if len(unset) > 0 {
+		update = append(update, primitive.E{Key: "$unset", Value: unset})
+	}
 
 	_, err = r.tickets.UpdateOne(ctx, primitive.D{primitive.E{Key: "_id", Value: _id}}, update)
 
@@ -145,6 +255,215 @@ func (r *ticketRepository) UpdateTicket(ctx context.Context, id string, ticket *
 
 }
 
+func (r *ticketRepository) AssignTicket(ctx context.Context, id primitive.ObjectID, assignee primitive.ObjectID, at time.Time) (*support.Ticket, error) {
+
+	update := primitive.D{primitive.E{Key: "$set", Value: primitive.D{
+		primitive.E{Key: "assignedTo", Value: assignee},
+		primitive.E{Key: "updatedAt", Value: at},
+	}}}
+
+	return r.findAndUpdateTicket(ctx, id, update)
+
+}
+
+func (r *ticketRepository) UnassignTicket(ctx context.Context, id primitive.ObjectID, at time.Time) (*support.Ticket, error) {
+
+	update := primitive.D{
+		primitive.E{Key: "$set", Value: primitive.D{primitive.E{Key: "updatedAt", Value: at}}},
+		primitive.E{Key: "$unset", Value: primitive.D{primitive.E{Key: "assignedTo", Value: ""}}},
+	}
+
+	return r.findAndUpdateTicket(ctx, id, update)
+
+}
+
+// findAndUpdateTicket applies the update to the ticket and returns the ticket as it was stored after the update
+func (r *ticketRepository) findAndUpdateTicket(ctx context.Context, id primitive.ObjectID, update primitive.D) (*support.Ticket, error) {
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var ticket = new(support.Ticket)
+	err := r.tickets.FindOneAndUpdate(ctx, primitive.D{primitive.E{Key: "_id", Value: id}}, update, opts).Decode(ticket)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("ticket does not exist")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ticket, nil
+
+}
+
+func (r *ticketRepository) ClaimTicket(ctx context.Context, assignee primitive.ObjectID, at time.Time, operators ...*support.Operator) (*support.Ticket, error) {
+
+	operators = append(operators, support.NewExistsOperator("assignedTo", false))
+
+	filters, err := BuildFilters(operators...)
+	if err != nil {
+		return nil, err
+	}
+
+	update := primitive.D{primitive.E{Key: "$set", Value: primitive.D{
+		primitive.E{Key: "assignedTo", Value: assignee},
+		primitive.E{Key: "updatedAt", Value: at},
+	}}}
+
+	opts := options.FindOneAndUpdate().
+		SetSort(primitive.D{primitive.E{Key: "createdAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var ticket = new(support.Ticket)
+	err = r.tickets.FindOneAndUpdate(ctx, filters, update, opts).Decode(ticket)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ticket, nil
+
+}
+
+func (r *ticketRepository) AssignedTicketCounts(ctx context.Context, assignees []primitive.ObjectID, operators ...*support.Operator) (map[primitive.ObjectID]int64, error) {
+
+	operators = append(operators, support.NewInOperator("assignedTo", assignees))
+
+	filters, err := BuildFilters(operators...)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := mongo.Pipeline{
+		primitive.D{primitive.E{Key: "$match", Value: filters}},
+		primitive.D{primitive.E{Key: "$group", Value: primitive.D{
+			primitive.E{Key: "_id", Value: "$assignedTo"},
+			primitive.E{Key: "count", Value: primitive.D{primitive.E{Key: "$sum", Value: 1}}},
+		}}},
+	}
+
+	result, err := r.tickets.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []struct {
+		ID    primitive.ObjectID `bson:"_id"`
+		Count int64              `bson:"count"`
+	}
+	err = result.All(ctx, &groups)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[primitive.ObjectID]int64, len(assignees))
+	for _, group := range groups {
+		counts[group.ID] = group.Count
+	}
+
+	return counts, nil
+
+}
+
+func (r *ticketRepository) CategoryTicketDefinitions(ctx context.Context, operators ...*support.Operator) (map[primitive.ObjectID][]primitive.ObjectID, error) {
+
+	filters, err := BuildFilters(operators...)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := mongo.Pipeline{
+		primitive.D{primitive.E{Key: "$match", Value: filters}},
+		primitive.D{primitive.E{Key: "$group", Value: primitive.D{
+			primitive.E{Key: "_id", Value: "$categoryID"},
+			primitive.E{Key: "definitions", Value: primitive.D{primitive.E{Key: "$addToSet", Value: "$definitionID"}}},
+		}}},
+	}
+
+	result, err := r.tickets.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []struct {
+		ID          primitive.ObjectID   `bson:"_id"`
+		Definitions []primitive.ObjectID `bson:"definitions"`
+	}
+	err = result.All(ctx, &groups)
+	if err != nil {
+		return nil, err
+	}
+
+	definitions := make(map[primitive.ObjectID][]primitive.ObjectID, len(groups))
+	for _, group := range groups {
+		definitions[group.ID] = group.Definitions
+	}
+
+	return definitions, nil
+
+}
+
+// ReassignTicketCategory moves every ticket in the from category into the to category
+func (r *ticketRepository) ReassignTicketCategory(ctx context.Context, from, to primitive.ObjectID) error {
+
+	update := primitive.D{primitive.E{Key: "$set", Value: primitive.D{
+		primitive.E{Key: "categoryID", Value: to},
+		primitive.E{Key: "updatedAt", Value: time.Now()},
+	}}}
+
+	_, err := r.tickets.UpdateMany(ctx, primitive.D{primitive.E{Key: "categoryID", Value: from}}, update)
+
+	return err
+
+}
+
+// TouchTicket sets the updatedAt of the ticket without modifying any of its other attributes
+func (r *ticketRepository) TouchTicket(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+
+	update := primitive.D{primitive.E{Key: "$set", Value: primitive.D{
+		primitive.E{Key: "updatedAt", Value: at},
+	}}}
+
+	result, err := r.tickets.UpdateOne(ctx, primitive.D{primitive.E{Key: "_id", Value: id}}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("ticket does not exist")
+	}
+
+	return nil
+
+}
+
+func (r *ticketRepository) StampTicketSLA(ctx context.Context, id primitive.ObjectID, column string, at time.Time, operators ...*support.Operator) (bool, error) {
+
+	filter, err := BuildFilters(operators...)
+	if err != nil {
+		return false, err
+	}
+
+	filter = append(filter,
+		primitive.E{Key: "_id", Value: id},
+		primitive.E{Key: "sla", Value: primitive.D{primitive.E{Key: "$exists", Value: true}}},
+		primitive.E{Key: column, Value: primitive.D{primitive.E{Key: "$exists", Value: false}}},
+	)
+
+	update := primitive.D{primitive.E{Key: "$set", Value: primitive.D{
+		primitive.E{Key: column, Value: at},
+	}}}
+
+	result, err := r.tickets.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+
+}
+
 func (r *ticketRepository) TicketDefinition(ctx context.Context, id string) (*support.TicketDefinition, error) {
 
 	_id, err := primitive.ObjectIDFromHex(id)
@@ -167,10 +486,18 @@ func (r *ticketRepository) TicketDefinition(ctx context.Context, id string) (*su
 
 func (r *ticketRepository) TicketDefinitions(ctx context.Context, operators ...*support.Operator) ([]*support.TicketDefinition, error) {
 
-	filters := BuildFilters(operators...)
-	options := BuildFindOptions(operators...)
-
 	var ticketDefinitions = make([]*support.TicketDefinition, 0)
+
+	filters, err := BuildFilters(operators...)
+	if err != nil {
+		return ticketDefinitions, err
+	}
+
+	options, err := BuildFindOptions(operators...)
+	if err != nil {
+		return ticketDefinitions, err
+	}
+
 	result, err := r.ticketDefinitions.Find(ctx, filters, options)
 	if err != nil {
 		return ticketDefinitions, err
@@ -195,7 +522,7 @@ func (r *ticketRepository) CreateTicketDefinition(ctx context.Context, ticketDef
 
 }
 
-func (r *ticketRepository) UpdateTicketDefinition(ctx context.Context, id string, ticketDefinition *support.TicketDefinition) (*support.TicketDefinition, error) {
+func (r *ticketRepository) ReplaceTicketDefinition(ctx context.Context, id string, version int, ticketDefinition *support.TicketDefinition) (*support.TicketDefinition, error) {
 
 	_id, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -206,9 +533,88 @@ func (r *ticketRepository) UpdateTicketDefinition(ctx context.Context, id string
 
 	update := primitive.D{primitive.E{Key: "$set", Value: ticketDefinition}}
 
-	_, err = r.ticketDefinitions.UpdateOne(ctx, primitive.D{primitive.E{Key: "_id", Value: _id}}, update)
+	// The stamps of a definition that has been enabled again are omitted from $set,
+	// so they have to be removed explicitly to be cleared
+	unset := primitive.D{}
+	if ticketDefinition.DisabledBy == nil {
+		unset = append(unset, primitive.E{Key: "disabledBy", Value: ""})
+	}
+
+	if ticketDefinition.DisabledAt == nil {
+		unset = append(unset, primitive.E{Key: "disabledAt", Value: ""})
+	}
 
-	return ticketDefinition, err
+	if len(unset) > 0 {
+		update = append(update, primitive.E{Key: "$unset", Value: unset})
+	}
+
+	// Definitions that predate versioning may not have a version at all
+	var current interface{} = version
+	if version == 0 {
+		current = primitive.D{primitive.E{Key: "$in", Value: primitive.A{0, nil}}}
+	}
+
+	filter := primitive.D{
+		primitive.E{Key: "_id", Value: _id},
+		primitive.E{Key: "version", Value: current},
+	}
+
+	result, err := r.ticketDefinitions.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.MatchedCount == 0 {
+		return nil, nil
+	}
+
+	return ticketDefinition, nil
+
+}
+
+func (r *ticketRepository) TicketDefinitionVersions(ctx context.Context, operators ...*support.Operator) ([]*support.TicketDefinitionVersion, error) {
+
+	var versions = make([]*support.TicketDefinitionVersion, 0)
+
+	filters, err := BuildFilters(operators...)
+	if err != nil {
+		return versions, err
+	}
+
+	options, err := BuildFindOptions(operators...)
+	if err != nil {
+		return versions, err
+	}
+
+	result, err := r.ticketDefinitionVersions.Find(ctx, filters, options)
+	if err != nil {
+		return versions, err
+	}
+
+	err = result.All(ctx, &versions)
+
+	return versions, err
+
+}
+
+func (r *ticketRepository) CreateTicketDefinitionVersion(ctx context.Context, version *support.TicketDefinitionVersion) (*support.TicketDefinitionVersion, error) {
+
+	result, err := r.ticketDefinitionVersions.InsertOne(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+
+	version.ID = result.InsertedID.(primitive.ObjectID)
+
+	return version, err
+
+}
+
+func (r *ticketRepository) DeleteTicketDefinitionVersion(ctx context.Context, id primitive.ObjectID) error {
+
+	_, err := r.ticketDefinitionVersions.DeleteOne(ctx, primitive.D{primitive.E{Key: "_id", Value: id}})
+
+	return err
 
 }
 
@@ -234,10 +640,18 @@ func (r *ticketRepository) TicketStatus(ctx context.Context, id string) (*suppor
 
 func (r *ticketRepository) TicketStatuses(ctx context.Context, operators ...*support.Operator) ([]*support.TicketStatus, error) {
 
-	filters := BuildFilters(operators...)
-	options := BuildFindOptions(operators...)
-
 	var ticketStatuses = make([]*support.TicketStatus, 0)
+
+	filters, err := BuildFilters(operators...)
+	if err != nil {
+		return ticketStatuses, err
+	}
+
+	options, err := BuildFindOptions(operators...)
+	if err != nil {
+		return ticketStatuses, err
+	}
+
 	result, err := r.ticketStatuses.Find(ctx, filters, options)
 	if err != nil {
 		return ticketStatuses, err
@@ -301,10 +715,18 @@ func (r *ticketRepository) FieldDefinition(ctx context.Context, id string) (*sup
 
 func (r *ticketRepository) FieldDefinitions(ctx context.Context, operators ...*support.Operator) ([]*support.FieldDefinition, error) {
 
-	filters := BuildFilters(operators...)
-	options := BuildFindOptions(operators...)
-
 	var definitions = make([]*support.FieldDefinition, 0)
+
+	filters, err := BuildFilters(operators...)
+	if err != nil {
+		return definitions, err
+	}
+
+	options, err := BuildFindOptions(operators...)
+	if err != nil {
+		return definitions, err
+	}
+
 	result, err := r.fieldDefinitions.Find(ctx, filters, options)
 	if err != nil {
 		return definitions, err
@@ -340,6 +762,21 @@ func (r *ticketRepository) UpdateFieldDefinition(ctx context.Context, id string,
 
 	update := primitive.D{primitive.E{Key: "$set", Value: definition}}
 
+	// The stamps of a definition that has been enabled again are omitted from $set,
+	// so they have to be removed explicitly to be cleared
+	unset := primitive.D{}
+	if definition.DisabledBy == nil {
+		unset = append(unset, primitive.E{Key: "disabledBy", Value: ""})
+	}
+
+	if definition.DisabledAt == nil {
+		unset = append(unset, primitive.E{Key: "disabledAt", Value: ""})
+	}
+
+	if len(unset) > 0 {
+		update = append(update, primitive.E{Key: "$unset", Value: unset})
+	}
+
 	_, err = r.fieldDefinitions.UpdateOne(ctx, primitive.D{primitive.E{Key: "_id", Value: _id}}, update)
 
 	return definition, err
@@ -6,10 +6,19 @@ import (
 	"time"
 
 	"github.com/embersyndicate/support"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// userCollation compares strings case-insensitively. It is shared by the unique indexes of
+// the collection and every query against it so that those queries are able to use the indexes
+var userCollation = &options.Collation{
+	Locale:   "en",
+	Strength: 2,
+}
+
 type userRepository struct {
 	users *mongo.Collection
 }
@@ -17,13 +26,93 @@ type userRepository struct {
 func NewUserRepository(d *mongo.Database) (support.UserRepository, error) {
 	c := d.Collection("users")
 
-	// Add Indexes if needed
+	_, err := c.Indexes().CreateMany(
+		context.TODO(),
+		[]mongo.IndexModel{
+			{
+				Keys: bson.M{
+					support.UserUsername: 1,
+				},
+				Options: &options.IndexOptions{
+					Name:      newString(support.UserUsernameIndex),
+					Unique:    newBool(true),
+					Collation: userCollation,
+				},
+			},
+			{
+				Keys: bson.M{
+					support.UserEmail: 1,
+				},
+				Options: &options.IndexOptions{
+					Name:      newString(support.UserEmailIndex),
+					Unique:    newBool(true),
+					Collation: userCollation,
+				},
+			},
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the unique indexes of users, run the migrate duplicate-users command to find the users that conflict: %w", err)
+	}
 
 	return &userRepository{
 		users: c,
 	}, nil
 }
 
+// UserDuplicates is a set of users that share the value of a column that has to be unique
+type UserDuplicates struct {
+	Column  string
+	Value   string
+	UserIDs []primitive.ObjectID
+}
+
+// DuplicateUsers returns every set of users whose username or email only differ by case. Such users prevent
+// the unique indexes of the collection from being created, so it reads the collection without NewUserRepository
+func DuplicateUsers(ctx context.Context, d *mongo.Database) ([]*UserDuplicates, error) {
+
+	c := d.Collection("users")
+
+	duplicates := make([]*UserDuplicates, 0)
+	for _, column := range []string{support.UserUsername, support.UserEmail} {
+		// Grouping applies the collation of the aggregation, so values are compared exactly as the unique index compares them
+		pipeline := mongo.Pipeline{
+			primitive.D{primitive.E{Key: "$group", Value: primitive.D{
+				primitive.E{Key: "_id", Value: "$" + column},
+				primitive.E{Key: "userIDs", Value: primitive.D{primitive.E{Key: "$push", Value: "$_id"}}},
+				primitive.E{Key: "count", Value: primitive.D{primitive.E{Key: "$sum", Value: 1}}},
+			}}},
+			primitive.D{primitive.E{Key: "$match", Value: primitive.D{primitive.E{Key: "count", Value: primitive.D{primitive.E{Key: "$gt", Value: 1}}}}}},
+			primitive.D{primitive.E{Key: "$sort", Value: primitive.D{primitive.E{Key: "_id", Value: 1}}}},
+		}
+
+		result, err := c.Aggregate(ctx, pipeline, options.Aggregate().SetCollation(userCollation))
+		if err != nil {
+			return nil, err
+		}
+
+		var groups []struct {
+			Value   string               `bson:"_id"`
+			UserIDs []primitive.ObjectID `bson:"userIDs"`
+		}
+		err = result.All(ctx, &groups)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range groups {
+			duplicates = append(duplicates, &UserDuplicates{
+				Column:  column,
+				Value:   group.Value,
+				UserIDs: group.UserIDs,
+			})
+		}
+	}
+
+	return duplicates, nil
+
+}
+
 func (r *userRepository) User(ctx context.Context, id string) (*support.User, error) {
 
 	_id, err := primitive.ObjectIDFromHex(id)
@@ -45,10 +134,20 @@ func (r *userRepository) User(ctx context.Context, id string) (*support.User, er
 }
 
 func (r *userRepository) Users(ctx context.Context, operators ...*support.Operator) ([]*support.User, error) {
-	filters := BuildFilters(operators...)
-	options := BuildFindOptions(operators...)
-
 	var users = make([]*support.User, 0)
+
+	filters, err := BuildFilters(operators...)
+	if err != nil {
+		return users, err
+	}
+
+	options, err := BuildFindOptions(operators...)
+	if err != nil {
+		return users, err
+	}
+
+	options.SetCollation(userCollation)
+
 	result, err := r.users.Find(ctx, filters, options)
 	if err != nil {
 		return users, err
@@ -77,9 +176,76 @@ func (r *userRepository) CreateUser(ctx context.Context, user *support.User) (*s
 }
 
 func (r *userRepository) UpdateUser(ctx context.Context, id string, user *support.User) (*support.User, error) {
-	panic("UpdateUser not implemented")
+
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("unable to cast %s to ObjectID", id)
+	}
+
+	user.ID = _id
+	user.UpdatedAt = time.Now()
+
+	update := primitive.D{primitive.E{Key: "$set", Value: user}}
+
+	// Optional attributes are omitted from $set when they are empty,
+	// so they have to be removed explicitly to be cleared
+	unset := primitive.D{}
+	if len(user.Permissions) == 0 {
+		unset = append(unset, primitive.E{Key: "permissions", Value: ""})
+	}
+
+	if user.EmailVerifiedAt == nil {
+		unset = append(unset, primitive.E{Key: "emailVerifiedAt", Value: ""})
+	}
+
+	if len(unset) > 0 {
+		update = append(update, primitive.E{Key: "$unset", Value: unset})
+	}
+
+	_, err = r.users.UpdateOne(ctx, primitive.D{primitive.E{Key: "_id", Value: _id}}, update)
+
+	return user, err
+
 }
 
+// DeleteUser soft deletes the user. The document is kept so that references to the user remain
+// valid, but the personal details and credentials of the user are replaced with placeholders
 func (r *userRepository) DeleteUser(ctx context.Context, id string) error {
-	panic("DeleteUser not implemented")
+
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("unable to cast %s to ObjectID", id)
+	}
+
+	now := time.Now()
+
+	update := primitive.D{
+		primitive.E{Key: "$set", Value: primitive.D{
+			primitive.E{Key: "first_name", Value: "Deleted"},
+			primitive.E{Key: "last_name", Value: "User"},
+			primitive.E{Key: "email", Value: fmt.Sprintf("%s@deleted.invalid", id)},
+			primitive.E{Key: "username", Value: fmt.Sprintf("deleted-%s", id)},
+			primitive.E{Key: "password", Value: ""},
+			primitive.E{Key: "updatedAt", Value: now},
+			primitive.E{Key: "deletedAt", Value: now},
+		}},
+		primitive.E{Key: "$unset", Value: primitive.D{
+			primitive.E{Key: "permissions", Value: ""},
+		}},
+	}
+
+	result, err := r.users.UpdateOne(ctx, primitive.D{
+		primitive.E{Key: "_id", Value: _id},
+		primitive.E{Key: "deletedAt", Value: primitive.D{primitive.E{Key: "$exists", Value: false}}},
+	}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("user does not exist")
+	}
+
+	return nil
+
 }
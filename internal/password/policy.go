@@ -0,0 +1,227 @@
+package password
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/embersyndicate/support/pkg/middleware"
+	"github.com/hesahesa/pwdbro/checker"
+	"github.com/trustelem/zxcvbn"
+)
+
+// maxBytes is the longest password that bcrypt is able to hash
+const maxBytes = 72
+
+// RemoteCheck controls whether passwords are checked against the pwnedpasswords API and
+// how the policy behaves when the API cannot be reached
+type RemoteCheck string
+
+const (
+	RemoteCheckOff RemoteCheck = "off"
+	// RemoteCheckFailOpen accepts passwords that could not be checked against the API
+	RemoteCheckFailOpen RemoteCheck = "fail-open"
+	// RemoteCheckFailClosed refuses passwords that could not be checked against the API
+	RemoteCheckFailClosed RemoteCheck = "fail-closed"
+)
+
+var AllRemoteChecks = []RemoteCheck{
+	RemoteCheckOff, RemoteCheckFailOpen, RemoteCheckFailClosed,
+}
+
+func (r RemoteCheck) Valid() bool {
+	for _, v := range AllRemoteChecks {
+		if v == r {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Config struct {
+	// MinLength is the minimum number of characters in a password
+	MinLength int
+	// MinScore is the minimum zxcvbn score, from 0 to 4, of a password
+	MinScore int
+	// BreachedList is the path to a file of breached passwords, one per line. Lines may either be a
+	// password or the hex encoded SHA-1 of a password, optionally followed by ":<count>" as in the
+	// files that are published by Have I Been Pwned. An empty path disables the local list
+	BreachedList string
+	RemoteCheck  RemoteCheck
+}
+
+// Policy decides whether a password may be used
+type Policy interface {
+	// Check returns every rule of the policy that the password does not satisfy. The inputs are the
+	// personal details of the user, such as their username and email, that the password may not be based on.
+	// An error is returned when the password could not be checked
+	Check(ctx context.Context, password string, inputs ...string) ([]string, error)
+}
+
+type policy struct {
+	cfg      Config
+	breached map[string]struct{}
+	remote   *checker.Pwnedpasswords
+}
+
+// New returns a Policy for the configuration, loading the breached password list into memory
+func New(cfg Config, client *http.Client) (Policy, error) {
+
+	if !cfg.RemoteCheck.Valid() {
+		return nil, fmt.Errorf("invalid remote check %s, expected one of %v", cfg.RemoteCheck, AllRemoteChecks)
+	}
+
+	if cfg.MinScore < 0 || cfg.MinScore > 4 {
+		return nil, fmt.Errorf("invalid minimum score %d, expected a value between 0 and 4", cfg.MinScore)
+	}
+
+	p := &policy{
+		cfg:      cfg,
+		breached: make(map[string]struct{}),
+	}
+
+	if cfg.RemoteCheck != RemoteCheckOff {
+		p.remote = &checker.Pwnedpasswords{
+			HTTPClient: client,
+		}
+	}
+
+	if cfg.BreachedList != "" {
+		err := p.loadBreachedList(cfg.BreachedList)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+
+}
+
+func (p *policy) Check(ctx context.Context, password string, inputs ...string) ([]string, error) {
+
+	var unmet []string
+
+	if utf8.RuneCountInString(password) < p.cfg.MinLength {
+		unmet = append(unmet, fmt.Sprintf("must be at least %d characters long", p.cfg.MinLength))
+	}
+
+	if len(password) > maxBytes {
+		unmet = append(unmet, fmt.Sprintf("must be at most %d bytes long", maxBytes))
+	}
+
+	lower := strings.ToLower(password)
+	for _, input := range personalInputs(inputs) {
+		if strings.Contains(lower, input) {
+			unmet = append(unmet, "must not contain your name, username or email address")
+			break
+		}
+	}
+
+	if zxcvbn.PasswordStrength(password, inputs).Score < p.cfg.MinScore {
+		unmet = append(unmet, "is too easy to guess, try a longer password or one made of several uncommon words")
+	}
+
+	digest := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(digest[:]))
+
+	if _, ok := p.breached[hash]; ok {
+		unmet = append(unmet, "has appeared in a data breach and cannot be used")
+		return unmet, nil
+	}
+
+	if p.remote != nil {
+		safe, _, err := p.remote.CheckPassword(password)
+		if err != nil {
+			if p.cfg.RemoteCheck == RemoteCheckFailClosed {
+				return nil, fmt.Errorf("failed to check password against breached password api: %w", err)
+			}
+
+			// Failing open, the outage is recorded but the password is judged by the local rules alone
+			middleware.LogEntrySetError(ctx, fmt.Errorf("skipped breached password api check: %w", err))
+			return unmet, nil
+		}
+
+		if !safe {
+			unmet = append(unmet, "has appeared in a data breach and cannot be used")
+		}
+	}
+
+	return unmet, nil
+
+}
+
+func (p *policy) loadBreachedList(file string) error {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if hash := strings.SplitN(line, ":", 2)[0]; isSHA1(hash) {
+			p.breached[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+
+		digest := sha1.Sum([]byte(line))
+		p.breached[strings.ToUpper(hex.EncodeToString(digest[:]))] = struct{}{}
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return fmt.Errorf("failed to read breached password list: %w", err)
+	}
+
+	return nil
+
+}
+
+func isSHA1(value string) bool {
+
+	if len(value) != sha1.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(value)
+
+	return err == nil
+
+}
+
+// personalInputs lowercases the inputs, splitting email addresses so that the
+// local part is matched on its own. Inputs that are too short to be meaningful are dropped
+func personalInputs(inputs []string) []string {
+
+	var personal []string
+	for _, input := range inputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+
+		candidates := []string{input}
+		if i := strings.Index(input, "@"); i > 0 {
+			candidates = append(candidates, input[:i])
+		}
+
+		for _, candidate := range candidates {
+			if len(candidate) >= 3 {
+				personal = append(personal, candidate)
+			}
+		}
+	}
+
+	return personal
+
+}
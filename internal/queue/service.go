@@ -0,0 +1,554 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/internal"
+	"github.com/embersyndicate/support/internal/audit"
+	"github.com/embersyndicate/support/internal/category"
+	"github.com/embersyndicate/support/pkg/middleware"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Service interface {
+	support.QueueRepository
+	QueueTickets(ctx context.Context, id string, operators ...*support.Operator) (*support.QueueListing, error)
+	ClaimNextTicket(ctx context.Context, id string) (*support.Ticket, error)
+	AssignTicket(ctx context.Context, ticketID string, assignee primitive.ObjectID) (*support.Ticket, error)
+	UnassignTicket(ctx context.Context, ticketID string) (*support.Ticket, error)
+	AutoAssignTicket(ctx context.Context, ticket *support.Ticket) (*support.Ticket, error)
+}
+
+type service struct {
+	support.QueueRepository
+	tickets    support.TicketRepository
+	users      support.UserRepository
+	categories category.Service
+	audit      audit.Service
+}
+
+func New(queue support.QueueRepository, tickets support.TicketRepository, users support.UserRepository, categories category.Service, audit audit.Service) Service {
+	return &service{
+		QueueRepository: queue,
+		tickets:         tickets,
+		users:           users,
+		categories:      categories,
+		audit:           audit,
+	}
+}
+
+func (s *service) Queue(ctx context.Context, id string) (*support.Queue, error) {
+
+	queue, err := s.QueueRepository.Queue(ctx, id)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to fetch queue %s", id)
+	}
+
+	return queue, nil
+
+}
+
+func (s *service) Queues(ctx context.Context, operators ...*support.Operator) ([]*support.Queue, error) {
+
+	queues, err := s.QueueRepository.Queues(ctx, operators...)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to fetch queues")
+	}
+
+	return queues, nil
+
+}
+
+func (s *service) CreateQueue(ctx context.Context, queue *support.Queue) (*support.Queue, error) {
+
+	err := queue.ValidateAttributes()
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	err = s.validateQueue(ctx, queue)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := middleware.GetUserObjectIDFromContext(ctx)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to retrieve user id from context")
+	}
+
+	now := time.Now()
+	queue.Cursor = 0
+	queue.CreatedAt = now
+	queue.CreatedBy = userID
+	queue.UpdatedAt = now
+	queue.UpdatedBy = userID
+
+	queue, err = s.QueueRepository.CreateQueue(ctx, queue)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		if internal.IsUniqueConstrainViolation(err) {
+			return nil, internal.NewConflictError("queue name is already in use", "name")
+		}
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to create queue")
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityQueue,
+		EntityID: queue.ID,
+		Action:   support.AuditActionCreate,
+	}, nil, queue)
+
+	return queue, nil
+
+}
+
+// UpdateQueue replaces the name, categories, agents and assignment of the queue
+func (s *service) UpdateQueue(ctx context.Context, id string, queue *support.Queue) (*support.Queue, error) {
+
+	err := queue.ValidateAttributes()
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	err = s.validateQueue(ctx, queue)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := middleware.GetUserObjectIDFromContext(ctx)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to retrieve user id from context")
+	}
+
+	current, err := s.Queue(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	queue.Cursor = current.Cursor
+	queue.CreatedAt = current.CreatedAt
+	queue.CreatedBy = current.CreatedBy
+	queue.UpdatedAt = time.Now()
+	queue.UpdatedBy = userID
+
+	queue, err = s.QueueRepository.UpdateQueue(ctx, id, queue)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		if internal.IsUniqueConstrainViolation(err) {
+			return nil, internal.NewConflictError("queue name is already in use", "name")
+		}
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to update queue %s", id))
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityQueue,
+		EntityID: queue.ID,
+		Action:   support.AuditActionUpdate,
+	}, current, queue)
+
+	return queue, nil
+
+}
+
+// DeleteQueue removes the queue. Tickets are never owned by a queue, so they are left untouched
+func (s *service) DeleteQueue(ctx context.Context, id string) error {
+
+	queue, err := s.Queue(ctx, id)
+	if err != nil {
+		return internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	err = s.QueueRepository.DeleteQueue(ctx, id)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to delete queue %s", id))
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityQueue,
+		EntityID: queue.ID,
+		Action:   support.AuditActionDelete,
+	}, queue, nil)
+
+	return nil
+
+}
+
+// QueueTickets returns the queue along with its unassigned tickets, oldest first.
+// Tickets in a locked status have been closed, so they are never waiting in a queue
+func (s *service) QueueTickets(ctx context.Context, id string, operators ...*support.Operator) (*support.QueueListing, error) {
+
+	queue, err := s.Queue(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	filters, err := s.ticketOperators(ctx, queue)
+	if err != nil {
+		return nil, err
+	}
+
+	operators = append(operators, filters...)
+	operators = append(operators,
+		support.NewExistsOperator("assignedTo", false),
+		support.NewOrderOperator("createdAt", support.SortAsc),
+	)
+
+	tickets, err := s.tickets.Tickets(ctx, operators...)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to fetch tickets of queue %s", id))
+	}
+
+	return &support.QueueListing{
+		Queue:   queue,
+		Tickets: tickets,
+	}, nil
+
+}
+
+// ClaimNextTicket assigns the oldest unassigned ticket of the queue to the agent making the request.
+// Only the agents of the queue may claim its tickets. A nil ticket is returned when the queue is empty
+func (s *service) ClaimNextTicket(ctx context.Context, id string) (*support.Ticket, error) {
+
+	userID, err := middleware.GetUserObjectIDFromContext(ctx)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to retrieve user id from context")
+	}
+
+	queue, err := s.Queue(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	if !queue.HasAgent(userID) {
+		return nil, internal.NewInternalError(internal.LevelForbidden, fmt.Sprintf("only the agents of queue %s may claim its tickets", queue.Name))
+	}
+
+	operators, err := s.ticketOperators(ctx, queue)
+	if err != nil {
+		return nil, err
+	}
+
+	ticket, err := s.tickets.ClaimTicket(ctx, userID, time.Now(), operators...)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to claim ticket from queue %s", id))
+	}
+
+	if ticket == nil {
+		return nil, nil
+	}
+
+	s.recordAssignment(ctx, ticket, nil)
+
+	return ticket, nil
+
+}
+
+// AssignTicket assigns the ticket to the assignee, who must be an agent
+func (s *service) AssignTicket(ctx context.Context, ticketID string, assignee primitive.ObjectID) (*support.Ticket, error) {
+
+	if !middleware.HasPermissionFromContext(ctx, support.PermissionAssignTickets.String()) {
+		return nil, internal.NewInternalError(internal.LevelForbidden, "only agents may assign tickets")
+	}
+
+	ticket, err := s.ticket(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.checkAgent(ctx, assignee)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	if ticket.AssignedTo != nil && *ticket.AssignedTo == assignee {
+		return ticket, nil
+	}
+
+	return s.assign(ctx, ticket, &assignee)
+
+}
+
+// UnassignTicket removes the assignee of the ticket, returning it to the queues that hold its category
+func (s *service) UnassignTicket(ctx context.Context, ticketID string) (*support.Ticket, error) {
+
+	if !middleware.HasPermissionFromContext(ctx, support.PermissionAssignTickets.String()) {
+		return nil, internal.NewInternalError(internal.LevelForbidden, "only agents may unassign tickets")
+	}
+
+	ticket, err := s.ticket(ctx, ticketID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ticket.AssignedTo == nil {
+		return ticket, nil
+	}
+
+	return s.assign(ctx, ticket, nil)
+
+}
+
+// AutoAssignTicket assigns a newly created ticket to an agent of the queue that holds its category,
+// using the assignment strategy of the queue. Queues that hold a category nested more deeply take
+// precedence over the queues of its parents. The ticket is returned unchanged when no queue that
+// holds its category assigns tickets automatically, or when none of its agents can be assigned tickets
+func (s *service) AutoAssignTicket(ctx context.Context, ticket *support.Ticket) (*support.Ticket, error) {
+
+	if ticket.AssignedTo != nil {
+		return ticket, nil
+	}
+
+	queue, err := s.assigningQueue(ctx, ticket.CategoryID)
+	if err != nil || queue == nil {
+		return ticket, err
+	}
+
+	// Agents may have been deleted or lost their permissions since they were added to the queue
+	agents := make([]primitive.ObjectID, 0, len(queue.Agents))
+	for _, id := range queue.Agents {
+		if s.checkAgent(ctx, id) == nil {
+			agents = append(agents, id)
+		}
+	}
+
+	if len(agents) == 0 {
+		return ticket, nil
+	}
+
+	var agent primitive.ObjectID
+	switch queue.Assignment {
+	case support.AssignmentRoundRobin:
+		cursor, err := s.QueueRepository.AdvanceQueue(ctx, queue.ID)
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+			return ticket, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to advance queue %s", queue.ID.Hex()))
+		}
+
+		agent = agents[(cursor-1)%int64(len(agents))]
+	case support.AssignmentLeastLoaded:
+		operators, err := s.openOperators(ctx)
+		if err != nil {
+			return ticket, err
+		}
+
+		counts, err := s.tickets.AssignedTicketCounts(ctx, agents, operators...)
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+			return ticket, internal.NewInternalError(internal.LevelInternal, "failed to count the open tickets of agents")
+		}
+
+		// Ties are broken by the order of the agents of the queue
+		agent = agents[0]
+		for _, candidate := range agents[1:] {
+			if counts[candidate] < counts[agent] {
+				agent = candidate
+			}
+		}
+	default:
+		return ticket, nil
+	}
+
+	return s.assign(ctx, ticket, &agent)
+
+}
+
+// assigningQueue returns the queue that automatically assigns the tickets of the category,
+// searching the category itself before its parents. A nil queue is returned when there is none
+func (s *service) assigningQueue(ctx context.Context, categoryID primitive.ObjectID) (*support.Queue, error) {
+
+	ancestors, err := s.categories.Ancestors(ctx, categoryID.Hex())
+	if err != nil {
+		return nil, err
+	}
+
+	chain := []primitive.ObjectID{categoryID}
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		chain = append(chain, ancestors[i].ID)
+	}
+
+	for _, id := range chain {
+		queues, err := s.Queues(
+			ctx,
+			support.NewEqualOperator("categories", id),
+			support.NewInOperator("assignment", []support.Assignment{support.AssignmentRoundRobin, support.AssignmentLeastLoaded}),
+			support.NewOrderOperator("createdAt", support.SortAsc),
+			support.NewLimitOperator(1),
+		)
+		if err != nil {
+			return nil, internal.NewInternalError(internal.LevelInternal, err.Error())
+		}
+
+		if len(queues) > 0 && len(queues[0].Agents) > 0 {
+			return queues[0], nil
+		}
+	}
+
+	return nil, nil
+
+}
+
+// assign assigns the ticket to the assignee, or unassigns it when assignee is nil, and returns the stored ticket.
+// The provided ticket is left untouched, so it still describes the previous assignee in the audit trail
+func (s *service) assign(ctx context.Context, ticket *support.Ticket, assignee *primitive.ObjectID) (*support.Ticket, error) {
+
+	var updated *support.Ticket
+	var err error
+	if assignee == nil {
+		updated, err = s.tickets.UnassignTicket(ctx, ticket.ID, time.Now())
+	} else {
+		updated, err = s.tickets.AssignTicket(ctx, ticket.ID, *assignee, time.Now())
+	}
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to assign ticket %s", ticket.ID.Hex()))
+	}
+
+	s.recordAssignment(ctx, updated, ticket.AssignedTo)
+
+	return updated, nil
+
+}
+
+// recordAssignment records the change of the assignee of the ticket from previous in the audit trail
+func (s *service) recordAssignment(ctx context.Context, ticket *support.Ticket, previous *primitive.ObjectID) {
+
+	before := *ticket
+	before.AssignedTo = previous
+
+	action := support.AuditActionAssign
+	if ticket.AssignedTo == nil {
+		action = support.AuditActionUnassign
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityTicket,
+		EntityID: ticket.ID,
+		Action:   action,
+	}, &before, ticket)
+
+}
+
+// ticketOperators returns the operators that match the open tickets of the categories of the queue
+// and of every category nested beneath them
+func (s *service) ticketOperators(ctx context.Context, queue *support.Queue) ([]*support.Operator, error) {
+
+	categories := make([]primitive.ObjectID, 0, len(queue.Categories))
+	for _, id := range queue.Categories {
+		categories = append(categories, id)
+
+		// Categories that have been deleted since the queue was saved no longer hold any tickets
+		descendants, err := s.categories.Descendants(ctx, id.Hex())
+		if err != nil {
+			continue
+		}
+
+		for _, descendant := range descendants {
+			categories = append(categories, descendant.ID)
+		}
+	}
+
+	operators, err := s.openOperators(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(operators, support.NewInOperator("categoryID", categories)), nil
+
+}
+
+// openOperators returns the operators that exclude tickets in a locked status
+func (s *service) openOperators(ctx context.Context) ([]*support.Operator, error) {
+
+	locked, err := s.tickets.TicketStatuses(ctx, support.NewEqualOperator("locked", true))
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to fetch locked ticket statuses")
+	}
+
+	if len(locked) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(locked))
+	for i, status := range locked {
+		ids[i] = status.ID
+	}
+
+	return []*support.Operator{support.NewNotInOperator("statusID", ids)}, nil
+
+}
+
+// validateQueue confirms that the categories of the queue exist and that every agent of the queue is an agent
+func (s *service) validateQueue(ctx context.Context, queue *support.Queue) error {
+
+	var errs = make([]internal.FieldError, 0)
+
+	categories, err := s.categories.Categories(ctx, support.NewInOperator("_id", queue.Categories))
+	if err != nil {
+		return internal.NewInternalError(internal.LevelInternal, err.Error())
+	}
+
+	found := make(map[primitive.ObjectID]bool, len(categories))
+	for _, category := range categories {
+		found[category.ID] = true
+	}
+
+	for _, id := range queue.Categories {
+		if !found[id] {
+			errs = append(errs, internal.FieldError{Field: "categories", Message: fmt.Sprintf("unknown category %s", id.Hex())})
+		}
+	}
+
+	for _, id := range queue.Agents {
+		err := s.checkAgent(ctx, id)
+		if err != nil {
+			errs = append(errs, internal.FieldError{Field: "agents", Message: err.Error()})
+		}
+	}
+
+	if len(errs) > 0 {
+		return internal.NewValidationError("queue failed validation", errs)
+	}
+
+	return nil
+
+}
+
+// checkAgent returns an error when the user identified by id does not exist or cannot be assigned tickets
+func (s *service) checkAgent(ctx context.Context, id primitive.ObjectID) error {
+
+	user, err := s.users.User(ctx, id.Hex())
+	if err != nil || user.DeletedAt != nil {
+		return fmt.Errorf("unknown user %s", id.Hex())
+	}
+
+	if !user.HasPermission(support.PermissionReadAllTickets) {
+		return fmt.Errorf("user %s is not an agent", id.Hex())
+	}
+
+	return nil
+
+}
+
+func (s *service) ticket(ctx context.Context, id string) (*support.Ticket, error) {
+
+	ticket, err := s.tickets.Ticket(ctx, id)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("failed to fetch ticket %s", id))
+	}
+
+	return ticket, nil
+
+}
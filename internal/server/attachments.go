@@ -0,0 +1,159 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/embersyndicate/support/pkg/middleware"
+	"github.com/go-chi/chi"
+)
+
+func (s *server) handleV1GetTicketAttachments(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	ticketID := chi.URLParam(r, "ticketID")
+	if ticketID == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("ticketID is required, empty value received"), false)
+		return
+	}
+
+	attachments, err := s.attachment.TicketAttachments(ctx, ticketID)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, attachments)
+
+}
+
+func (s *server) handleV1PostTicketAttachments(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	ticketID := chi.URLParam(r, "ticketID")
+	if ticketID == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("ticketID is required, empty value received"), false)
+		return
+	}
+
+	s.uploadAttachment(w, r, ticketID)
+
+}
+
+// handleV1PostAttachments uploads a pending attachment, which is attached to a ticket
+// once it is submitted as the value of a file field
+func (s *server) handleV1PostAttachments(w http.ResponseWriter, r *http.Request) {
+	s.uploadAttachment(w, r, "")
+}
+
+// multipartOverhead is the room left in an upload for the boundaries, headers and other parts around the file
+const multipartOverhead = 64 << 10
+
+// uploadAttachment streams the file part of a multipart/form-data request to the attachment service
+func (s *server) uploadAttachment(w http.ResponseWriter, r *http.Request, ticketID string) {
+
+	var ctx = r.Context()
+
+	// The attachment service bounds the file part, but any other part would be read and discarded without limit
+	r.Body = http.MaxBytesReader(w, r.Body, s.attachment.MaxSize()+multipartOverhead)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("expected a multipart/form-data request body: %w", err), false)
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("file is required, empty value received"), false)
+			return
+		}
+		// http.MaxBytesReader does not return an error of its own type to check for
+		if err != nil && strings.Contains(err.Error(), "request body too large") {
+			s.writeError(ctx, w, http.StatusRequestEntityTooLarge, fmt.Errorf("request body cannot be larger than %d bytes", s.attachment.MaxSize()+multipartOverhead), false)
+			return
+		}
+		if err != nil {
+			s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+			return
+		}
+
+		if part.FormName() != "file" {
+			continue
+		}
+
+		attachment, err := s.attachment.UploadAttachment(ctx, ticketID, part.FileName(), part)
+		if err != nil {
+			s.writeError(ctx, w, http.StatusBadRequest, err, false)
+			return
+		}
+
+		s.writeResponse(ctx, w, http.StatusCreated, attachment)
+		return
+	}
+
+}
+
+func (s *server) handleV1GetAttachment(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	attachmentID := chi.URLParam(r, "attachmentID")
+	if attachmentID == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("attachmentID is required, empty value received"), false)
+		return
+	}
+
+	attachment, err := s.attachment.Attachment(ctx, attachmentID)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, attachment)
+
+}
+
+func (s *server) handleV1GetAttachmentDownload(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	attachmentID := chi.URLParam(r, "attachmentID")
+	if attachmentID == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("attachmentID is required, empty value received"), false)
+		return
+	}
+
+	query := r.URL.Query()
+	attachment, content, err := s.attachment.OpenAttachment(ctx, attachmentID, query.Get("expires"), query.Get("signature"))
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+	defer content.Close()
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+
+	// Attachments are served as downloads with the detected type, so browsers never render them as a page
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	_, err = io.Copy(w, content)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+	}
+
+}
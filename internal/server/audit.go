@@ -0,0 +1,48 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+func (s *server) handleV1GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	operators, err := parseAuditOperators(r.URL.Query())
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	events, err := s.audit.AuditEvents(ctx, operators...)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, events)
+
+}
+
+func (s *server) handleV1GetTicketHistory(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	ticketID := chi.URLParam(r, "ticketID")
+	if ticketID == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("ticketID is required, empty value received"), false)
+		return
+	}
+
+	events, err := s.audit.TicketHistory(ctx, ticketID)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, events)
+
+}
@@ -1,9 +1,11 @@
 package server
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/embersyndicate/support"
 	"github.com/embersyndicate/support/pkg/middleware"
 )
 
@@ -32,9 +34,58 @@ func (s *server) auth(next http.Handler) http.Handler {
 		}
 
 		ctx = middleware.SetUserIDOnContext(ctx, id)
+		ctx = middleware.SetRoleOnContext(ctx, s.token.GetRoleFromToken(parsed))
+		ctx = middleware.SetPermissionsOnContext(ctx, s.token.GetPermissionsFromToken(parsed))
 		ctx = middleware.SetTokenOnContext(ctx, parsed)
 		next.ServeHTTP(w, r.WithContext(ctx))
 
 	})
 
 }
+
+// authorize returns a middleware that refuses the request with a 403 unless
+// the authenticated user has been granted the provided permission
+func (s *server) authorize(permission support.Permission) func(http.Handler) http.Handler {
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			var ctx = r.Context()
+
+			if !middleware.HasPermissionFromContext(ctx, permission.String()) {
+				s.writeError(ctx, w, http.StatusForbidden, fmt.Errorf("missing required permission %s", permission), false)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+
+		})
+	}
+
+}
+
+// verified refuses the request with a 403 unless the authenticated user has verified their email address
+func (s *server) verified(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var ctx = r.Context()
+
+		id, _ := middleware.GetUserIDFromContext(ctx)
+
+		user, err := s.user.User(ctx, id)
+		if err != nil {
+			s.writeError(ctx, w, http.StatusUnauthorized, err, false)
+			return
+		}
+
+		if !user.EmailVerified() {
+			s.writeError(ctx, w, http.StatusForbidden, fmt.Errorf("email address must be verified before this action can be performed"), false)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+
+	})
+
+}
@@ -7,13 +7,20 @@ import (
 
 	"github.com/embersyndicate/support"
 	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func (s *server) handleV1GetCategories(w http.ResponseWriter, r *http.Request) {
 
 	var ctx = r.Context()
 
-	categories, err := s.category.Categories(ctx)
+	operators, err := parseQuery(r.URL.Query(), categoryColumns)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	categories, err := s.category.Categories(ctx, operators...)
 	if err != nil {
 		s.writeError(ctx, w, http.StatusBadRequest, err, false)
 		return
@@ -88,13 +95,202 @@ func (s *server) handleV1PatchCategory(w http.ResponseWriter, r *http.Request) {
 
 	_, err = s.category.UpdateCategory(ctx, id, category)
 	if err != nil {
-		s.writeError(ctx, w, http.StatusInternalServerError,
-			fmt.Errorf("failed to update category"),
-			false,
-		)
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusNoContent, nil)
+
+}
+
+func (s *server) handleV1GetCategoryTree(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	tree, err := s.category.Tree(ctx)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, tree)
+
+}
+
+func (s *server) handleV1GetCategoryAncestors(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "categoryID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("categoryID is required, empty value received"), false)
+		return
+	}
+
+	ancestors, err := s.category.Ancestors(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, ancestors)
+
+}
+
+func (s *server) handleV1GetCategoryDescendants(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "categoryID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("categoryID is required, empty value received"), false)
+		return
+	}
+
+	descendants, err := s.category.Descendants(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, descendants)
+
+}
+
+func (s *server) handleV1PostCategoryMove(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "categoryID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("categoryID is required, empty value received"), false)
+		return
+	}
+
+	// A null or absent parentID moves the category to the root of the tree
+	var body struct {
+		ParentID *primitive.ObjectID `json:"parentID"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	category, err := s.category.MoveCategory(ctx, id, body.ParentID)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, category)
+
+}
+
+// handleV1DeleteCategory deletes a category. When the reassignTo query parameter names another category,
+// the tickets and child categories of the category are moved into it first, otherwise a category that is
+// still in use cannot be deleted
+func (s *server) handleV1DeleteCategory(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "categoryID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("categoryID is required, empty value received"), false)
+		return
+	}
+
+	if to := r.URL.Query().Get("reassignTo"); to != "" {
+		if to == id {
+			s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("a category cannot be reassigned to itself"), false)
+			return
+		}
+
+		err := s.category.ReassignCategory(ctx, id, to)
+		if err != nil {
+			s.writeError(ctx, w, http.StatusBadRequest, err, false)
+			return
+		}
+	}
+
+	err := s.category.DeleteCategory(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
 		return
 	}
 
 	s.writeResponse(ctx, w, http.StatusNoContent, nil)
 
 }
+
+func (s *server) handleV1GetCategoryDefinitions(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "categoryID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("categoryID is required, empty value received"), false)
+		return
+	}
+
+	definitions, err := s.category.CategoryDefinitions(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, definitions)
+
+}
+
+func (s *server) handleV1PostCategoryDefinition(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "categoryID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("categoryID is required, empty value received"), false)
+		return
+	}
+
+	definitionID := chi.URLParam(r, "definitionID")
+	if definitionID == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("definitionID is required, empty value received"), false)
+		return
+	}
+
+	category, err := s.category.AddCategoryDefinition(ctx, id, definitionID)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, category)
+
+}
+
+func (s *server) handleV1DeleteCategoryDefinition(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "categoryID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("categoryID is required, empty value received"), false)
+		return
+	}
+
+	definitionID := chi.URLParam(r, "definitionID")
+	if definitionID == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("definitionID is required, empty value received"), false)
+		return
+	}
+
+	category, err := s.category.RemoveCategoryDefinition(ctx, id, definitionID)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, category)
+
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/internal"
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *server) handleV1GetTicketComments(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	ticketID := chi.URLParam(r, "ticketID")
+	if ticketID == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("ticketID is required, empty value received"), false)
+		return
+	}
+
+	comments, err := s.comment.TicketComments(ctx, ticketID)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, comments)
+
+}
+
+func (s *server) handleV1PostTicketComments(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	ticketID := chi.URLParam(r, "ticketID")
+	if ticketID == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("ticketID is required, empty value received"), false)
+		return
+	}
+
+	_ticketID, err := primitive.ObjectIDFromHex(ticketID)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("unable to cast %s to ObjectID", ticketID), false)
+		return
+	}
+
+	var body struct {
+		Body     string `json:"body"`
+		Internal bool   `json:"internal"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	comment, err := s.comment.CreateComment(ctx, &support.Comment{
+		TicketID: _ticketID,
+		Body:     body.Body,
+		Internal: body.Internal,
+	})
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusCreated, comment)
+
+}
+
+func (s *server) handleV1PatchTicketComment(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	commentID, err := s.ticketComment(ctx, r)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	var body struct {
+		Body string `json:"body"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	comment, err := s.comment.UpdateComment(ctx, commentID, &support.Comment{Body: body.Body})
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, comment)
+
+}
+
+func (s *server) handleV1DeleteTicketComment(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	commentID, err := s.ticketComment(ctx, r)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	err = s.comment.DeleteComment(ctx, commentID)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusNoContent, nil)
+
+}
+
+// ticketComment returns the id of the comment addressed by the request after
+// confirming that the comment belongs to the ticket addressed by the request
+func (s *server) ticketComment(ctx context.Context, r *http.Request) (string, error) {
+
+	ticketID := chi.URLParam(r, "ticketID")
+	if ticketID == "" {
+		return "", fmt.Errorf("ticketID is required, empty value received")
+	}
+
+	commentID := chi.URLParam(r, "commentID")
+	if commentID == "" {
+		return "", fmt.Errorf("commentID is required, empty value received")
+	}
+
+	comment, err := s.comment.Comment(ctx, commentID)
+	if err != nil {
+		return "", err
+	}
+
+	if comment.TicketID.Hex() != ticketID {
+		return "", internal.NewInternalError(internal.LevelBad, fmt.Sprintf("comment %s does not belong to ticket %s", commentID, ticketID))
+	}
+
+	return commentID, nil
+
+}
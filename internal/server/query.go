@@ -0,0 +1,685 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/embersyndicate/support"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultTicketLimit int64 = 50
+	defaultAuditLimit  int64 = 50
+	maxLimit           int64 = 100
+)
+
+// columnType dictates how the raw string values of a filter are coerced before being handed to an operator
+type columnType int
+
+const (
+	columnString columnType = iota
+	columnObjectID
+	columnDate
+	columnNumber
+	columnBoolean
+)
+
+type queryColumn struct {
+	Type     columnType
+	Sortable bool
+}
+
+// queryColumns is the whitelist of columns that a resource can be filtered and sorted by
+type queryColumns map[string]queryColumn
+
+var categoryColumns = queryColumns{
+	"name":      {Type: columnString, Sortable: true},
+	"parentID":  {Type: columnObjectID},
+	"createdBy": {Type: columnObjectID},
+	"createdAt": {Type: columnDate, Sortable: true},
+	"updatedBy": {Type: columnObjectID},
+	"updatedAt": {Type: columnDate, Sortable: true},
+}
+
+var ticketStatusColumns = queryColumns{
+	"name":      {Type: columnString, Sortable: true},
+	"locked":    {Type: columnBoolean},
+	"default":   {Type: columnBoolean},
+	"createdBy": {Type: columnObjectID},
+	"createdAt": {Type: columnDate, Sortable: true},
+	"updatedAt": {Type: columnDate, Sortable: true},
+}
+
+var ticketDefinitionColumns = queryColumns{
+	"name":      {Type: columnString, Sortable: true},
+	"fields":    {Type: columnObjectID},
+	"version":   {Type: columnNumber, Sortable: true},
+	"disabled":  {Type: columnBoolean},
+	"createdBy": {Type: columnObjectID},
+	"createdAt": {Type: columnDate, Sortable: true},
+	"updatedAt": {Type: columnDate, Sortable: true},
+}
+
+var fieldDefinitionColumns = queryColumns{
+	"name":      {Type: columnString, Sortable: true},
+	"kind":      {Type: columnString, Sortable: true},
+	"required":  {Type: columnBoolean},
+	"hidden":    {Type: columnBoolean},
+	"hash":      {Type: columnBoolean},
+	"disabled":  {Type: columnBoolean},
+	"createdBy": {Type: columnObjectID},
+	"createdAt": {Type: columnDate, Sortable: true},
+	"updatedAt": {Type: columnDate, Sortable: true},
+}
+
+var ticketColumns = queryColumns{
+	"statusID":     {Type: columnObjectID},
+	"categoryID":   {Type: columnObjectID},
+	"assignedTo":   {Type: columnObjectID},
+	"submittedBy":  {Type: columnObjectID},
+	"definitionID": {Type: columnObjectID},
+	"createdAt":    {Type: columnDate, Sortable: true},
+	"updatedAt":    {Type: columnDate, Sortable: true},
+
+	support.SLAColumnPolicyID:                {Type: columnObjectID},
+	support.SLAColumnFirstResponseDue:        {Type: columnDate, Sortable: true},
+	support.SLAColumnResolutionDue:           {Type: columnDate, Sortable: true},
+	support.SLAColumnFirstRespondedAt:        {Type: columnDate},
+	support.SLAColumnResolvedAt:              {Type: columnDate},
+	support.SLAColumnFirstResponseBreachedAt: {Type: columnDate},
+	support.SLAColumnResolutionBreachedAt:    {Type: columnDate},
+	support.SLAColumnPausedAt:                {Type: columnDate},
+}
+
+var queueColumns = queryColumns{
+	"name":       {Type: columnString, Sortable: true},
+	"categories": {Type: columnObjectID},
+	"agents":     {Type: columnObjectID},
+	"assignment": {Type: columnString},
+	"createdBy":  {Type: columnObjectID},
+	"createdAt":  {Type: columnDate, Sortable: true},
+	"updatedAt":  {Type: columnDate, Sortable: true},
+}
+
+var slaPolicyColumns = queryColumns{
+	"name":          {Type: columnString, Sortable: true},
+	"categories":    {Type: columnObjectID},
+	"definitions":   {Type: columnObjectID},
+	"pauseStatuses": {Type: columnObjectID},
+	"createdBy":     {Type: columnObjectID},
+	"createdAt":     {Type: columnDate, Sortable: true},
+	"updatedAt":     {Type: columnDate, Sortable: true},
+}
+
+var auditColumns = queryColumns{
+	"actorID":    {Type: columnObjectID},
+	"entityType": {Type: columnString},
+	"entityID":   {Type: columnObjectID},
+	"parentID":   {Type: columnObjectID},
+	"action":     {Type: columnString},
+	"requestID":  {Type: columnString},
+	"createdAt":  {Type: columnDate, Sortable: true},
+}
+
+// filterOperations maps the operation segment of a filter parameter to the operation it represents
+var filterOperations = map[string]support.Operation{
+	"eq":     support.EqualOp,
+	"ne":     support.NotEqualOp,
+	"gt":     support.GreaterThanOp,
+	"gte":    support.GreaterThanEqualToOp,
+	"lt":     support.LessThanOp,
+	"lte":    support.LessThanEqualToOp,
+	"in":     support.InOp,
+	"nin":    support.NotInOp,
+	"exists": support.ExistsOp,
+	"prefix": support.PrefixOp,
+	"ieq":    support.EqualFoldOp,
+	"size":   support.SizeOp,
+}
+
+// unsupportedOperations are the operations that BuildFilters understands but that are not exposed to clients.
+// Regular expressions supplied by a client could be made to backtrack for a long time on the database, and
+// elemMatch conditions address the attributes of array elements, which are not part of any column whitelist
+var unsupportedOperations = map[string]string{
+	"regex":     "use prefix or ieq instead",
+	"iregex":    "use prefix or ieq instead",
+	"elemMatch": "use eq, in or size instead",
+}
+
+// parseQuery converts the filter, sort, limit and skip parameters of a list request into operators,
+// rejecting any column that is not present in the provided whitelist. Filters take the form of
+//
+//	filter[column]=value
+//	filter[column][operation]=value
+//	filter[or][0][column][operation]=value&filter[or][1][column][operation]=value
+//
+// where the conditions that share an index of an or/and group are and'ed together and groups may be nested.
+// The in and nin operations accept a comma separated list of values. Sort accepts a comma separated list
+// of columns where a leading - sorts that column in descending order.
+func parseQuery(query url.Values, columns queryColumns) ([]*support.Operator, error) {
+
+	root := newFilterNode()
+	for key, values := range query {
+		if !strings.HasPrefix(key, "filter[") {
+			continue
+		}
+
+		path, err := parseFilterKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		root.insert(path, values)
+	}
+
+	operators, err := root.operators(columns)
+	if err != nil {
+		return nil, err
+	}
+
+	sorts, err := parseSort(query.Get("sort"), columns)
+	if err != nil {
+		return nil, err
+	}
+	operators = append(operators, sorts...)
+
+	pagination, err := parsePagination(query)
+	if err != nil {
+		return nil, err
+	}
+	operators = append(operators, pagination...)
+
+	return operators, nil
+
+}
+
+// ticketShorthands maps the shorthand query string parameters accepted by the ticket list endpoint to their column
+var ticketShorthands = map[string]string{
+	"status":     "statusID",
+	"category":   "categoryID",
+	"assignee":   "assignedTo",
+	"submitter":  "submittedBy",
+	"definition": "definitionID",
+}
+
+// parseTicketOperators converts the query string of a ticket list request into operators.
+// In addition to the filters understood by parseQuery, every shorthand id parameter accepts
+// a comma separated list of ObjectIDs, createdAfter and createdBefore accept RFC3339 timestamps
+// and breachingWithin is understood as described by parseBreachingWithin
+func parseTicketOperators(query url.Values) ([]*support.Operator, error) {
+
+	operators, err := parseQuery(query, ticketColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	for param, column := range ticketShorthands {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+
+		ids, err := coerceValues(strings.Split(value, ","), columnObjectID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", param, err)
+		}
+
+		if len(ids) == 1 {
+			operators = append(operators, support.NewEqualOperator(column, ids[0]))
+			continue
+		}
+
+		operators = append(operators, support.NewInOperator(column, ids))
+	}
+
+	if value := query.Get("createdAfter"); value != "" {
+		t, err := coerceValue(value, columnDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for createdAfter: %w", err)
+		}
+
+		operators = append(operators, support.NewGreaterThanEqualToOperator("createdAt", t))
+	}
+
+	if value := query.Get("createdBefore"); value != "" {
+		t, err := coerceValue(value, columnDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for createdBefore: %w", err)
+		}
+
+		operators = append(operators, support.NewLessThanOperator("createdAt", t))
+	}
+
+	breaching, err := parseBreachingWithin(query)
+	if err != nil {
+		return nil, err
+	}
+	if breaching != nil {
+		operators = append(operators, breaching)
+	}
+
+	// Ticket collections grow without bound, so unlike other resources they are always paginated
+	if query.Get("limit") == "" {
+		operators = append(operators, support.NewLimitOperator(defaultTicketLimit))
+	}
+
+	return operators, nil
+
+}
+
+// parseAuditOperators converts the query string of an audit event list request into operators.
+// Like tickets, the audit trail grows without bound, so it is always paginated and returned newest first
+// unless the request asks otherwise
+func parseAuditOperators(query url.Values) ([]*support.Operator, error) {
+
+	operators, err := parseQuery(query, auditColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	if query.Get("sort") == "" {
+		operators = append(operators, support.NewOrderOperator("createdAt", support.SortDesc))
+	}
+
+	if query.Get("limit") == "" {
+		operators = append(operators, support.NewLimitOperator(defaultAuditLimit))
+	}
+
+	return operators, nil
+
+}
+
+// parseBreachingWithin reads the breachingWithin parameter of a ticket list request, a duration such as 30m or 4h,
+// into an operator that matches the tickets that will miss one of their SLA targets within that duration.
+// A nil operator is returned when the parameter is absent
+func parseBreachingWithin(query url.Values) (*support.Operator, error) {
+
+	value := query.Get("breachingWithin")
+	if value == "" {
+		return nil, nil
+	}
+
+	within, err := time.ParseDuration(value)
+	if err != nil || within <= 0 {
+		return nil, fmt.Errorf("invalid value for breachingWithin: %s, expected a positive duration such as 30m or 4h", value)
+	}
+
+	return support.NewBreachingSoonOperator(time.Now(), within), nil
+
+}
+
+// expandFields is the expand option that resolves the field definitions of a ticket definition
+const expandFields = "fields"
+
+// parseExpand reads the comma separated expand parameter of a request,
+// rejecting any value that is not one of the provided options
+func parseExpand(query url.Values, options ...string) (map[string]bool, error) {
+
+	expand := make(map[string]bool)
+	value := query.Get("expand")
+	if value == "" {
+		return expand, nil
+	}
+
+	for _, v := range strings.Split(value, ",") {
+		valid := false
+		for _, option := range options {
+			if v == option {
+				valid = true
+				break
+			}
+		}
+
+		if !valid {
+			return nil, fmt.Errorf("invalid value for expand: %s, expected one of %s", v, strings.Join(options, ", "))
+		}
+
+		expand[v] = true
+	}
+
+	return expand, nil
+
+}
+
+// parseVersion reads the version parameter of a request. An absent version is returned as 0
+func parseVersion(query url.Values) (int, error) {
+
+	value := query.Get("version")
+	if value == "" {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid value for version: %s, expected a positive integer", value)
+	}
+
+	return version, nil
+
+}
+
+// parseIncludeDisabled reads the includeDisabled parameter of a request
+func parseIncludeDisabled(query url.Values) (bool, error) {
+
+	value := query.Get("includeDisabled")
+	if value == "" {
+		return false, nil
+	}
+
+	include, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for includeDisabled: %s, expected a boolean", value)
+	}
+
+	return include, nil
+
+}
+
+// parseFilterKey splits filter[a][b][c] into its segments a, b and c
+func parseFilterKey(key string) ([]string, error) {
+
+	rest := strings.TrimPrefix(key, "filter")
+	path := make([]string, 0)
+	for rest != "" {
+		if !strings.HasPrefix(rest, "[") {
+			return nil, fmt.Errorf("malformed filter %s", key)
+		}
+
+		end := strings.Index(rest, "]")
+		if end < 2 {
+			return nil, fmt.Errorf("malformed filter %s", key)
+		}
+
+		path = append(path, rest[1:end])
+		rest = rest[end+1:]
+	}
+
+	return path, nil
+
+}
+
+type filterNode struct {
+	children map[string]*filterNode
+	values   []string
+}
+
+func newFilterNode() *filterNode {
+	return &filterNode{children: make(map[string]*filterNode)}
+}
+
+func (n *filterNode) insert(path []string, values []string) {
+
+	if len(path) == 0 {
+		n.values = append(n.values, values...)
+		return
+	}
+
+	child, ok := n.children[path[0]]
+	if !ok {
+		child = newFilterNode()
+		n.children[path[0]] = child
+	}
+
+	child.insert(path[1:], values)
+
+}
+
+// keys returns the keys of the children of the node in a stable order so that
+// the same query string always produces the same operators
+func (n *filterNode) keys() []string {
+	keys := make([]string, 0, len(n.children))
+	for key := range n.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// operators converts every child of the node into an operator. All of the resulting operators
+// are expected to match, mirroring how the top level operators of a query are treated
+func (n *filterNode) operators(columns queryColumns) ([]*support.Operator, error) {
+
+	var operators = make([]*support.Operator, 0)
+
+	if len(n.values) > 0 {
+		return nil, fmt.Errorf("filter is missing a column")
+	}
+
+	for _, key := range n.keys() {
+		child := n.children[key]
+
+		switch key {
+		case string(support.OrOp), string(support.AndOp):
+			group, err := child.group(columns)
+			if err != nil {
+				return nil, err
+			}
+
+			if key == string(support.OrOp) {
+				operators = append(operators, support.NewOrOperator(group...))
+				continue
+			}
+
+			operators = append(operators, support.NewAndOperator(group...))
+		default:
+			column, ok := columns[key]
+			if !ok {
+				return nil, fmt.Errorf("unable to filter by %s", key)
+			}
+
+			ops, err := child.columnOperators(key, column)
+			if err != nil {
+				return nil, err
+			}
+
+			operators = append(operators, ops...)
+		}
+	}
+
+	return operators, nil
+
+}
+
+// group converts the indexed children of an or/and node into one operator per index
+func (n *filterNode) group(columns queryColumns) ([]*support.Operator, error) {
+
+	if len(n.values) > 0 || len(n.children) == 0 {
+		return nil, fmt.Errorf("or and and filters must contain indexed conditions")
+	}
+
+	var operators = make([]*support.Operator, 0, len(n.children))
+	for _, key := range n.keys() {
+		if _, err := strconv.Atoi(key); err != nil {
+			return nil, fmt.Errorf("or and and filters must be indexed by number, got %s", key)
+		}
+
+		ops, err := n.children[key].operators(columns)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(ops) == 1 {
+			operators = append(operators, ops[0])
+			continue
+		}
+
+		operators = append(operators, support.NewAndOperator(ops...))
+	}
+
+	return operators, nil
+
+}
+
+func (n *filterNode) columnOperators(name string, column queryColumn) ([]*support.Operator, error) {
+
+	var operators = make([]*support.Operator, 0)
+
+	for _, value := range n.values {
+		v, err := coerceValue(value, column.Type)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+
+		operators = append(operators, support.NewEqualOperator(name, v))
+	}
+
+	for _, key := range n.keys() {
+		child := n.children[key]
+
+		if reason, ok := unsupportedOperations[key]; ok {
+			return nil, fmt.Errorf("operation %s for %s is not supported, %s", key, name, reason)
+		}
+
+		operation, ok := filterOperations[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown operation %s for %s", key, name)
+		}
+
+		if len(child.children) > 0 || len(child.values) == 0 {
+			return nil, fmt.Errorf("operation %s for %s requires a value", key, name)
+		}
+
+		for _, value := range child.values {
+			var v interface{}
+			var err error
+			switch operation {
+			case support.InOp, support.NotInOp:
+				v, err = coerceValues(strings.Split(value, ","), column.Type)
+			case support.ExistsOp:
+				v, err = coerceValue(value, columnBoolean)
+			case support.PrefixOp, support.EqualFoldOp:
+				if column.Type != columnString {
+					return nil, fmt.Errorf("operation %s is not supported for %s", key, name)
+				}
+				v = value
+			case support.SizeOp:
+				v, err = strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					err = fmt.Errorf("%s is not a valid integer", value)
+				}
+			default:
+				v, err = coerceValue(value, column.Type)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for %s: %w", name, err)
+			}
+
+			operators = append(operators, &support.Operator{
+				Column:    name,
+				Operation: operation,
+				Value:     v,
+			})
+		}
+	}
+
+	return operators, nil
+
+}
+
+func coerceValues(values []string, t columnType) ([]interface{}, error) {
+
+	out := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		v, err := coerceValue(strings.TrimSpace(value), t)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+
+	return out, nil
+
+}
+
+func coerceValue(value string, t columnType) (interface{}, error) {
+
+	switch t {
+	case columnObjectID:
+		id, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid id", value)
+		}
+		return id, nil
+	case columnDate:
+		date, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid RFC3339 timestamp", value)
+		}
+		return date, nil
+	case columnNumber:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid number", value)
+		}
+		return number, nil
+	case columnBoolean:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a valid boolean", value)
+		}
+		return b, nil
+	}
+
+	return value, nil
+
+}
+
+func parseSort(value string, columns queryColumns) ([]*support.Operator, error) {
+
+	var operators = make([]*support.Operator, 0)
+	if value == "" {
+		return operators, nil
+	}
+
+	for _, name := range strings.Split(value, ",") {
+		sort := support.SortAsc
+		if strings.HasPrefix(name, "-") {
+			sort = support.SortDesc
+			name = name[1:]
+		}
+
+		if column, ok := columns[name]; !ok || !column.Sortable {
+			return nil, fmt.Errorf("unable to sort by %s", name)
+		}
+
+		operators = append(operators, support.NewOrderOperator(name, sort))
+	}
+
+	return operators, nil
+
+}
+
+func parsePagination(query url.Values) ([]*support.Operator, error) {
+
+	var operators = make([]*support.Operator, 0)
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("limit must be a positive integer")
+		}
+
+		if limit > maxLimit {
+			return nil, fmt.Errorf("limit must be less than or equal to %d", maxLimit)
+		}
+
+		operators = append(operators, support.NewLimitOperator(limit))
+	}
+
+	if value := query.Get("skip"); value != "" {
+		skip, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || skip < 0 {
+			return nil, fmt.Errorf("skip must be a non-negative integer")
+		}
+
+		operators = append(operators, support.NewSkipOperator(skip))
+	}
+
+	return operators, nil
+
+}
@@ -0,0 +1,446 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/embersyndicate/support"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testColumns = queryColumns{
+	"name":      {Type: columnString, Sortable: true},
+	"ownerID":   {Type: columnObjectID},
+	"createdAt": {Type: columnDate, Sortable: true},
+	"version":   {Type: columnNumber, Sortable: true},
+	"disabled":  {Type: columnBoolean},
+	"tags":      {Type: columnString},
+}
+
+func TestParseQuery(t *testing.T) {
+
+	id := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+	date := time.Date(2020, time.December, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []*support.Operator
+		err      string
+	}{
+		{
+			name:     "empty",
+			query:    "",
+			expected: []*support.Operator{},
+		},
+		{
+			name:  "implicit equality",
+			query: "filter[name]=support",
+			expected: []*support.Operator{
+				support.NewEqualOperator("name", "support"),
+			},
+		},
+		{
+			name:  "operations",
+			query: "filter[version][gte]=2&filter[version][lt]=5&filter[createdAt][gt]=" + url.QueryEscape(date.Format(time.RFC3339)),
+			expected: []*support.Operator{
+				support.NewGreaterThanOperator("createdAt", date),
+				support.NewGreaterThanEqualToOperator("version", float64(2)),
+				support.NewLessThanOperator("version", float64(5)),
+			},
+		},
+		{
+			name:  "in nin and exists",
+			query: "filter[ownerID][in]=" + id.Hex() + "," + other.Hex() + "&filter[name][nin]=a,b&filter[disabled][exists]=false",
+			expected: []*support.Operator{
+				support.NewExistsOperator("disabled", false),
+				support.NewNotInOperator("name", []interface{}{"a", "b"}),
+				support.NewInOperator("ownerID", []interface{}{id, other}),
+			},
+		},
+		{
+			name:  "prefix equal fold and size",
+			query: "filter[name][prefix]=sup&filter[name][ieq]=Support&filter[tags][size]=2",
+			expected: []*support.Operator{
+				support.NewEqualFoldOperator("name", "Support"),
+				support.NewPrefixOperator("name", "sup"),
+				support.NewSizeOperator("tags", 2),
+			},
+		},
+		{
+			name:  "or group",
+			query: "filter[or][0][name]=a&filter[or][1][name][ne]=b&filter[or][1][disabled]=true",
+			expected: []*support.Operator{
+				support.NewOrOperator(
+					support.NewEqualOperator("name", "a"),
+					support.NewAndOperator(
+						support.NewEqualOperator("disabled", true),
+						support.NewNotEqualOperator("name", "b"),
+					),
+				),
+			},
+		},
+		{
+			name:  "nested and within or",
+			query: "filter[or][0][and][0][name]=a&filter[or][0][and][1][version][lte]=3&filter[or][1][ownerID]=" + id.Hex(),
+			expected: []*support.Operator{
+				support.NewOrOperator(
+					support.NewAndOperator(
+						support.NewEqualOperator("name", "a"),
+						support.NewLessThanEqualToOperator("version", float64(3)),
+					),
+					support.NewEqualOperator("ownerID", id),
+				),
+			},
+		},
+		{
+			name:  "filters sort and pagination",
+			query: "filter[name]=a&sort=-createdAt,name&limit=10&skip=20",
+			expected: []*support.Operator{
+				support.NewEqualOperator("name", "a"),
+				support.NewOrderOperator("createdAt", support.SortDesc),
+				support.NewOrderOperator("name", support.SortAsc),
+				support.NewLimitOperator(10),
+				support.NewSkipOperator(20),
+			},
+		},
+		{
+			name:  "unknown column",
+			query: "filter[password]=secret",
+			err:   "unable to filter by password",
+		},
+		{
+			name:  "unknown column within group",
+			query: "filter[or][0][password]=secret",
+			err:   "unable to filter by password",
+		},
+		{
+			name:  "unknown operation",
+			query: "filter[name][like]=a",
+			err:   "unknown operation like for name",
+		},
+		{
+			name:  "regex is not exposed",
+			query: "filter[name][regex]=.*",
+			err:   "operation regex for name is not supported, use prefix or ieq instead",
+		},
+		{
+			name:  "insensitive regex is not exposed",
+			query: "filter[name][iregex]=(a+)+$",
+			err:   "operation iregex for name is not supported, use prefix or ieq instead",
+		},
+		{
+			name:  "elem match is not exposed",
+			query: "filter[tags][elemMatch]=a",
+			err:   "operation elemMatch for tags is not supported, use eq, in or size instead",
+		},
+		{
+			name:  "prefix on a non string column",
+			query: "filter[version][prefix]=1",
+			err:   "operation prefix is not supported for version",
+		},
+		{
+			name:  "operation without a value",
+			query: "filter[name][eq][x]=a",
+			err:   "operation eq for name requires a value",
+		},
+		{
+			name:  "group without index",
+			query: "filter[or]=a",
+			err:   "or and and filters must contain indexed conditions",
+		},
+		{
+			name:  "group with non numeric index",
+			query: "filter[and][first][name]=a",
+			err:   "or and and filters must be indexed by number, got first",
+		},
+		{
+			name:  "invalid object id",
+			query: "filter[ownerID]=nope",
+			err:   "invalid value for ownerID: nope is not a valid id",
+		},
+		{
+			name:  "invalid object id within in",
+			query: "filter[ownerID][in]=" + id.Hex() + ",nope",
+			err:   "invalid value for ownerID: nope is not a valid id",
+		},
+		{
+			name:  "invalid date",
+			query: "filter[createdAt][gt]=yesterday",
+			err:   "invalid value for createdAt: yesterday is not a valid RFC3339 timestamp",
+		},
+		{
+			name:  "invalid boolean",
+			query: "filter[disabled]=maybe",
+			err:   "invalid value for disabled: maybe is not a valid boolean",
+		},
+		{
+			name:  "invalid exists",
+			query: "filter[name][exists]=maybe",
+			err:   "invalid value for name: maybe is not a valid boolean",
+		},
+		{
+			name:  "invalid number",
+			query: "filter[version]=two",
+			err:   "invalid value for version: two is not a valid number",
+		},
+		{
+			name:  "invalid size",
+			query: "filter[tags][size]=1.5",
+			err:   "invalid value for tags: 1.5 is not a valid integer",
+		},
+		{
+			name:  "unsortable column",
+			query: "sort=name,-ownerID",
+			err:   "unable to sort by ownerID",
+		},
+		{
+			name:  "limit above maximum",
+			query: "limit=101",
+			err:   "limit must be less than or equal to 100",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			query, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatalf("failed to parse query string: %s", err)
+			}
+
+			operators, err := parseQuery(query, testColumns)
+			assertError(t, err, test.err)
+			if test.err != "" {
+				return
+			}
+
+			if !reflect.DeepEqual(operators, test.expected) {
+				t.Errorf("expected operators %s, got %s", describeOperators(test.expected), describeOperators(operators))
+			}
+
+		})
+	}
+
+}
+
+func TestParseFilterKey(t *testing.T) {
+
+	tests := []struct {
+		key      string
+		expected []string
+		err      string
+	}{
+		{key: "filter[name]", expected: []string{"name"}},
+		{key: "filter[name][in]", expected: []string{"name", "in"}},
+		{key: "filter[or][0][and][1][name][ne]", expected: []string{"or", "0", "and", "1", "name", "ne"}},
+		{key: "filter", expected: []string{}},
+		{key: "filter[]", err: "malformed filter filter[]"},
+		{key: "filter[name", err: "malformed filter filter[name"},
+		{key: "filter[name]x", err: "malformed filter filter[name]x"},
+		{key: "filter[name][in]]", err: "malformed filter filter[name][in]]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+
+			path, err := parseFilterKey(test.key)
+			assertError(t, err, test.err)
+			if test.err != "" {
+				return
+			}
+
+			if !reflect.DeepEqual(path, test.expected) {
+				t.Errorf("expected path %q, got %q", test.expected, path)
+			}
+
+		})
+	}
+
+}
+
+func TestCoerceValue(t *testing.T) {
+
+	id := primitive.NewObjectID()
+
+	tests := []struct {
+		name     string
+		value    string
+		t        columnType
+		expected interface{}
+		err      string
+	}{
+		{name: "string", value: "abc", t: columnString, expected: "abc"},
+		{name: "object id", value: id.Hex(), t: columnObjectID, expected: id},
+		{name: "invalid object id", value: "abc", t: columnObjectID, err: "abc is not a valid id"},
+		{name: "date", value: "2020-12-01T12:00:00Z", t: columnDate, expected: time.Date(2020, time.December, 1, 12, 0, 0, 0, time.UTC)},
+		{name: "date without zone", value: "2020-12-01T12:00:00", t: columnDate, err: "2020-12-01T12:00:00 is not a valid RFC3339 timestamp"},
+		{name: "number", value: "1.5", t: columnNumber, expected: 1.5},
+		{name: "invalid number", value: "1,5", t: columnNumber, err: "1,5 is not a valid number"},
+		{name: "boolean", value: "true", t: columnBoolean, expected: true},
+		{name: "invalid boolean", value: "yes", t: columnBoolean, err: "yes is not a valid boolean"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			v, err := coerceValue(test.value, test.t)
+			assertError(t, err, test.err)
+			if test.err != "" {
+				return
+			}
+
+			if !reflect.DeepEqual(v, test.expected) {
+				t.Errorf("expected %#v, got %#v", test.expected, v)
+			}
+
+		})
+	}
+
+}
+
+func TestParseSort(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		value    string
+		expected []*support.Operator
+		err      string
+	}{
+		{
+			name:     "empty",
+			value:    "",
+			expected: []*support.Operator{},
+		},
+		{
+			name:  "multiple columns",
+			value: "name,-createdAt,version",
+			expected: []*support.Operator{
+				support.NewOrderOperator("name", support.SortAsc),
+				support.NewOrderOperator("createdAt", support.SortDesc),
+				support.NewOrderOperator("version", support.SortAsc),
+			},
+		},
+		{name: "non sortable column", value: "name,disabled", err: "unable to sort by disabled"},
+		{name: "descending non sortable column", value: "-ownerID", err: "unable to sort by ownerID"},
+		{name: "unknown column", value: "password", err: "unable to sort by password"},
+		{name: "empty column", value: "name,", err: "unable to sort by "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			operators, err := parseSort(test.value, testColumns)
+			assertError(t, err, test.err)
+			if test.err != "" {
+				return
+			}
+
+			if !reflect.DeepEqual(operators, test.expected) {
+				t.Errorf("expected operators %s, got %s", describeOperators(test.expected), describeOperators(operators))
+			}
+
+		})
+	}
+
+}
+
+func TestParsePagination(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		query    url.Values
+		expected []*support.Operator
+		err      string
+	}{
+		{
+			name:     "absent",
+			query:    url.Values{},
+			expected: []*support.Operator{},
+		},
+		{
+			name:     "limit at maximum",
+			query:    url.Values{"limit": {"100"}},
+			expected: []*support.Operator{support.NewLimitOperator(100)},
+		},
+		{
+			name:     "limit and skip",
+			query:    url.Values{"limit": {"1"}, "skip": {"0"}},
+			expected: []*support.Operator{support.NewLimitOperator(1), support.NewSkipOperator(0)},
+		},
+		{name: "limit above maximum", query: url.Values{"limit": {"101"}}, err: "limit must be less than or equal to 100"},
+		{name: "zero limit", query: url.Values{"limit": {"0"}}, err: "limit must be a positive integer"},
+		{name: "non numeric limit", query: url.Values{"limit": {"ten"}}, err: "limit must be a positive integer"},
+		{name: "negative skip", query: url.Values{"skip": {"-1"}}, err: "skip must be a non-negative integer"},
+		{name: "non numeric skip", query: url.Values{"skip": {"ten"}}, err: "skip must be a non-negative integer"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			operators, err := parsePagination(test.query)
+			assertError(t, err, test.err)
+			if test.err != "" {
+				return
+			}
+
+			if !reflect.DeepEqual(operators, test.expected) {
+				t.Errorf("expected operators %s, got %s", describeOperators(test.expected), describeOperators(operators))
+			}
+
+		})
+	}
+
+}
+
+// assertError fails the test when err does not match the expected message. An empty message expects no error
+func assertError(t *testing.T, err error, expected string) {
+
+	t.Helper()
+
+	if expected == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return
+	}
+
+	if err == nil {
+		t.Fatalf("expected error %q, got none", expected)
+	}
+
+	if err.Error() != expected {
+		t.Fatalf("expected error %q, got %q", expected, err.Error())
+	}
+
+}
+
+func describeOperators(operators []*support.Operator) string {
+
+	var parts = make([]string, 0, len(operators))
+	for _, op := range operators {
+		parts = append(parts, describeOperator(op))
+	}
+
+	return "[" + strings.Join(parts, ", ") + "]"
+
+}
+
+func describeOperator(op *support.Operator) string {
+
+	if op == nil {
+		return "<nil>"
+	}
+
+	if children, ok := op.Value.([]*support.Operator); ok {
+		return fmt.Sprintf("%s %s %s", op.Column, op.Operation, describeOperators(children))
+	}
+
+	return fmt.Sprintf("%s %s %v", op.Column, op.Operation, op.Value)
+
+}
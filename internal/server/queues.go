@@ -0,0 +1,260 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/pkg/middleware"
+	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (s *server) handleV1GetQueues(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	operators, err := parseQuery(r.URL.Query(), queueColumns)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	queues, err := s.queue.Queues(ctx, operators...)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, queues)
+
+}
+
+func (s *server) handleV1PostQueues(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	var queue = new(support.Queue)
+	err := json.NewDecoder(r.Body).Decode(queue)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	queue, err = s.queue.CreateQueue(ctx, queue)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusCreated, queue)
+
+}
+
+// handleV1GetQueue responds with the queue along with the unassigned tickets that are waiting in it, oldest first.
+// breachingWithin narrows the tickets down to those that are about to miss one of their SLA targets
+func (s *server) handleV1GetQueue(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "queueID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("queueID is required, empty value received"), false)
+		return
+	}
+
+	query := r.URL.Query()
+	operators, err := parsePagination(query)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	breaching, err := parseBreachingWithin(query)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+	if breaching != nil {
+		operators = append(operators, breaching)
+	}
+
+	if query.Get("limit") == "" {
+		operators = append(operators, support.NewLimitOperator(defaultTicketLimit))
+	}
+
+	listing, err := s.queue.QueueTickets(ctx, id, operators...)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	err = s.presentTickets(ctx, listing.Tickets...)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, listing)
+
+}
+
+func (s *server) handleV1PatchQueue(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "queueID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("queueID is required, empty value received"), false)
+		return
+	}
+
+	queue, err := s.queue.Queue(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	err = json.NewDecoder(r.Body).Decode(queue)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	queue, err = s.queue.UpdateQueue(ctx, id, queue)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, queue)
+
+}
+
+func (s *server) handleV1DeleteQueue(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "queueID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("queueID is required, empty value received"), false)
+		return
+	}
+
+	err := s.queue.DeleteQueue(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusNoContent, nil)
+
+}
+
+// handleV1PostQueueClaim assigns the oldest unassigned ticket of the queue to the agent making the request,
+// responding with no content when there is no ticket left to claim
+func (s *server) handleV1PostQueueClaim(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "queueID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("queueID is required, empty value received"), false)
+		return
+	}
+
+	ticket, err := s.queue.ClaimNextTicket(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	if ticket == nil {
+		s.writeResponse(ctx, w, http.StatusNoContent, nil)
+		return
+	}
+
+	err = s.presentTickets(ctx, ticket)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, ticket)
+
+}
+
+// handleV1PostTicketAssign assigns the ticket to the agent in the body of the request,
+// or to the agent making the request when the body does not name one
+func (s *server) handleV1PostTicketAssign(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "ticketID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("ticketID is required, empty value received"), false)
+		return
+	}
+
+	var body struct {
+		AssigneeID *primitive.ObjectID `json:"assigneeID"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil && err != io.EOF {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	if body.AssigneeID == nil {
+		userID, err := middleware.GetUserObjectIDFromContext(ctx)
+		if err != nil {
+			s.writeError(ctx, w, http.StatusUnauthorized, err, false)
+			return
+		}
+
+		body.AssigneeID = &userID
+	}
+
+	ticket, err := s.queue.AssignTicket(ctx, id, *body.AssigneeID)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	err = s.presentTickets(ctx, ticket)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, ticket)
+
+}
+
+func (s *server) handleV1PostTicketUnassign(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "ticketID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("ticketID is required, empty value received"), false)
+		return
+	}
+
+	ticket, err := s.queue.UnassignTicket(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	err = s.presentTickets(ctx, ticket)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, ticket)
+
+}
@@ -5,13 +5,21 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/embersyndicate/support"
 	"github.com/embersyndicate/support/internal"
 
+	"github.com/embersyndicate/support/internal/attachment"
+	"github.com/embersyndicate/support/internal/audit"
 	"github.com/embersyndicate/support/internal/category"
+	"github.com/embersyndicate/support/internal/comment"
 	"github.com/embersyndicate/support/internal/key"
+	"github.com/embersyndicate/support/internal/queue"
+	"github.com/embersyndicate/support/internal/sla"
 	"github.com/embersyndicate/support/internal/ticket"
 	"github.com/embersyndicate/support/internal/token"
 	"github.com/embersyndicate/support/internal/user"
@@ -29,29 +37,42 @@ type server struct {
 	redis    *redis.Client
 	newrelic *newrelic.Application
 
-	server *http.Server
-
-	category category.Service
-	key      key.Service
-	ticket   ticket.Service
-	token    token.Service
-	user     user.Service
+	server  *http.Server
+	limiter *middleware.RateLimiter
+
+	attachment attachment.Service
+	audit      audit.Service
+	category   category.Service
+	comment    comment.Service
+	key        key.Service
+	queue      queue.Service
+	sla        sla.Service
+	ticket     ticket.Service
+	token      token.Service
+	user       user.Service
 }
 
 // New returns an instance of our HTTP Server
-func New(port uint, logger *logrus.Logger, redis *redis.Client, newrelic *newrelic.Application, category category.Service, key key.Service, ticket ticket.Service, token token.Service, user user.Service) *server {
+func New(port uint, logger *logrus.Logger, redis *redis.Client, newrelic *newrelic.Application, attachment attachment.Service, audit audit.Service, category category.Service, comment comment.Service, key key.Service, queue queue.Service, sla sla.Service, ticket ticket.Service, token token.Service, user user.Service) *server {
 	s := &server{
 		logger:   logger,
 		redis:    redis,
 		newrelic: newrelic,
 
-		category: category,
-		key:      key,
-		ticket:   ticket,
-		token:    token,
-		user:     user,
+		attachment: attachment,
+		audit:      audit,
+		category:   category,
+		comment:    comment,
+		key:        key,
+		queue:      queue,
+		sla:        sla,
+		ticket:     ticket,
+		token:      token,
+		user:       user,
 	}
 
+	s.limiter = middleware.NewRateLimiter(redis)
+
 	s.server = &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
 		WriteTimeout: time.Second * 5,
@@ -87,32 +108,129 @@ func (s *server) router() *chi.Mux {
 		r.Get("/.well-known/jwks.json", s.handleV1GetJWKS)
 
 		r.Route("/v1", func(r chi.Router) {
-			r.Post("/users/register", s.handleV1PostUserRegister)
-			r.Post("/users/login", s.handleV1PostUserLogin)
+			r.With(s.rateLimit("register", 5, time.Hour)).Post("/users/register", s.handleV1PostUserRegister)
+			r.With(s.rateLimit("login", 10, time.Minute)).Post("/users/login", s.handleV1PostUserLogin)
+			r.With(s.rateLimit("refresh", 30, time.Minute)).Post("/users/refresh", s.handleV1PostUserRefresh)
+			r.With(s.rateLimit("verification", 10, time.Minute)).Post("/users/verification/confirm", s.handleV1PostUserVerificationConfirm)
+			r.With(s.rateLimit("reset", 5, time.Minute*15)).Post("/users/password/reset", s.handleV1PostUserPasswordReset)
+			r.With(s.rateLimit("reset-confirm", 10, time.Minute)).Post("/users/password/reset/confirm", s.handleV1PostUserPasswordResetConfirm)
+
+			// Download links are signed, so they do not require the client to be authenticated
+			r.Get("/attachments/{attachmentID}/download", s.handleV1GetAttachmentDownload)
 
 			r.Group(func(r chi.Router) {
 				r.Use(s.auth)
+				r.Post("/users/logout", s.handleV1PostUserLogout)
+				r.Get("/users/me", s.handleV1GetUserMe)
+				r.Patch("/users/me", s.handleV1PatchUserMe)
+				r.With(s.rateLimit("password", 5, time.Minute*15)).Post("/users/me/password", s.handleV1PostUserMePassword)
+				r.With(s.rateLimit("verification-request", 3, time.Hour)).Post("/users/me/verification", s.handleV1PostUserMeVerification)
+
 				r.Get("/categories", s.handleV1GetCategories)
-				r.Post("/categories", s.handleV1PostCategories)
+				r.Get("/categories/tree", s.handleV1GetCategoryTree)
 				r.Get("/categories/{categoryID}", s.handleV1GetCategory)
-				r.Patch("/categories/{categoryID}", s.handleV1PatchCategory)
-
-				r.Post("/tickets", s.handleV1PostTickets)
+				r.Get("/categories/{categoryID}/ancestors", s.handleV1GetCategoryAncestors)
+				r.Get("/categories/{categoryID}/descendants", s.handleV1GetCategoryDescendants)
+				r.Get("/categories/{categoryID}/definitions", s.handleV1GetCategoryDefinitions)
+
+				r.Get("/tickets", s.handleV1GetTickets)
+				r.With(s.verified).Post("/tickets", s.handleV1PostTickets)
+				r.Get("/tickets/{ticketID}", s.handleV1GetTicket)
+				r.Patch("/tickets/{ticketID}", s.handleV1PatchTicket)
+				r.Get("/tickets/{ticketID}/comments", s.handleV1GetTicketComments)
+				r.Post("/tickets/{ticketID}/comments", s.handleV1PostTicketComments)
+				r.Patch("/tickets/{ticketID}/comments/{commentID}", s.handleV1PatchTicketComment)
+				r.Delete("/tickets/{ticketID}/comments/{commentID}", s.handleV1DeleteTicketComment)
+				r.Get("/tickets/{ticketID}/history", s.handleV1GetTicketHistory)
+				r.Get("/tickets/{ticketID}/attachments", s.handleV1GetTicketAttachments)
+				r.Post("/tickets/{ticketID}/attachments", s.handleV1PostTicketAttachments)
+
+				r.With(s.verified).Post("/attachments", s.handleV1PostAttachments)
+				r.Get("/attachments/{attachmentID}", s.handleV1GetAttachment)
 
 				r.Get("/tickets/statuses", s.handleV1GetTicketStatuses)
-				r.Post("/tickets/statuses", s.handleV1PostTicketStatuses)
 				r.Get("/tickets/statuses/{statusID}", s.handleV1GetTicketStatus)
-				r.Patch("/tickets/statuses/{statusID}", s.handleV1PatchTicketStatus)
 
 				r.Get("/tickets/definitions", s.handleV1GetTicketDefinitions)
-				r.Post("/tickets/definitions", s.handleV1PostTicketDefinition)
 				r.Get("/tickets/definitions/{definitionID}", s.handleV1GetTicketDefinition)
-				r.Patch("/tickets/definitions/{definitionID}", s.handleV1PatchTicketDefinition)
+				r.Get("/tickets/definitions/{definitionID}/schema", s.handleV1GetTicketDefinitionSchema)
+				r.Get("/tickets/definitions/{definitionID}/versions", s.handleV1GetTicketDefinitionVersions)
 
 				r.Get("/fields/definitions", s.handleV1GetFieldDefinitions)
-				r.Post("/fields/definitions", s.handleV1PostFieldDefinitions)
 				r.Get("/fields/definitions/{definitionID}", s.handleV1GetFieldDefinition)
-				r.Patch("/fields/definitions/{definitionID}", s.handleV1PatchFieldDefinition)
+
+				r.With(s.authorize(support.PermissionVerifyHashedFields)).
+					Post("/tickets/{ticketID}/fields/{fieldID}/verify", s.handleV1PostTicketFieldVerify)
+
+				r.Group(func(r chi.Router) {
+					r.Use(s.authorize(support.PermissionManageCategories))
+					r.Post("/categories", s.handleV1PostCategories)
+					r.Patch("/categories/{categoryID}", s.handleV1PatchCategory)
+					r.Delete("/categories/{categoryID}", s.handleV1DeleteCategory)
+					r.Post("/categories/{categoryID}/move", s.handleV1PostCategoryMove)
+					r.Post("/categories/{categoryID}/definitions/{definitionID}", s.handleV1PostCategoryDefinition)
+					r.Delete("/categories/{categoryID}/definitions/{definitionID}", s.handleV1DeleteCategoryDefinition)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(s.authorize(support.PermissionManageTicketStatuses))
+					r.Post("/tickets/statuses", s.handleV1PostTicketStatuses)
+					r.Patch("/tickets/statuses/{statusID}", s.handleV1PatchTicketStatus)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(s.authorize(support.PermissionManageTicketDefinitions))
+					r.Post("/tickets/definitions", s.handleV1PostTicketDefinition)
+					r.Patch("/tickets/definitions/{definitionID}", s.handleV1PatchTicketDefinition)
+					r.Post("/tickets/definitions/{definitionID}/disable", s.handleV1PostTicketDefinitionDisable)
+					r.Post("/tickets/definitions/{definitionID}/enable", s.handleV1PostTicketDefinitionEnable)
+					r.Post("/fields/definitions", s.handleV1PostFieldDefinitions)
+					r.Patch("/fields/definitions/{definitionID}", s.handleV1PatchFieldDefinition)
+					r.Post("/fields/definitions/{definitionID}/disable", s.handleV1PostFieldDefinitionDisable)
+					r.Post("/fields/definitions/{definitionID}/enable", s.handleV1PostFieldDefinitionEnable)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(s.authorize(support.PermissionAssignTickets))
+					r.Post("/tickets/{ticketID}/assign", s.handleV1PostTicketAssign)
+					r.Post("/tickets/{ticketID}/unassign", s.handleV1PostTicketUnassign)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(s.authorize(support.PermissionReadAllTickets))
+					r.Get("/queues", s.handleV1GetQueues)
+					r.Get("/queues/{queueID}", s.handleV1GetQueue)
+					r.Post("/queues/{queueID}/claim", s.handleV1PostQueueClaim)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(s.authorize(support.PermissionManageQueues))
+					r.Post("/queues", s.handleV1PostQueues)
+					r.Patch("/queues/{queueID}", s.handleV1PatchQueue)
+					r.Delete("/queues/{queueID}", s.handleV1DeleteQueue)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(s.authorize(support.PermissionReadAllTickets))
+					r.Get("/sla/policies", s.handleV1GetSLAPolicies)
+					r.Get("/sla/policies/{policyID}", s.handleV1GetSLAPolicy)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(s.authorize(support.PermissionManageSLAPolicies))
+					r.Post("/sla/policies", s.handleV1PostSLAPolicies)
+					r.Patch("/sla/policies/{policyID}", s.handleV1PatchSLAPolicy)
+					r.Delete("/sla/policies/{policyID}", s.handleV1DeleteSLAPolicy)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(s.authorize(support.PermissionManageUsers))
+					r.Get("/users/{userID}", s.handleV1GetUser)
+					r.Patch("/users/{userID}", s.handleV1PatchUser)
+					r.Delete("/users/{userID}", s.handleV1DeleteUser)
+				})
+
+				r.With(s.authorize(support.PermissionReadAudit)).Get("/audit", s.handleV1GetAuditEvents)
 
 			})
 		})
@@ -122,6 +240,12 @@ func (s *server) router() *chi.Mux {
 	return r
 }
 
+// rateLimit limits each client to the number of requests to the route within the window. Anonymous
+// clients are identified by their address and authenticated clients by their user
+func (s *server) rateLimit(name string, requests int, window time.Duration) func(http.Handler) http.Handler {
+	return middleware.RateLimit(s.limiter, name, middleware.Limit{Requests: requests, Window: window}, middleware.ClientUser)
+}
+
 // GracefullyShutdown gracefully shuts down the HTTP API.
 func (s *server) GracefullyShutdown(ctx context.Context) error {
 	s.logger.Info("attempting to shutdown server gracefully")
@@ -146,22 +270,39 @@ func (s *server) writeError(ctx context.Context, w http.ResponseWriter, code int
 
 	if err != nil {
 		var ierr internal.InternalError
+		var fieldErrs []internal.FieldError
 		if errors.As(err, &ierr) {
 			switch ierr.Level {
 			case internal.LevelInternal:
 				code = http.StatusInternalServerError
 			case internal.LevelBad:
 				code = http.StatusBadRequest
+			case internal.LevelForbidden:
+				code = http.StatusForbidden
+			case internal.LevelConflict:
+				code = http.StatusConflict
+			case internal.LevelTooLarge:
+				code = http.StatusRequestEntityTooLarge
+			case internal.LevelTooMany:
+				code = http.StatusTooManyRequests
+			}
+			if ierr.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(ierr.RetryAfter.Seconds()))))
 			}
+			fieldErrs = ierr.Errors
 		}
 		msg := err.Error()
 		reqID := middleware.GetRequestID(ctx)
 		if reqID != "" {
 			msg = fmt.Sprintf("%s (RequestID: %s)", msg, reqID)
 		}
-		s.writeResponse(ctx, w, code, map[string]interface{}{
+		body := map[string]interface{}{
 			"message": msg,
-		})
+		}
+		if len(fieldErrs) > 0 {
+			body["errors"] = fieldErrs
+		}
+		s.writeResponse(ctx, w, code, body)
 		return
 	}
 
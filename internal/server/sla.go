@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/embersyndicate/support"
+	"github.com/go-chi/chi"
+)
+
+func (s *server) handleV1GetSLAPolicies(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	operators, err := parseQuery(r.URL.Query(), slaPolicyColumns)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	policies, err := s.sla.SLAPolicies(ctx, operators...)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, policies)
+
+}
+
+func (s *server) handleV1PostSLAPolicies(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	var policy = new(support.SLAPolicy)
+	err := json.NewDecoder(r.Body).Decode(policy)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	policy, err = s.sla.CreateSLAPolicy(ctx, policy)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusCreated, policy)
+
+}
+
+func (s *server) handleV1GetSLAPolicy(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "policyID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("policyID is required, empty value received"), false)
+		return
+	}
+
+	policy, err := s.sla.SLAPolicy(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, policy)
+
+}
+
+func (s *server) handleV1PatchSLAPolicy(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "policyID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("policyID is required, empty value received"), false)
+		return
+	}
+
+	policy, err := s.sla.SLAPolicy(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	err = json.NewDecoder(r.Body).Decode(policy)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	policy, err = s.sla.UpdateSLAPolicy(ctx, id, policy)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, policy)
+
+}
+
+func (s *server) handleV1DeleteSLAPolicy(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "policyID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("policyID is required, empty value received"), false)
+		return
+	}
+
+	err := s.sla.DeleteSLAPolicy(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusNoContent, nil)
+
+}
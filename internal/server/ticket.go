@@ -1,12 +1,16 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 
 	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/internal"
+	"github.com/embersyndicate/support/pkg/middleware"
 	"github.com/go-chi/chi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func (s *server) handleV1PostTickets(w http.ResponseWriter, r *http.Request) {
@@ -20,20 +24,219 @@ func (s *server) handleV1PostTickets(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = s.ticket.CreateTicket(ctx, ticket)
+	ticket, err = s.ticket.CreateTicket(ctx, ticket)
 	if err != nil {
 		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
 		return
 	}
 
-	s.writeResponse(ctx, w, http.StatusCreated, nil)
+	err = s.presentTickets(ctx, ticket)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusCreated, ticket)
+}
+
+func (s *server) handleV1GetTickets(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	operators, err := parseTicketOperators(r.URL.Query())
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	// Regular users are only ever allowed to see the tickets that they have submitted
+	if !middleware.HasPermissionFromContext(ctx, support.PermissionReadAllTickets.String()) {
+		userID, err := middleware.GetUserObjectIDFromContext(ctx)
+		if err != nil {
+			s.writeError(ctx, w, http.StatusUnauthorized, err, false)
+			return
+		}
+
+		operators = append(operators, support.NewEqualOperator("submittedBy", userID))
+	}
+
+	tickets, err := s.ticket.Tickets(ctx, operators...)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	err = s.presentTickets(ctx, tickets...)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, tickets)
+
+}
+
+func (s *server) handleV1GetTicket(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "ticketID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("ticketID is required, empty value received"), false)
+		return
+	}
+
+	ticket, err := internal.ReadableTicket(ctx, s.ticket, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	err = s.presentTickets(ctx, ticket)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, ticket)
+
+}
+
+func (s *server) handleV1PatchTicket(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "ticketID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("ticketID is required, empty value received"), false)
+		return
+	}
+
+	var changes = new(support.Ticket)
+	err := json.NewDecoder(r.Body).Decode(changes)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	ticket, err := s.ticket.UpdateTicket(ctx, id, changes)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	err = s.presentTickets(ctx, ticket)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, ticket)
+
+}
+
+func (s *server) handleV1PostTicketFieldVerify(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	ticketID := chi.URLParam(r, "ticketID")
+	if ticketID == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("ticketID is required, empty value received"), false)
+		return
+	}
+
+	fieldID := chi.URLParam(r, "fieldID")
+	if fieldID == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("fieldID is required, empty value received"), false)
+		return
+	}
+
+	var body struct {
+		Value interface{} `json:"value"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	match, err := s.ticket.VerifyFieldValue(ctx, ticketID, fieldID, body.Value)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, map[string]interface{}{
+		"match": match,
+	})
+
+}
+
+// presentTickets prepares tickets to be written to a client. It is the single place
+// that field visibility is enforced: values of hashed fields are never returned
+// and hidden fields are removed entirely unless the requester may view hidden fields
+func (s *server) presentTickets(ctx context.Context, tickets ...*support.Ticket) error {
+
+	var ids = make([]primitive.ObjectID, 0)
+	for _, ticket := range tickets {
+		for _, field := range ticket.Fields {
+			ids = append(ids, field.ID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	definitions, err := s.ticket.FieldDefinitions(ctx, support.NewInOperator("_id", ids))
+	if err != nil {
+		return err
+	}
+
+	definitionMap := make(map[primitive.ObjectID]*support.FieldDefinition, len(definitions))
+	for _, definition := range definitions {
+		definitionMap[definition.ID] = definition
+	}
+
+	hidden := middleware.HasPermissionFromContext(ctx, support.PermissionViewHiddenFields.String())
+
+	for _, ticket := range tickets {
+		fields := make([]*support.FieldValue, 0, len(ticket.Fields))
+		for _, field := range ticket.Fields {
+			definition, ok := definitionMap[field.ID]
+			if !ok {
+				fields = append(fields, field)
+				continue
+			}
+
+			if definition.Hidden && !hidden {
+				continue
+			}
+
+			if definition.Hash {
+				field = &support.FieldValue{ID: field.ID}
+			}
+
+			fields = append(fields, field)
+		}
+		ticket.Fields = fields
+	}
+
+	return nil
+
 }
 
 func (s *server) handleV1GetTicketStatuses(w http.ResponseWriter, r *http.Request) {
 
 	var ctx = r.Context()
 
-	statuses, err := s.ticket.TicketStatuses(ctx)
+	operators, err := parseQuery(r.URL.Query(), ticketStatusColumns)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	statuses, err := s.ticket.TicketStatuses(ctx, operators...)
 	if err != nil {
 		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
 		return
@@ -120,12 +323,41 @@ func (s *server) handleV1GetTicketDefinitions(w http.ResponseWriter, r *http.Req
 
 	var ctx = r.Context()
 
-	definitions, err := s.ticket.TicketDefinitions(ctx)
+	operators, err := parseQuery(r.URL.Query(), ticketDefinitionColumns)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	operators, err = s.excludeDisabled(ctx, r, operators)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	expand, err := parseExpand(r.URL.Query(), expandFields)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	definitions, err := s.ticket.TicketDefinitions(ctx, operators...)
 	if err != nil {
 		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
 		return
 	}
 
+	if expand[expandFields] {
+		expanded, err := s.ticket.ExpandTicketDefinitions(ctx, definitions...)
+		if err != nil {
+			s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+			return
+		}
+
+		s.writeResponse(ctx, w, http.StatusOK, expanded)
+		return
+	}
+
 	s.writeResponse(ctx, w, http.StatusOK, definitions)
 
 }
@@ -161,16 +393,85 @@ func (s *server) handleV1GetTicketDefinition(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	definition, err := s.ticket.TicketDefinition(ctx, id)
+	expand, err := parseExpand(r.URL.Query(), expandFields)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	version, err := parseVersion(r.URL.Query())
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	definition, err := s.ticket.TicketDefinitionAtVersion(ctx, id, version)
 	if err != nil {
 		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
 		return
 	}
 
+	if expand[expandFields] {
+		expanded, err := s.ticket.ExpandTicketDefinitions(ctx, definition)
+		if err != nil {
+			s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+			return
+		}
+
+		s.writeResponse(ctx, w, http.StatusOK, expanded[0])
+		return
+	}
+
 	s.writeResponse(ctx, w, http.StatusOK, definition)
 
 }
 
+func (s *server) handleV1GetTicketDefinitionSchema(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "definitionID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("definitionID is required, empty value received"), false)
+		return
+	}
+
+	version, err := parseVersion(r.URL.Query())
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	schema, err := s.ticket.TicketDefinitionSchema(ctx, id, version)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, schema)
+
+}
+
+func (s *server) handleV1GetTicketDefinitionVersions(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "definitionID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("definitionID is required, empty value received"), false)
+		return
+	}
+
+	revisions, err := s.ticket.TicketDefinitionRevisions(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, revisions)
+
+}
+
 func (s *server) handleV1PatchTicketDefinition(w http.ResponseWriter, r *http.Request) {
 
 	var ctx = r.Context()
@@ -207,7 +508,19 @@ func (s *server) handleV1GetFieldDefinitions(w http.ResponseWriter, r *http.Requ
 
 	var ctx = r.Context()
 
-	fields, err := s.ticket.FieldDefinitions(ctx)
+	operators, err := parseQuery(r.URL.Query(), fieldDefinitionColumns)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	operators, err = s.excludeDisabled(ctx, r, operators)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	fields, err := s.ticket.FieldDefinitions(ctx, operators...)
 	if err != nil {
 		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
 		return
@@ -289,3 +602,104 @@ func (s *server) handleV1PatchFieldDefinition(w http.ResponseWriter, r *http.Req
 	s.writeResponse(ctx, w, http.StatusNoContent, nil)
 
 }
+
+// excludeDisabled restricts a listing of definitions to those that are enabled
+// unless the request includes disabled definitions and is allowed to see them
+func (s *server) excludeDisabled(ctx context.Context, r *http.Request, operators []*support.Operator) ([]*support.Operator, error) {
+
+	include, err := parseIncludeDisabled(r.URL.Query())
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	if !include {
+		return append(operators, support.NewEqualOperator("disabled", false)), nil
+	}
+
+	if !middleware.HasPermissionFromContext(ctx, support.PermissionManageTicketDefinitions.String()) {
+		return nil, internal.NewInternalError(internal.LevelForbidden, "only administrators may list disabled definitions")
+	}
+
+	return operators, nil
+
+}
+
+func (s *server) handleV1PostTicketDefinitionDisable(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "definitionID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("definitionID is required, empty value received"), false)
+		return
+	}
+
+	definition, err := s.ticket.DisableTicketDefinition(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, definition)
+
+}
+
+func (s *server) handleV1PostTicketDefinitionEnable(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "definitionID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("definitionID is required, empty value received"), false)
+		return
+	}
+
+	definition, err := s.ticket.EnableTicketDefinition(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, definition)
+
+}
+
+func (s *server) handleV1PostFieldDefinitionDisable(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "definitionID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("definitionID is required, empty value received"), false)
+		return
+	}
+
+	definition, err := s.ticket.DisableFieldDefinition(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, definition)
+
+}
+
+func (s *server) handleV1PostFieldDefinitionEnable(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "definitionID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("definitionID is required, empty value received"), false)
+		return
+	}
+
+	definition, err := s.ticket.EnableFieldDefinition(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, definition)
+
+}
@@ -6,26 +6,77 @@ import (
 	"net/http"
 
 	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/pkg/middleware"
+	"github.com/go-chi/chi"
 )
 
 func (s *server) handleV1PostUserLogin(w http.ResponseWriter, r *http.Request) {
 
 	var ctx = r.Context()
 
-	var user = new(support.User)
-	err := json.NewDecoder(r.Body).Decode(user)
+	var credentials = new(support.Credentials)
+	err := json.NewDecoder(r.Body).Decode(credentials)
 	if err != nil {
 		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
 		return
 	}
 
-	key, err := s.user.Login(ctx, user)
+	tokens, err := s.user.Login(ctx, credentials)
 	if err != nil {
 		s.writeError(ctx, w, http.StatusBadRequest, err, false)
 		return
 	}
 
-	s.writeResponse(ctx, w, http.StatusOK, key)
+	s.writeResponse(ctx, w, http.StatusOK, tokens)
+
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func (s *server) handleV1PostUserRefresh(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	var body = new(refreshTokenRequest)
+	err := json.NewDecoder(r.Body).Decode(body)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	tokens, err := s.user.Refresh(ctx, body.RefreshToken)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusUnauthorized, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, tokens)
+
+}
+
+func (s *server) handleV1PostUserLogout(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	// The body is optional, a client that only holds an access token may still log out
+	var body = new(refreshTokenRequest)
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(body)
+		if err != nil {
+			s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+			return
+		}
+	}
+
+	err := s.user.Logout(ctx, body.RefreshToken)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusInternalServerError, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusNoContent, nil)
 
 }
 
@@ -49,3 +100,208 @@ func (s *server) handleV1PostUserRegister(w http.ResponseWriter, r *http.Request
 	s.writeResponse(ctx, w, http.StatusOK, user)
 
 }
+
+func (s *server) handleV1GetUserMe(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id, _ := middleware.GetUserIDFromContext(ctx)
+
+	user, err := s.user.User(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, user)
+
+}
+
+func (s *server) handleV1PatchUserMe(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id, _ := middleware.GetUserIDFromContext(ctx)
+
+	s.patchUser(w, r, id)
+
+}
+
+func (s *server) handleV1PostUserMePassword(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	var change = new(support.PasswordChange)
+	err := json.NewDecoder(r.Body).Decode(change)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	err = s.user.ChangePassword(ctx, change)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusNoContent, nil)
+
+}
+
+func (s *server) handleV1GetUser(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "userID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("userID is required, empty value received"), false)
+		return
+	}
+
+	user, err := s.user.User(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, user)
+
+}
+
+func (s *server) handleV1PatchUser(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "userID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("userID is required, empty value received"), false)
+		return
+	}
+
+	s.patchUser(w, r, id)
+
+}
+
+func (s *server) handleV1DeleteUser(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	id := chi.URLParam(r, "userID")
+	if id == "" {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("userID is required, empty value received"), false)
+		return
+	}
+
+	err := s.user.DeleteUser(ctx, id)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusNoContent, nil)
+
+}
+
+func (s *server) patchUser(w http.ResponseWriter, r *http.Request, id string) {
+
+	var ctx = r.Context()
+
+	var changes = new(support.User)
+	err := json.NewDecoder(r.Body).Decode(changes)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	user, err := s.user.UpdateUser(ctx, id, changes)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusOK, user)
+
+}
+
+func (s *server) handleV1PostUserMeVerification(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	err := s.user.RequestEmailVerification(ctx)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusAccepted, nil)
+
+}
+
+type actionTokenRequest struct {
+	Token string `json:"token"`
+}
+
+func (s *server) handleV1PostUserVerificationConfirm(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	var body = new(actionTokenRequest)
+	err := json.NewDecoder(r.Body).Decode(body)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	err = s.user.ConfirmEmailVerification(ctx, body.Token)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusNoContent, nil)
+
+}
+
+func (s *server) handleV1PostUserPasswordReset(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	var body struct {
+		Email string `json:"email"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	err = s.user.RequestPasswordReset(ctx, body.Email)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusAccepted, nil)
+
+}
+
+func (s *server) handleV1PostUserPasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+
+	var ctx = r.Context()
+
+	var reset = new(support.PasswordReset)
+	err := json.NewDecoder(r.Body).Decode(reset)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, fmt.Errorf("failed to read request body: %w", err), false)
+		return
+	}
+
+	err = s.user.ConfirmPasswordReset(ctx, reset)
+	if err != nil {
+		s.writeError(ctx, w, http.StatusBadRequest, err, false)
+		return
+	}
+
+	s.writeResponse(ctx, w, http.StatusNoContent, nil)
+
+}
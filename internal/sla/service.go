@@ -0,0 +1,480 @@
+package sla
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/internal"
+	"github.com/embersyndicate/support/internal/audit"
+	"github.com/embersyndicate/support/internal/category"
+	"github.com/embersyndicate/support/pkg/middleware"
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// breachBatchSize is the number of tickets that are checked for a breach at a time
+const breachBatchSize int64 = 100
+
+type Service interface {
+	support.SLARepository
+	StartTicket(ctx context.Context, ticket *support.Ticket) error
+	TransitionTicket(ctx context.Context, ticket *support.Ticket, status *support.TicketStatus, at time.Time) error
+	RecordResponse(ctx context.Context, ticket *support.Ticket, comment *support.Comment) error
+	DetectBreaches(ctx context.Context, now time.Time) (int, error)
+}
+
+type service struct {
+	support.SLARepository
+	tickets    support.TicketRepository
+	categories category.Service
+	audit      audit.Service
+	redis      *redis.Client
+}
+
+func New(sla support.SLARepository, tickets support.TicketRepository, categories category.Service, audit audit.Service, redis *redis.Client) Service {
+	return &service{
+		SLARepository: sla,
+		tickets:       tickets,
+		categories:    categories,
+		audit:         audit,
+		redis:         redis,
+	}
+}
+
+func (s *service) SLAPolicy(ctx context.Context, id string) (*support.SLAPolicy, error) {
+
+	policy, err := s.SLARepository.SLAPolicy(ctx, id)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to fetch sla policy %s", id)
+	}
+
+	return policy, nil
+
+}
+
+func (s *service) SLAPolicies(ctx context.Context, operators ...*support.Operator) ([]*support.SLAPolicy, error) {
+
+	policies, err := s.SLARepository.SLAPolicies(ctx, operators...)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to fetch sla policies")
+	}
+
+	return policies, nil
+
+}
+
+func (s *service) CreateSLAPolicy(ctx context.Context, policy *support.SLAPolicy) (*support.SLAPolicy, error) {
+
+	err := policy.ValidateAttributes()
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	err = s.validatePolicy(ctx, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := middleware.GetUserObjectIDFromContext(ctx)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to retrieve user id from context")
+	}
+
+	now := time.Now()
+	policy.CreatedAt = now
+	policy.CreatedBy = userID
+	policy.UpdatedAt = now
+	policy.UpdatedBy = userID
+
+	policy, err = s.SLARepository.CreateSLAPolicy(ctx, policy)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		if internal.IsUniqueConstrainViolation(err) {
+			return nil, internal.NewConflictError("sla policy name is already in use", "name")
+		}
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to create sla policy")
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntitySLAPolicy,
+		EntityID: policy.ID,
+		Action:   support.AuditActionCreate,
+	}, nil, policy)
+
+	return policy, nil
+
+}
+
+// UpdateSLAPolicy replaces the policy. Tickets keep the due dates that they were given when they were created,
+// while changes to the business hours and pause statuses apply to them from their next change of status
+func (s *service) UpdateSLAPolicy(ctx context.Context, id string, policy *support.SLAPolicy) (*support.SLAPolicy, error) {
+
+	err := policy.ValidateAttributes()
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	err = s.validatePolicy(ctx, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := middleware.GetUserObjectIDFromContext(ctx)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to retrieve user id from context")
+	}
+
+	current, err := s.SLAPolicy(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	policy.CreatedAt = current.CreatedAt
+	policy.CreatedBy = current.CreatedBy
+	policy.UpdatedAt = time.Now()
+	policy.UpdatedBy = userID
+
+	policy, err = s.SLARepository.UpdateSLAPolicy(ctx, id, policy)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		if internal.IsUniqueConstrainViolation(err) {
+			return nil, internal.NewConflictError("sla policy name is already in use", "name")
+		}
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to update sla policy %s", id))
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntitySLAPolicy,
+		EntityID: policy.ID,
+		Action:   support.AuditActionUpdate,
+	}, current, policy)
+
+	return policy, nil
+
+}
+
+// DeleteSLAPolicy removes the policy. Tickets that the policy applied to keep their due dates and are still checked for breaches
+func (s *service) DeleteSLAPolicy(ctx context.Context, id string) error {
+
+	policy, err := s.SLAPolicy(ctx, id)
+	if err != nil {
+		return internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	err = s.SLARepository.DeleteSLAPolicy(ctx, id)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to delete sla policy %s", id))
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntitySLAPolicy,
+		EntityID: policy.ID,
+		Action:   support.AuditActionDelete,
+	}, policy, nil)
+
+	return nil
+
+}
+
+// StartTicket computes the due dates of a new ticket from the policy that applies to it.
+// The ticket is left without an SLA when no policy applies to it
+func (s *service) StartTicket(ctx context.Context, ticket *support.Ticket) error {
+
+	ticket.SLA = nil
+
+	policy, err := s.ticketPolicy(ctx, ticket)
+	if err != nil || policy == nil {
+		return err
+	}
+
+	sla, err := policy.Start(ticket.CreatedAt, ticket.StatusID)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to compute due dates from sla policy %s", policy.ID.Hex()))
+	}
+
+	ticket.SLA = sla
+
+	return nil
+
+}
+
+// TransitionTicket updates the SLA of a ticket that is being moved into the status. Entering a pause status pauses
+// the SLA and leaving one resumes it. Entering a locked status resolves the ticket and leaving one reopens it
+func (s *service) TransitionTicket(ctx context.Context, ticket *support.Ticket, status *support.TicketStatus, at time.Time) error {
+
+	if ticket.SLA == nil {
+		return nil
+	}
+
+	// Tickets outlive the policy that applied to them, in which case they can no longer be paused
+	// and any time that they have left is counted around the clock
+	policy, err := s.SLARepository.SLAPolicy(ctx, ticket.SLA.PolicyID.Hex())
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+	}
+
+	var hours *support.BusinessHours
+	if policy != nil {
+		hours = policy.BusinessHours
+	}
+
+	paused := policy != nil && policy.Pauses(status.ID)
+	switch {
+	case paused && ticket.SLA.PausedAt == nil:
+		ticket.SLA.PausedAt = &at
+	case !paused && ticket.SLA.PausedAt != nil:
+		err = ticket.SLA.Resume(at, hours)
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+			return internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to resume the sla of ticket %s", ticket.ID.Hex()))
+		}
+	}
+
+	switch {
+	case status.Locked && ticket.SLA.ResolvedAt == nil:
+		ticket.SLA.ResolvedAt = &at
+	case !status.Locked:
+		ticket.SLA.ResolvedAt = nil
+	}
+
+	return nil
+
+}
+
+// RecordResponse meets the first response target of the ticket when the comment is the first public reply
+// that an agent other than the submitter has left on it
+func (s *service) RecordResponse(ctx context.Context, ticket *support.Ticket, comment *support.Comment) error {
+
+	if ticket.SLA == nil || ticket.SLA.FirstRespondedAt != nil || comment.Internal || comment.AuthorID == ticket.SubmittedBy {
+		return nil
+	}
+
+	if !middleware.HasPermissionFromContext(ctx, support.PermissionReadAllTickets.String()) {
+		return nil
+	}
+
+	_, err := s.tickets.StampTicketSLA(ctx, ticket.ID, support.SLAColumnFirstRespondedAt, comment.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record the first response to ticket %s: %w", ticket.ID.Hex(), err)
+	}
+
+	return nil
+
+}
+
+// DetectBreaches marks every running target that was due at or before now as breached, recording each breach in
+// the audit trail and publishing it to SLABreachChannel. It returns the number of breaches that were marked.
+// Breaches are only ever marked once, so any number of workers may detect breaches at the same time
+func (s *service) DetectBreaches(ctx context.Context, now time.Time) (int, error) {
+
+	var breaches int
+	var published error
+
+	for _, target := range support.AllSLATargets {
+		for {
+			tickets, err := s.tickets.Tickets(
+				ctx,
+				support.NewBreachedOperator(target, now),
+				support.NewOrderOperator(target.DueColumn(), support.SortAsc),
+				support.NewLimitOperator(breachBatchSize),
+			)
+			if err != nil {
+				return breaches, fmt.Errorf("failed to fetch tickets that missed their %s target: %w", target, err)
+			}
+
+			for _, ticket := range tickets {
+				// The ticket may have been resolved, paused, answered or given a later due date since it was fetched
+				breached, err := s.tickets.StampTicketSLA(ctx, ticket.ID, target.BreachedColumn(), now, support.NewBreachedOperator(target, now))
+				if err != nil {
+					return breaches, fmt.Errorf("failed to mark the %s target of ticket %s as breached: %w", target, ticket.ID.Hex(), err)
+				}
+
+				// Another worker marked the breach first or the ticket is no longer in breach
+				if !breached {
+					continue
+				}
+
+				breaches++
+
+				err = s.emitBreach(ctx, ticket, target, now)
+				if err != nil {
+					published = err
+				}
+			}
+
+			if int64(len(tickets)) < breachBatchSize {
+				break
+			}
+		}
+	}
+
+	return breaches, published
+
+}
+
+// emitBreach records the breach of the target of the ticket in the audit trail and publishes it.
+// The breach has already been marked, so the audit event is recorded even when publishing fails
+func (s *service) emitBreach(ctx context.Context, ticket *support.Ticket, target support.SLATarget, at time.Time) error {
+
+	breach := &support.SLABreach{
+		TicketID:   ticket.ID,
+		PolicyID:   ticket.SLA.PolicyID,
+		Target:     target,
+		BreachedAt: at,
+	}
+
+	if due := dueAt(ticket.SLA, target); due != nil {
+		breach.DueAt = *due
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityTicket,
+		EntityID: ticket.ID,
+		Action:   support.AuditActionBreach,
+	}, map[string]interface{}{}, map[string]interface{}{target.BreachedColumn(): at})
+
+	payload, err := json.Marshal(breach)
+	if err != nil {
+		return fmt.Errorf("failed to encode the breach of ticket %s: %w", ticket.ID.Hex(), err)
+	}
+
+	err = s.redis.Publish(ctx, support.SLABreachChannel, payload).Err()
+	if err != nil {
+		return fmt.Errorf("failed to publish the breach of ticket %s: %w", ticket.ID.Hex(), err)
+	}
+
+	return nil
+
+}
+
+// ticketPolicy returns the policy that applies to the ticket. Policies that name the definition of the ticket
+// take precedence over those that name its category, and the category is searched before its parents.
+// When more than one policy matches, the oldest applies. A nil policy is returned when there is none
+func (s *service) ticketPolicy(ctx context.Context, ticket *support.Ticket) (*support.SLAPolicy, error) {
+
+	ancestors, err := s.categories.Ancestors(ctx, ticket.CategoryID.Hex())
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelInternal, err.Error())
+	}
+
+	filters := []*support.Operator{support.NewEqualOperator("definitions", ticket.DefinitionID)}
+	filters = append(filters, support.NewEqualOperator("categories", ticket.CategoryID))
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		filters = append(filters, support.NewEqualOperator("categories", ancestors[i].ID))
+	}
+
+	for _, filter := range filters {
+		policies, err := s.SLAPolicies(
+			ctx,
+			filter,
+			support.NewOrderOperator("createdAt", support.SortAsc),
+			support.NewLimitOperator(1),
+		)
+		if err != nil {
+			return nil, internal.NewInternalError(internal.LevelInternal, err.Error())
+		}
+
+		if len(policies) > 0 {
+			return policies[0], nil
+		}
+	}
+
+	return nil, nil
+
+}
+
+// validatePolicy confirms that the categories, definitions and pause statuses of the policy exist
+func (s *service) validatePolicy(ctx context.Context, policy *support.SLAPolicy) error {
+
+	var errs = make([]internal.FieldError, 0)
+
+	if len(policy.Categories) > 0 {
+		categories, err := s.categories.Categories(ctx, support.NewInOperator("_id", policy.Categories))
+		if err != nil {
+			return internal.NewInternalError(internal.LevelInternal, err.Error())
+		}
+
+		ids := make([]primitive.ObjectID, len(categories))
+		for i, category := range categories {
+			ids[i] = category.ID
+		}
+
+		errs = append(errs, unknown("categories", "category", policy.Categories, ids)...)
+	}
+
+	if len(policy.Definitions) > 0 {
+		definitions, err := s.tickets.TicketDefinitions(ctx, support.NewInOperator("_id", policy.Definitions))
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+			return internal.NewInternalError(internal.LevelInternal, "failed to fetch ticket definitions")
+		}
+
+		ids := make([]primitive.ObjectID, len(definitions))
+		for i, definition := range definitions {
+			ids[i] = definition.ID
+		}
+
+		errs = append(errs, unknown("definitions", "definition", policy.Definitions, ids)...)
+	}
+
+	if len(policy.PauseStatuses) > 0 {
+		statuses, err := s.tickets.TicketStatuses(ctx, support.NewInOperator("_id", policy.PauseStatuses))
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+			return internal.NewInternalError(internal.LevelInternal, "failed to fetch ticket statuses")
+		}
+
+		ids := make([]primitive.ObjectID, len(statuses))
+		for i, status := range statuses {
+			ids[i] = status.ID
+		}
+
+		errs = append(errs, unknown("pauseStatuses", "status", policy.PauseStatuses, ids)...)
+	}
+
+	if len(errs) > 0 {
+		return internal.NewValidationError("sla policy failed validation", errs)
+	}
+
+	return nil
+
+}
+
+// unknown returns an entry for every requested id that was not found
+func unknown(field, kind string, requested, found []primitive.ObjectID) []internal.FieldError {
+
+	var errs = make([]internal.FieldError, 0)
+
+	exists := make(map[primitive.ObjectID]bool, len(found))
+	for _, id := range found {
+		exists[id] = true
+	}
+
+	for _, id := range requested {
+		if !exists[id] {
+			errs = append(errs, internal.FieldError{Field: field, Message: fmt.Sprintf("unknown %s %s", kind, id.Hex())})
+		}
+	}
+
+	return errs
+
+}
+
+func dueAt(sla *support.TicketSLA, target support.SLATarget) *time.Time {
+
+	if target == support.SLATargetFirstResponse {
+		return sla.FirstResponseDue
+	}
+
+	return sla.ResolutionDue
+
+}
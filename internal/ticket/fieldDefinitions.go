@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/internal"
+	"github.com/embersyndicate/support/internal/audit"
 	"github.com/embersyndicate/support/pkg/middleware"
 )
 
@@ -47,6 +49,9 @@ func (s *service) CreateFieldDefinition(ctx context.Context, definition *support
 	}
 
 	now := time.Now()
+	definition.Disabled = false
+	definition.DisabledBy = nil
+	definition.DisabledAt = nil
 	definition.CreatedAt = now
 	definition.CreatedBy = userID
 	definition.UpdatedAt = now
@@ -58,6 +63,12 @@ func (s *service) CreateFieldDefinition(ctx context.Context, definition *support
 		return nil, fmt.Errorf("failed to create definition")
 	}
 
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityFieldDefinition,
+		EntityID: definition.ID,
+		Action:   support.AuditActionCreate,
+	}, nil, definition)
+
 	return definition, nil
 
 }
@@ -69,6 +80,16 @@ func (s *service) UpdateFieldDefinition(ctx context.Context, id string, definiti
 		return nil, err
 	}
 
+	current, err := s.FieldDefinition(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	// Definitions are only disabled and enabled through DisableFieldDefinition and EnableFieldDefinition
+	definition.Disabled = current.Disabled
+	definition.DisabledBy = current.DisabledBy
+	definition.DisabledAt = current.DisabledAt
+
 	userID, err := middleware.GetUserObjectIDFromContext(ctx)
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
@@ -85,6 +106,88 @@ func (s *service) UpdateFieldDefinition(ctx context.Context, id string, definiti
 		return nil, fmt.Errorf("failed to create definition")
 	}
 
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityFieldDefinition,
+		EntityID: definition.ID,
+		Action:   support.AuditActionUpdate,
+	}, current, definition)
+
+	return definition, nil
+
+}
+
+// DisableFieldDefinition prevents the field definition identified by id from being added to ticket definitions.
+// Ticket definitions that already have the field keep it. Disabling a definition that is already disabled keeps the original stamp
+func (s *service) DisableFieldDefinition(ctx context.Context, id string) (*support.FieldDefinition, error) {
+
+	definition, err := s.FieldDefinition(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	if definition.Disabled {
+		return definition, nil
+	}
+
+	before := audit.Snapshot(definition)
+
+	userID, err := middleware.GetUserObjectIDFromContext(ctx)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to retrieve user id from context")
+	}
+
+	now := time.Now()
+	definition.Disabled = true
+	definition.DisabledBy = &userID
+	definition.DisabledAt = &now
+
+	definition, err = s.TicketRepository.UpdateFieldDefinition(ctx, id, definition)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to disable definition %s", id))
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityFieldDefinition,
+		EntityID: definition.ID,
+		Action:   support.AuditActionDisable,
+	}, before, definition)
+
+	return definition, nil
+
+}
+
+// EnableFieldDefinition allows the field definition identified by id to be added to ticket definitions again
+func (s *service) EnableFieldDefinition(ctx context.Context, id string) (*support.FieldDefinition, error) {
+
+	definition, err := s.FieldDefinition(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	if !definition.Disabled {
+		return definition, nil
+	}
+
+	before := audit.Snapshot(definition)
+
+	definition.Disabled = false
+	definition.DisabledBy = nil
+	definition.DisabledAt = nil
+
+	definition, err = s.TicketRepository.UpdateFieldDefinition(ctx, id, definition)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to enable definition %s", id))
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityFieldDefinition,
+		EntityID: definition.ID,
+		Action:   support.AuditActionEnable,
+	}, before, definition)
+
 	return definition, nil
 
 }
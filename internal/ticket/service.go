@@ -1,19 +1,45 @@
 package ticket
 
 import (
+	"context"
+
 	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/internal/audit"
+	"github.com/embersyndicate/support/internal/category"
+	"github.com/embersyndicate/support/internal/queue"
+	"github.com/embersyndicate/support/internal/sla"
 )
 
 type Service interface {
 	support.TicketRepository
+	VerifyFieldValue(ctx context.Context, ticketID, fieldID string, candidate interface{}) (bool, error)
+	ExpandTicketDefinitions(ctx context.Context, definitions ...*support.TicketDefinition) ([]*support.ExpandedTicketDefinition, error)
+	TicketDefinitionSchema(ctx context.Context, id string, version int) (*support.JSONSchema, error)
+	UpdateTicketDefinition(ctx context.Context, id string, definition *support.TicketDefinition) (*support.TicketDefinition, error)
+	TicketDefinitionAtVersion(ctx context.Context, id string, version int) (*support.TicketDefinition, error)
+	TicketDefinitionRevisions(ctx context.Context, id string) ([]*support.TicketDefinitionRevision, error)
+	DisableTicketDefinition(ctx context.Context, id string) (*support.TicketDefinition, error)
+	EnableTicketDefinition(ctx context.Context, id string) (*support.TicketDefinition, error)
+	DisableFieldDefinition(ctx context.Context, id string) (*support.FieldDefinition, error)
+	EnableFieldDefinition(ctx context.Context, id string) (*support.FieldDefinition, error)
 }
 
 type service struct {
 	support.TicketRepository
+	attachments support.AttachmentRepository
+	categories  category.Service
+	queues      queue.Service
+	slas        sla.Service
+	audit       audit.Service
 }
 
-func New(ticket support.TicketRepository) Service {
+func New(ticket support.TicketRepository, attachments support.AttachmentRepository, categories category.Service, queues queue.Service, slas sla.Service, audit audit.Service) Service {
 	return &service{
 		TicketRepository: ticket,
+		attachments:      attachments,
+		categories:       categories,
+		queues:           queues,
+		slas:             slas,
+		audit:            audit,
 	}
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/internal"
 	"github.com/embersyndicate/support/pkg/middleware"
 )
 
@@ -38,6 +39,11 @@ func (s *service) CreateTicketStatus(ctx context.Context, status *support.Ticket
 		return nil, err
 	}
 
+	err = s.validateTransitions(ctx, status)
+	if err != nil {
+		return nil, err
+	}
+
 	userID, err := middleware.GetUserObjectIDFromContext(ctx)
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
@@ -56,6 +62,12 @@ func (s *service) CreateTicketStatus(ctx context.Context, status *support.Ticket
 		return nil, fmt.Errorf("failed to create ticket status")
 	}
 
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityTicketStatus,
+		EntityID: status.ID,
+		Action:   support.AuditActionCreate,
+	}, nil, status)
+
 	return status, err
 
 }
@@ -67,12 +79,22 @@ func (s *service) UpdateTicketStatus(ctx context.Context, id string, status *sup
 		return nil, err
 	}
 
+	err = s.validateTransitions(ctx, status)
+	if err != nil {
+		return nil, err
+	}
+
 	userID, err := middleware.GetUserObjectIDFromContext(ctx)
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
 		return nil, fmt.Errorf("failed to retrieve user id from context")
 	}
 
+	current, err := s.TicketStatus(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
 	status.UpdatedAt = time.Now()
 	status.UpdatedBy = userID
 
@@ -83,5 +105,49 @@ func (s *service) UpdateTicketStatus(ctx context.Context, id string, status *sup
 
 	}
 
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityTicketStatus,
+		EntityID: status.ID,
+		Action:   support.AuditActionUpdate,
+	}, current, status)
+
 	return status, err
 }
+
+// validateTransitions ensures that every status listed in the transitions of the provided status exists
+func (s *service) validateTransitions(ctx context.Context, status *support.TicketStatus) error {
+
+	if len(status.Transitions) == 0 {
+		return nil
+	}
+
+	for i, transition := range status.Transitions {
+		for j, itransition := range status.Transitions {
+			if transition == itransition && i != j {
+				return internal.NewInternalError(internal.LevelBad, "transitions must be unique")
+			}
+		}
+	}
+
+	statuses, err := s.TicketStatuses(ctx, support.NewInOperator("_id", status.Transitions))
+	if err != nil {
+		return internal.NewInternalError(internal.LevelInternal, "failed to fetch statuses for transitions")
+	}
+
+	for _, transition := range status.Transitions {
+		var exists bool
+		for _, existing := range statuses {
+			if existing.ID == transition {
+				exists = true
+				break
+			}
+		}
+
+		if !exists {
+			return internal.NewInternalError(internal.LevelBad, fmt.Sprintf("unable to resolve transition %s to valid status", transition.Hex()))
+		}
+	}
+
+	return nil
+
+}
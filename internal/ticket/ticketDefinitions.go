@@ -7,7 +7,9 @@ import (
 
 	"github.com/embersyndicate/support"
 	"github.com/embersyndicate/support/internal"
+	"github.com/embersyndicate/support/internal/audit"
 	"github.com/embersyndicate/support/pkg/middleware"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func (s *service) TicketDefinition(ctx context.Context, id string) (*support.TicketDefinition, error) {
@@ -47,26 +49,16 @@ func (s *service) CreateTicketDefinition(ctx context.Context, definition *suppor
 		return nil, fmt.Errorf("failed to retrieve user id from context")
 	}
 
-	if len(definition.Fields) == 0 {
-		return nil, internal.NewInternalError(internal.LevelBad, "field must have a length greater than or equal to 1, length of 0 detected")
-	}
-
-	for i, field := range definition.Fields {
-		for j, ifield := range definition.Fields {
-			if field.Hex() == ifield.Hex() && i != j {
-				return nil, internal.NewInternalError(internal.LevelBad, "fields must be unique. tickets cannot have multiple fields with the same name")
-			}
-		}
-
-		_, err := s.FieldDefinition(ctx, field.Hex())
-		if err != nil {
-			middleware.LogEntrySetError(ctx, err)
-			return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("unable to resolve %s field id to valid field definition", field.Hex()))
-		}
-
+	err = s.validateDefinitionFields(ctx, definition, nil)
+	if err != nil {
+		return nil, err
 	}
 
 	now := time.Now()
+	definition.Version = 1
+	definition.Disabled = false
+	definition.DisabledBy = nil
+	definition.DisabledAt = nil
 	definition.CreatedAt = now
 	definition.CreatedBy = userID
 	definition.UpdatedAt = now
@@ -81,10 +73,27 @@ func (s *service) CreateTicketDefinition(ctx context.Context, definition *suppor
 		return nil, internal.NewInternalError(internal.LevelInternal, "failed to create ticket definition")
 	}
 
+	_, err = s.TicketRepository.CreateTicketDefinitionVersion(ctx, definition.Snapshot(userID, now))
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to record version of ticket definition")
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityTicketDefinition,
+		EntityID: definition.ID,
+		Action:   support.AuditActionCreate,
+	}, nil, definition)
+
 	return definition, nil
 
 }
 
+// UpdateTicketDefinition updates the definition identified by id. Changing the name or fields of a definition
+// records a new version of it rather than altering the form that existing tickets were submitted under, so fields
+// may be added, reordered or retired freely. Tickets that have already been submitted keep validating against
+// the version that they were submitted under. An update that races another update of the same definition is
+// rejected with a conflict rather than recording the same version twice
 func (s *service) UpdateTicketDefinition(ctx context.Context, id string, definition *support.TicketDefinition) (*support.TicketDefinition, error) {
 
 	err := definition.ValidateAttributes()
@@ -98,19 +107,262 @@ func (s *service) UpdateTicketDefinition(ctx context.Context, id string, definit
 		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to fetch definition %s", id))
 	}
 
-	// Ensure that all the current field definitions exist in the updated definition
-	for _, currentFieldDefinitionID := range currentDefinition.Fields {
-		var exists bool
-		for _, updatedFieldDefinitionID := range definition.Fields {
-			if currentFieldDefinitionID.Hex() == updatedFieldDefinitionID.Hex() {
-				exists = true
+	err = s.validateDefinitionFields(ctx, definition, currentDefinition.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := middleware.GetUserObjectIDFromContext(ctx)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to retrieve user id from context")
+	}
+
+	now := time.Now()
+	changed := definition.FormChanged(currentDefinition)
+
+	// Definitions that predate versioning have never had their first version recorded,
+	// which the tickets submitted under them refer to, so it is recorded before it is replaced.
+	// A concurrent update may have recorded the same version already
+	if changed && currentDefinition.Version == 0 {
+		_, err = s.TicketRepository.CreateTicketDefinitionVersion(ctx, currentDefinition.Snapshot(currentDefinition.UpdatedBy, currentDefinition.UpdatedAt))
+		if err != nil && !internal.IsUniqueConstrainViolation(err) {
+			middleware.LogEntrySetError(ctx, err)
+			return nil, internal.NewInternalError(internal.LevelInternal, "failed to record version of ticket definition")
+		}
+	}
+
+	// Definitions are only disabled and enabled through DisableTicketDefinition and EnableTicketDefinition
+	definition.Disabled = currentDefinition.Disabled
+	definition.DisabledBy = currentDefinition.DisabledBy
+	definition.DisabledAt = currentDefinition.DisabledAt
+
+	definition.ID = currentDefinition.ID
+	definition.Version = currentDefinition.Version
+	if changed {
+		definition.Version = currentDefinition.CurrentVersion() + 1
+	}
+	definition.UpdatedAt = now
+	definition.UpdatedBy = userID
+
+	// The new version is recorded before the definition moves to it, so the definition never refers to a version
+	// that was not recorded. Only one of several concurrent updates can record the same version
+	var version *support.TicketDefinitionVersion
+	if changed {
+		version, err = s.TicketRepository.CreateTicketDefinitionVersion(ctx, definition.Snapshot(userID, now))
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+			if internal.IsUniqueConstrainViolation(err) {
+				return nil, definitionConflict(id)
+			}
+			return nil, internal.NewInternalError(internal.LevelInternal, "failed to record version of ticket definition")
+		}
+	}
+
+	updated, err := s.TicketRepository.ReplaceTicketDefinition(ctx, id, currentDefinition.Version, definition)
+	if err != nil || updated == nil {
+		// No ticket can have been submitted under a version that the definition never moved to
+		if version != nil {
+			if derr := s.TicketRepository.DeleteTicketDefinitionVersion(ctx, version.ID); derr != nil {
+				middleware.LogEntrySetError(ctx, derr)
+			}
+		}
+	}
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		if internal.IsUniqueConstrainViolation(err) {
+			return nil, internal.NewInternalError(internal.LevelBad, "definition name must be unique")
+		}
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to update definition %s", id))
+	}
+
+	if updated == nil {
+		return nil, definitionConflict(id)
+	}
+	definition = updated
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityTicketDefinition,
+		EntityID: definition.ID,
+		Action:   support.AuditActionUpdate,
+	}, currentDefinition, definition)
+
+	return definition, nil
+
+}
+
+// TicketDefinitionAtVersion returns the definition identified by id as it was at the provided version.
+// A version of 0 returns the current version of the definition
+func (s *service) TicketDefinitionAtVersion(ctx context.Context, id string, version int) (*support.TicketDefinition, error) {
+
+	definition, err := s.TicketDefinition(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	if version == 0 || version == definition.CurrentVersion() {
+		return definition, nil
+	}
+
+	versions, err := s.TicketRepository.TicketDefinitionVersions(
+		ctx,
+		support.NewEqualOperator("definitionID", definition.ID),
+		support.NewEqualOperator("version", version),
+		support.NewLimitOperator(1),
+	)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to fetch version %d of definition %s", version, id))
+	}
+
+	if len(versions) == 0 {
+		return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("definition %s does not have a version %d", id, version))
+	}
+
+	return definition.AtVersion(versions[0]), nil
+
+}
+
+// TicketDefinitionRevisions returns every version of the definition identified by id,
+// oldest first, along with the changes that each version made to the one before it
+func (s *service) TicketDefinitionRevisions(ctx context.Context, id string) ([]*support.TicketDefinitionRevision, error) {
+
+	definition, err := s.TicketDefinition(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	versions, err := s.TicketRepository.TicketDefinitionVersions(
+		ctx,
+		support.NewEqualOperator("definitionID", definition.ID),
+		support.NewOrderOperator("version", support.SortAsc),
+	)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to fetch versions of definition %s", id))
+	}
+
+	// Definitions that predate versioning and have not changed since have only their current form
+	if len(versions) == 0 {
+		versions = append(versions, definition.Snapshot(definition.UpdatedBy, definition.UpdatedAt))
+	}
+
+	revisions := make([]*support.TicketDefinitionRevision, len(versions))
+	for i, version := range versions {
+		revisions[i] = &support.TicketDefinitionRevision{TicketDefinitionVersion: version}
+		if i > 0 {
+			revisions[i].Changes = version.Diff(versions[i-1])
+		}
+	}
+
+	return revisions, nil
+
+}
+
+// validateDefinitionFields confirms that the fields of the definition are unique and that each of them exists.
+// Disabled field definitions may be kept by a definition that already has them, but cannot be added to one
+func (s *service) validateDefinitionFields(ctx context.Context, definition *support.TicketDefinition, existing []primitive.ObjectID) error {
+
+	retained := make(map[primitive.ObjectID]bool, len(existing))
+	for _, field := range existing {
+		retained[field] = true
+	}
+
+	if len(definition.Fields) == 0 {
+		return internal.NewInternalError(internal.LevelBad, "field must have a length greater than or equal to 1, length of 0 detected")
+	}
+
+	for i, field := range definition.Fields {
+		for j, ifield := range definition.Fields {
+			if field.Hex() == ifield.Hex() && i != j {
+				return internal.NewInternalError(internal.LevelBad, "fields must be unique. tickets cannot have multiple fields with the same name")
 			}
 		}
-		if !exists {
-			return nil, internal.NewInternalError(internal.LevelBad, "failed to updated definition. existing field definition missing from updated payload.")
+
+		fieldDefinition, err := s.FieldDefinition(ctx, field.Hex())
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+			return internal.NewInternalError(internal.LevelBad, fmt.Sprintf("unable to resolve %s field id to valid field definition", field.Hex()))
 		}
+
+		if fieldDefinition.Disabled && !retained[field] {
+			return internal.NewInternalError(internal.LevelBad, fmt.Sprintf("field definition %s is disabled and cannot be added to a ticket definition", field.Hex()))
+		}
+
 	}
 
+	return nil
+
+}
+
+// ExpandTicketDefinitions resolves the field definitions of every provided definition with a single query,
+// returning the definitions in the order provided with their fields in the order that the definition lists them
+func (s *service) ExpandTicketDefinitions(ctx context.Context, definitions ...*support.TicketDefinition) ([]*support.ExpandedTicketDefinition, error) {
+
+	expanded := make([]*support.ExpandedTicketDefinition, 0, len(definitions))
+	if len(definitions) == 0 {
+		return expanded, nil
+	}
+
+	seen := make(map[primitive.ObjectID]bool)
+	fieldIDs := make([]primitive.ObjectID, 0)
+	for _, definition := range definitions {
+		for _, fieldID := range definition.Fields {
+			if !seen[fieldID] {
+				seen[fieldID] = true
+				fieldIDs = append(fieldIDs, fieldID)
+			}
+		}
+	}
+
+	fields, err := s.TicketRepository.FieldDefinitions(ctx, support.NewInOperator("_id", fieldIDs))
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to fetch field definitions")
+	}
+
+	for _, definition := range definitions {
+		expanded = append(expanded, support.ExpandTicketDefinition(definition, fields))
+	}
+
+	return expanded, nil
+
+}
+
+// TicketDefinitionSchema generates a JSON Schema document that describes the body of a request that
+// submits a ticket using the provided version of the definition identified by id. A version of 0 describes
+// the current version, which is the only version that new tickets may be submitted under
+func (s *service) TicketDefinitionSchema(ctx context.Context, id string, version int) (*support.JSONSchema, error) {
+
+	definition, err := s.TicketDefinitionAtVersion(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded, err := s.ExpandTicketDefinitions(ctx, definition)
+	if err != nil {
+		return nil, err
+	}
+
+	return expanded[0].Schema(), nil
+
+}
+
+// DisableTicketDefinition prevents new tickets from being submitted using the definition identified by id.
+// Existing tickets are unaffected. Disabling a definition that is already disabled keeps the original stamp
+func (s *service) DisableTicketDefinition(ctx context.Context, id string) (*support.TicketDefinition, error) {
+
+	definition, err := s.TicketDefinition(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	if definition.Disabled {
+		return definition, nil
+	}
+
+	before := audit.Snapshot(definition)
+
 	userID, err := middleware.GetUserObjectIDFromContext(ctx)
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
@@ -118,15 +370,70 @@ func (s *service) UpdateTicketDefinition(ctx context.Context, id string, definit
 	}
 
 	now := time.Now()
-	definition.UpdatedAt = now
-	definition.UpdatedBy = userID
+	definition.Disabled = true
+	definition.DisabledBy = &userID
+	definition.DisabledAt = &now
+
+	definition, err = s.TicketRepository.ReplaceTicketDefinition(ctx, id, definition.Version, definition)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to disable definition %s", id))
+	}
+
+	if definition == nil {
+		return nil, definitionConflict(id)
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityTicketDefinition,
+		EntityID: definition.ID,
+		Action:   support.AuditActionDisable,
+	}, before, definition)
+
+	return definition, nil
+
+}
+
+// EnableTicketDefinition allows tickets to be submitted using the definition identified by id again
+func (s *service) EnableTicketDefinition(ctx context.Context, id string) (*support.TicketDefinition, error) {
+
+	definition, err := s.TicketDefinition(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	if !definition.Disabled {
+		return definition, nil
+	}
+
+	before := audit.Snapshot(definition)
+
+	definition.Disabled = false
+	definition.DisabledBy = nil
+	definition.DisabledAt = nil
 
-	definition, err = s.TicketRepository.UpdateTicketDefinition(ctx, id, definition)
+	definition, err = s.TicketRepository.ReplaceTicketDefinition(ctx, id, definition.Version, definition)
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
-		return nil, fmt.Errorf("failed to create definition")
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to enable definition %s", id))
 	}
 
+	if definition == nil {
+		return nil, definitionConflict(id)
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityTicketDefinition,
+		EntityID: definition.ID,
+		Action:   support.AuditActionEnable,
+	}, before, definition)
+
 	return definition, nil
 
 }
+
+// definitionConflict reports that the definition identified by id was changed by another request
+// between the time that it was read and the time that it was written
+func definitionConflict(id string) error {
+	return internal.NewInternalError(internal.LevelConflict, fmt.Sprintf("definition %s was changed by another request, fetch it and try again", id))
+}
@@ -2,13 +2,19 @@ package ticket
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"time"
 
-	"github.com/davecgh/go-spew/spew"
 	"github.com/embersyndicate/support/internal"
+	"github.com/embersyndicate/support/internal/audit"
 
 	"github.com/embersyndicate/support"
 	"github.com/embersyndicate/support/pkg/middleware"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func (s *service) Ticket(ctx context.Context, id string) (*support.Ticket, error) {
@@ -35,26 +41,550 @@ func (s *service) Tickets(ctx context.Context, operators ...*support.Operator) (
 
 func (s *service) CreateTicket(ctx context.Context, ticket *support.Ticket) (*support.Ticket, error) {
 
+	err := ticket.ValidateAttributes()
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	userID, err := middleware.GetUserObjectIDFromContext(ctx)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to retrieve user id from context")
+	}
+
 	definition, err := s.TicketDefinition(ctx, ticket.DefinitionID.Hex())
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
 		return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("unknown definition %s", ticket.DefinitionID.Hex()))
 	}
 
-	fields, err := s.FieldDefinitions(ctx, support.NewInOperator("id", definition.Fields))
+	if definition.Disabled {
+		return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("definition %s is disabled and cannot be used to create new tickets", definition.ID.Hex()))
+	}
+
+	permitted, err := s.categories.DefinitionPermitted(ctx, ticket.CategoryID, definition.ID)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("unknown category %s", ticket.CategoryID.Hex()))
+	}
+
+	if !permitted {
+		return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("definition %s is not permitted in category %s", definition.ID.Hex(), ticket.CategoryID.Hex()))
+	}
+
+	fields, err := s.FieldDefinitions(ctx, support.NewInOperator("_id", definition.Fields))
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
 		return nil, internal.NewInternalError(internal.LevelInternal, "failed to retrieve field definitions for specified ticket definition")
 	}
 
-	spew.Dump(fields)
+	errs := validateFieldValues(fields, ticket.Fields)
+	errs = append(errs, missingRequiredFields(fields, ticket.Fields)...)
+	if len(errs) > 0 {
+		return nil, internal.NewValidationError("one or more fields failed validation", errs)
+	}
+
+	pending, err := s.fileAttachments(ctx, userID, primitive.NilObjectID, fields, ticket.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	err = hashFieldValues(ctx, fields, ticket.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses, err := s.TicketStatuses(ctx, support.NewEqualOperator("default", true), support.NewLimitOperator(1))
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to retrieve default ticket status")
+	}
+
+	if len(statuses) == 0 {
+		return nil, internal.NewInternalError(internal.LevelInternal, "no default ticket status has been configured")
+	}
+
+	ticket.ID = primitive.NilObjectID
+	ticket.DefinitionVersion = definition.CurrentVersion()
+	ticket.SubmittedBy = userID
+	ticket.AssignedTo = nil
+	ticket.StatusID = statuses[0].ID
+	ticket.CreatedAt = time.Now()
+	ticket.UpdateAt = nil
+
+	err = s.slas.StartTicket(ctx, ticket)
+	if err != nil {
+		return nil, err
+	}
+
+	ticket, err = s.TicketRepository.CreateTicket(ctx, ticket)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to create ticket")
+	}
+
+	err = s.attachments.BindAttachments(ctx, ticket.ID, pending...)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to attach files to ticket")
+	}
 
-	return nil, nil
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityTicket,
+		EntityID: ticket.ID,
+		Action:   support.AuditActionCreate,
+	}, nil, ticketSnapshot(ticket, fields))
+
+	// The ticket has already been created, so failing to assign it leaves it waiting in its queue
+	assigned, err := s.queues.AutoAssignTicket(ctx, ticket)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return ticket, nil
+	}
+
+	return assigned, nil
 
 }
 
+// UpdateTicket applies the changes described by the provided ticket to the ticket identified by id.
+// Submitted field values are merged into the existing values of the ticket and revalidated against
+// the definition. A non-zero StatusID requests a change of status, which requires the matching permission.
+// The assignee is changed through the queue service, so a non-nil AssignedTo is rejected.
+// All other attributes of the provided ticket are ignored.
 func (s *service) UpdateTicket(ctx context.Context, id string, ticket *support.Ticket) (*support.Ticket, error) {
 
-	panic("UpdateTicket not implemented")
+	userID, err := middleware.GetUserObjectIDFromContext(ctx)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to retrieve user id from context")
+	}
+
+	current, err := s.Ticket(ctx, id)
+	if err != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	if current.SubmittedBy != userID && !middleware.HasPermissionFromContext(ctx, support.PermissionUpdateAllTickets.String()) {
+		return nil, internal.NewInternalError(internal.LevelForbidden, "tickets may only be updated by their submitter or users with the ticket:update:all permission")
+	}
+
+	// Assignment is validated and recorded by the queue service
+	if ticket.AssignedTo != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("assignedTo cannot be updated, use /v1/tickets/%s/assign instead", id))
+	}
+
+	// The field definitions are needed to keep the values of hashed fields out of the audit trail
+	fields, err := s.FieldDefinitions(ctx, support.NewInOperator("_id", fieldIDs(current.Fields, ticket.Fields)))
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to retrieve field definitions of ticket")
+	}
+
+	before := ticketSnapshot(current, fields)
+
+	var pending []primitive.ObjectID
+	if len(ticket.Fields) > 0 {
+		pending, err = s.mergeFieldValues(ctx, userID, current, ticket.Fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !ticket.StatusID.IsZero() && ticket.StatusID != current.StatusID {
+		if !middleware.HasPermissionFromContext(ctx, support.PermissionChangeTicketStatus.String()) {
+			return nil, internal.NewInternalError(internal.LevelForbidden, "only agents may change the status of a ticket")
+		}
+
+		err = s.transitionStatus(ctx, current, ticket.StatusID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	current.UpdateAt = &now
+
+	current, err = s.TicketRepository.UpdateTicket(ctx, id, current)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to update ticket %s", id))
+	}
+
+	err = s.attachments.BindAttachments(ctx, current.ID, pending...)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to attach files to ticket")
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityTicket,
+		EntityID: current.ID,
+		Action:   support.AuditActionUpdate,
+	}, before, ticketSnapshot(current, fields))
+
+	return current, nil
+
+}
+
+// mergeFieldValues validates the changed values against the version of the definition that the ticket
+// was submitted under and merges them into the existing values, replacing any value with the same id.
+// The pending attachments that are submitted as the value of a file field are returned, to be attached
+// to the ticket once the merged values have been stored
+func (s *service) mergeFieldValues(ctx context.Context, userID primitive.ObjectID, ticket *support.Ticket, changes []*support.FieldValue) ([]primitive.ObjectID, error) {
+
+	// Tickets submitted before definitions were versioned were submitted under the first version
+	version := ticket.DefinitionVersion
+	if version == 0 {
+		version = 1
+	}
+
+	definition, err := s.TicketDefinitionAtVersion(ctx, ticket.DefinitionID.Hex(), version)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to fetch version %d of definition %s", version, ticket.DefinitionID.Hex()))
+	}
+
+	fields, err := s.FieldDefinitions(ctx, support.NewInOperator("_id", definition.Fields))
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to retrieve field definitions for specified ticket definition")
+	}
+
+	errs := validateFieldValues(fields, changes)
+	if len(errs) > 0 {
+		return nil, internal.NewValidationError("one or more fields failed validation", errs)
+	}
+
+	pending, err := s.fileAttachments(ctx, userID, ticket.ID, fields, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = hashFieldValues(ctx, fields, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make([]*support.FieldValue, 0, len(ticket.Fields)+len(changes))
+	merged = append(merged, ticket.Fields...)
+	for _, change := range changes {
+		if change == nil {
+			continue
+		}
+
+		var replaced bool
+		for i, value := range merged {
+			if value.ID == change.ID {
+				merged[i] = change
+				replaced = true
+				break
+			}
+		}
+
+		if !replaced {
+			merged = append(merged, change)
+		}
+	}
+
+	errs = missingRequiredFields(fields, merged)
+	if len(errs) > 0 {
+		return nil, internal.NewValidationError("one or more fields failed validation", errs)
+	}
+
+	ticket.Fields = merged
+
+	return pending, nil
+
+}
+
+// transitionStatus moves the ticket into the provided status, honouring the lock
+// on the current status and the transitions that the current status allows.
+// The SLA of the ticket is paused, resumed or resolved to match the new status
+func (s *service) transitionStatus(ctx context.Context, ticket *support.Ticket, statusID primitive.ObjectID) error {
+
+	current, err := s.TicketStatus(ctx, ticket.StatusID.Hex())
+	if err != nil {
+		return internal.NewInternalError(internal.LevelInternal, err.Error())
+	}
+
+	next, err := s.TicketStatus(ctx, statusID.Hex())
+	if err != nil {
+		return internal.NewInternalError(internal.LevelBad, fmt.Sprintf("unknown status %s", statusID.Hex()))
+	}
+
+	override := middleware.HasPermissionFromContext(ctx, support.PermissionOverrideLockedStatus.String())
+
+	if current.Locked && !override {
+		return internal.NewInternalError(internal.LevelForbidden, fmt.Sprintf("ticket is in locked status %s and its status cannot be changed", current.Name))
+	}
+
+	if !current.CanTransitionTo(next.ID) && !override {
+		return internal.NewInternalError(internal.LevelBad, fmt.Sprintf("tickets cannot be moved from %s to %s", current.Name, next.Name))
+	}
+
+	ticket.StatusID = next.ID
+
+	return s.slas.TransitionTicket(ctx, ticket, next, time.Now())
+
+}
+
+func (s *service) VerifyFieldValue(ctx context.Context, ticketID, fieldID string, candidate interface{}) (bool, error) {
+
+	if !middleware.HasPermissionFromContext(ctx, support.PermissionVerifyHashedFields.String()) {
+		return false, internal.NewInternalError(internal.LevelForbidden, "only agents may verify hashed field values")
+	}
+
+	if candidate == nil {
+		return false, internal.NewInternalError(internal.LevelBad, "value is required, received empty value")
+	}
+
+	ticket, err := s.Ticket(ctx, ticketID)
+	if err != nil {
+		return false, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	definition, err := s.FieldDefinition(ctx, fieldID)
+	if err != nil {
+		return false, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	if !definition.Hash {
+		return false, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("field %s is not a hashed field", fieldID))
+	}
+
+	var hash string
+	for _, value := range ticket.Fields {
+		if value.ID == definition.ID {
+			hash, _ = value.Value.(string)
+			break
+		}
+	}
+
+	if hash == "" {
+		return false, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("ticket %s does not have a value for field %s", ticketID, fieldID))
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), digestFieldValue(candidate))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		middleware.LogEntrySetError(ctx, err)
+		return false, internal.NewInternalError(internal.LevelInternal, "failed to verify field value")
+	}
+
+	return true, nil
+
+}
+
+// fileAttachments confirms that the value of every file field refers to an attachment that either
+// belongs to the ticket or is pending and was uploaded by the user. The ids of the pending attachments
+// are returned so that they can be attached to the ticket. A new ticket is identified by a nil ticketID
+func (s *service) fileAttachments(ctx context.Context, userID, ticketID primitive.ObjectID, definitions []*support.FieldDefinition, values []*support.FieldValue) ([]primitive.ObjectID, error) {
+
+	definitionMap := make(map[primitive.ObjectID]*support.FieldDefinition, len(definitions))
+	for _, definition := range definitions {
+		definitionMap[definition.ID] = definition
+	}
+
+	// Values have already been validated, so the value of every file field is a valid ObjectID
+	files := make(map[primitive.ObjectID]primitive.ObjectID)
+	ids := make([]primitive.ObjectID, 0)
+	for _, value := range values {
+		if value == nil || value.Value == nil {
+			continue
+		}
+
+		definition, ok := definitionMap[value.ID]
+		if !ok || definition.Kind != support.FieldFile {
+			continue
+		}
+
+		id, _ := primitive.ObjectIDFromHex(value.Value.(string))
+		files[value.ID] = id
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	attachments, err := s.attachments.Attachments(ctx, support.NewInOperator("_id", ids))
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelInternal, "failed to fetch attachments")
+	}
+
+	attachmentMap := make(map[primitive.ObjectID]*support.Attachment, len(attachments))
+	for _, attachment := range attachments {
+		attachmentMap[attachment.ID] = attachment
+	}
+
+	var errs = make([]internal.FieldError, 0)
+	pending := make([]primitive.ObjectID, 0, len(ids))
+	for field, id := range files {
+		attachment, ok := attachmentMap[id]
+		switch {
+		case !ok:
+			errs = append(errs, internal.FieldError{Field: field.Hex(), Message: fmt.Sprintf("attachment %s does not exist", id.Hex())})
+		case attachment.TicketID == nil && attachment.UploadedBy == userID:
+			pending = append(pending, attachment.ID)
+		case attachment.TicketID == nil || ticketID.IsZero() || *attachment.TicketID != ticketID:
+			errs = append(errs, internal.FieldError{Field: field.Hex(), Message: fmt.Sprintf("attachment %s cannot be attached to this ticket", id.Hex())})
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, internal.NewValidationError("one or more fields failed validation", errs)
+	}
+
+	return pending, nil
+
+}
+
+// hashFieldValues replaces the value of every field whose definition is flagged
+// with Hash with a one way hash of that value
+func hashFieldValues(ctx context.Context, definitions []*support.FieldDefinition, values []*support.FieldValue) error {
+
+	definitionMap := make(map[primitive.ObjectID]*support.FieldDefinition, len(definitions))
+	for _, definition := range definitions {
+		definitionMap[definition.ID] = definition
+	}
+
+	for _, value := range values {
+		if value == nil || value.Value == nil {
+			continue
+		}
+
+		definition, ok := definitionMap[value.ID]
+		if !ok || !definition.Hash {
+			continue
+		}
+
+		hash, err := bcrypt.GenerateFromPassword(digestFieldValue(value.Value), bcrypt.DefaultCost)
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+			return internal.NewInternalError(internal.LevelInternal, "failed to generate field hash")
+		}
+
+		value.Value = string(hash)
+	}
+
+	return nil
+
+}
+
+// ticketSnapshot captures the ticket for the audit trail with the values of hashed fields left out.
+// The audit trail is readable by users that may not verify hashed values, who could otherwise
+// attempt to recover those values from their hashes
+func ticketSnapshot(ticket *support.Ticket, definitions []*support.FieldDefinition) map[string]interface{} {
+
+	hashed := make(map[primitive.ObjectID]bool, len(definitions))
+	for _, definition := range definitions {
+		if definition.Hash {
+			hashed[definition.ID] = true
+		}
+	}
+
+	redacted := *ticket
+	redacted.Fields = make([]*support.FieldValue, 0, len(ticket.Fields))
+	for _, field := range ticket.Fields {
+		if field != nil && hashed[field.ID] {
+			field = &support.FieldValue{ID: field.ID}
+		}
+		redacted.Fields = append(redacted.Fields, field)
+	}
+
+	return audit.Snapshot(&redacted)
+
+}
+
+// fieldIDs returns the ids of the provided field values
+func fieldIDs(values ...[]*support.FieldValue) []primitive.ObjectID {
+
+	var ids = make([]primitive.ObjectID, 0)
+	for _, fields := range values {
+		for _, field := range fields {
+			if field != nil {
+				ids = append(ids, field.ID)
+			}
+		}
+	}
+
+	return ids
+
+}
+
+// digestFieldValue reduces a field value to a fixed length digest before it is handed to bcrypt.
+// bcrypt only considers the first 72 bytes of its input, so long values such as API keys
+// would otherwise only be partially compared
+func digestFieldValue(value interface{}) []byte {
+	sum := sha256.Sum256([]byte(fmt.Sprint(value)))
+	return []byte(hex.EncodeToString(sum[:]))
+}
+
+// validateFieldValues validates the submitted values against the field definitions
+// of a ticket definition, returning an entry for every value that is invalid
+// and every value that does not belong to the definition
+func validateFieldValues(definitions []*support.FieldDefinition, values []*support.FieldValue) []internal.FieldError {
+
+	var errs = make([]internal.FieldError, 0)
+
+	definitionMap := make(map[primitive.ObjectID]*support.FieldDefinition, len(definitions))
+	for _, definition := range definitions {
+		definitionMap[definition.ID] = definition
+	}
+
+	seen := make(map[primitive.ObjectID]bool, len(values))
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+
+		if seen[value.ID] {
+			errs = append(errs, internal.FieldError{Field: value.ID.Hex(), Message: "field was submitted more than once"})
+			continue
+		}
+		seen[value.ID] = true
+
+		definition, ok := definitionMap[value.ID]
+		if !ok {
+			errs = append(errs, internal.FieldError{Field: value.ID.Hex(), Message: "field is not a part of this ticket definition"})
+			continue
+		}
+
+		// Missing values for required fields are reported by missingRequiredFields
+		if value.Value == nil {
+			continue
+		}
+
+		err := definition.ValidateValue(value.Value)
+		if err != nil {
+			errs = append(errs, internal.FieldError{Field: value.ID.Hex(), Message: err.Error()})
+		}
+	}
+
+	return errs
+
+}
+
+// missingRequiredFields returns an entry for every required field definition that does not have a value
+func missingRequiredFields(definitions []*support.FieldDefinition, values []*support.FieldValue) []internal.FieldError {
+
+	var errs = make([]internal.FieldError, 0)
+
+	present := make(map[primitive.ObjectID]bool, len(values))
+	for _, value := range values {
+		if value != nil && value.Value != nil {
+			present[value.ID] = true
+		}
+	}
+
+	for _, definition := range definitions {
+		if definition.Required && !present[definition.ID] {
+			errs = append(errs, internal.FieldError{Field: definition.ID.Hex(), Message: fmt.Sprintf("%s is required", definition.Name)})
+		}
+	}
+
+	return errs
 
 }
@@ -0,0 +1,236 @@
+package ticket
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/internal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestValidateFieldValues(t *testing.T) {
+
+	summary := &support.FieldDefinition{ID: primitive.NewObjectID(), Name: "Summary", Kind: support.FieldString, Required: true}
+	impact := &support.FieldDefinition{ID: primitive.NewObjectID(), Name: "Impact", Kind: support.FieldNumber}
+	outage := &support.FieldDefinition{ID: primitive.NewObjectID(), Name: "Outage", Kind: support.FieldBoolean}
+	systems := &support.FieldDefinition{ID: primitive.NewObjectID(), Name: "Systems", Kind: support.FieldList, Options: []interface{}{"mail", "vpn", "wifi"}}
+	definitions := []*support.FieldDefinition{summary, impact, outage, systems}
+
+	unknown := primitive.NewObjectID()
+
+	tests := []struct {
+		name     string
+		values   []*support.FieldValue
+		expected []internal.FieldError
+	}{
+		{
+			name: "valid values of every kind",
+			values: []*support.FieldValue{
+				{ID: summary.ID, Value: "vpn is down"},
+				{ID: impact.ID, Value: float64(3)},
+				{ID: outage.ID, Value: true},
+				{ID: systems.ID, Value: "vpn"},
+			},
+			expected: []internal.FieldError{},
+		},
+		{
+			name: "list with multiple options",
+			values: []*support.FieldValue{
+				{ID: systems.ID, Value: []interface{}{"mail", "wifi"}},
+			},
+			expected: []internal.FieldError{},
+		},
+		{
+			name: "invalid values of every kind",
+			values: []*support.FieldValue{
+				{ID: summary.ID, Value: float64(1)},
+				{ID: impact.ID, Value: "high"},
+				{ID: outage.ID, Value: "yes"},
+				{ID: systems.ID, Value: []interface{}{"mail", "printer"}},
+			},
+			expected: []internal.FieldError{
+				{Field: summary.ID.Hex(), Message: "expected value of kind string, got float64"},
+				{Field: impact.ID.Hex(), Message: "expected value of kind number, got string"},
+				{Field: outage.ID.Hex(), Message: "expected value of kind boolean, got string"},
+				{Field: systems.ID.Hex(), Message: "printer is not a valid option"},
+			},
+		},
+		{
+			name: "list with a single unknown option",
+			values: []*support.FieldValue{
+				{ID: systems.ID, Value: "printer"},
+			},
+			expected: []internal.FieldError{
+				{Field: systems.ID.Hex(), Message: "printer is not a valid option"},
+			},
+		},
+		{
+			name: "unknown field",
+			values: []*support.FieldValue{
+				{ID: summary.ID, Value: "vpn is down"},
+				{ID: unknown, Value: "x"},
+			},
+			expected: []internal.FieldError{
+				{Field: unknown.Hex(), Message: "field is not a part of this ticket definition"},
+			},
+		},
+		{
+			name: "duplicate field",
+			values: []*support.FieldValue{
+				{ID: summary.ID, Value: "vpn is down"},
+				{ID: summary.ID, Value: "mail is down"},
+			},
+			expected: []internal.FieldError{
+				{Field: summary.ID.Hex(), Message: "field was submitted more than once"},
+			},
+		},
+		{
+			name: "nil values are left to missingRequiredFields",
+			values: []*support.FieldValue{
+				nil,
+				{ID: summary.ID, Value: nil},
+			},
+			expected: []internal.FieldError{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			errs := validateFieldValues(definitions, test.values)
+			if !reflect.DeepEqual(errs, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, errs)
+			}
+
+		})
+	}
+
+}
+
+func TestMissingRequiredFields(t *testing.T) {
+
+	summary := &support.FieldDefinition{ID: primitive.NewObjectID(), Name: "Summary", Kind: support.FieldString, Required: true}
+	systems := &support.FieldDefinition{ID: primitive.NewObjectID(), Name: "Systems", Kind: support.FieldList, Required: true, Options: []interface{}{"vpn"}}
+	notes := &support.FieldDefinition{ID: primitive.NewObjectID(), Name: "Notes", Kind: support.FieldString}
+	definitions := []*support.FieldDefinition{summary, systems, notes}
+
+	tests := []struct {
+		name     string
+		values   []*support.FieldValue
+		expected []internal.FieldError
+	}{
+		{
+			name: "all required fields present",
+			values: []*support.FieldValue{
+				{ID: summary.ID, Value: "vpn is down"},
+				{ID: systems.ID, Value: "vpn"},
+			},
+			expected: []internal.FieldError{},
+		},
+		{
+			name:   "no values",
+			values: []*support.FieldValue{},
+			expected: []internal.FieldError{
+				{Field: summary.ID.Hex(), Message: "Summary is required"},
+				{Field: systems.ID.Hex(), Message: "Systems is required"},
+			},
+		},
+		{
+			name: "nil value for a required field",
+			values: []*support.FieldValue{
+				{ID: summary.ID, Value: nil},
+				{ID: systems.ID, Value: "vpn"},
+				nil,
+			},
+			expected: []internal.FieldError{
+				{Field: summary.ID.Hex(), Message: "Summary is required"},
+			},
+		},
+		{
+			name: "optional field alone",
+			values: []*support.FieldValue{
+				{ID: notes.ID, Value: "n/a"},
+				{ID: systems.ID, Value: "vpn"},
+			},
+			expected: []internal.FieldError{
+				{Field: summary.ID.Hex(), Message: "Summary is required"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			errs := missingRequiredFields(definitions, test.values)
+			if !reflect.DeepEqual(errs, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, errs)
+			}
+
+		})
+	}
+
+}
+
+func TestTicketSnapshot(t *testing.T) {
+
+	summary := &support.FieldDefinition{ID: primitive.NewObjectID(), Name: "Summary", Kind: support.FieldString}
+	apiKey := &support.FieldDefinition{ID: primitive.NewObjectID(), Name: "API key", Kind: support.FieldString, Hash: true}
+	definitions := []*support.FieldDefinition{summary, apiKey}
+
+	hash := "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+
+	tests := []struct {
+		name     string
+		values   []*support.FieldValue
+		expected []interface{}
+	}{
+		{
+			name: "hashed value is left out",
+			values: []*support.FieldValue{
+				{ID: summary.ID, Value: "vpn is down"},
+				{ID: apiKey.ID, Value: hash},
+			},
+			expected: []interface{}{
+				map[string]interface{}{"id": summary.ID.Hex(), "value": "vpn is down"},
+				map[string]interface{}{"id": apiKey.ID.Hex(), "value": nil},
+			},
+		},
+		{
+			name: "value without a definition is kept",
+			values: []*support.FieldValue{
+				{ID: apiKey.ID, Value: hash},
+				{ID: primitive.NilObjectID, Value: "n/a"},
+			},
+			expected: []interface{}{
+				map[string]interface{}{"id": apiKey.ID.Hex(), "value": nil},
+				map[string]interface{}{"id": primitive.NilObjectID.Hex(), "value": "n/a"},
+			},
+		},
+		{
+			name:     "no values",
+			values:   []*support.FieldValue{},
+			expected: []interface{}{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			ticket := &support.Ticket{ID: primitive.NewObjectID(), Fields: test.values}
+			snapshot := ticketSnapshot(ticket, definitions)
+
+			if !reflect.DeepEqual(snapshot["fields"], test.expected) {
+				t.Errorf("expected fields %+v, got %+v", test.expected, snapshot["fields"])
+			}
+
+			for _, value := range ticket.Fields {
+				if value.ID == apiKey.ID && value.Value != hash {
+					t.Errorf("expected the hashed value of the ticket to be left untouched, got %v", value.Value)
+				}
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,37 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/pkg/middleware"
+)
+
+// ReadableTicket fetches the ticket identified by id, confirming that the user making the request may read it.
+// A ticket may be read by the user that submitted it and by users that may read every ticket
+func ReadableTicket(ctx context.Context, tickets support.TicketRepository, id string) (*support.Ticket, error) {
+
+	ticket, err := tickets.Ticket(ctx, id)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, NewInternalError(LevelBad, fmt.Sprintf("failed to fetch ticket %s", id))
+	}
+
+	if middleware.HasPermissionFromContext(ctx, support.PermissionReadAllTickets.String()) {
+		return ticket, nil
+	}
+
+	userID, err := middleware.GetUserObjectIDFromContext(ctx)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to retrieve user id from context")
+	}
+
+	if ticket.SubmittedBy != userID {
+		return nil, NewInternalError(LevelForbidden, fmt.Sprintf("ticket %s was not submitted by you", id))
+	}
+
+	return ticket, nil
+
+}
@@ -0,0 +1,165 @@
+package token
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+const (
+	// actionAudience differs from the audience of access tokens so
+	// that an action token can never be presented as an access token
+	actionAudience = "Ember Syndicate Support Portal Actions"
+
+	actionTokenKeyFmt = "support::token::action::%s"
+)
+
+// Purpose restricts an action token to the single action that it was issued for
+type Purpose string
+
+const (
+	PurposeVerifyEmail   Purpose = "verify-email"
+	PurposeResetPassword Purpose = "reset-password"
+)
+
+// ActionClaims are the claims of an action token that has been consumed
+type ActionClaims struct {
+	UserID string
+	Email  string
+}
+
+// IssueActionToken signs a single use token that authorizes the purpose on behalf of the user until ttl elapses.
+// The email the token was sent to is embedded so that the token is invalidated if the email of the user changes
+func (s *service) IssueActionToken(ctx context.Context, userID, email string, purpose Purpose, ttl time.Duration) (string, error) {
+
+	now := time.Now().In(time.UTC)
+	jti := uuid.New().String()
+
+	t := jwt.New()
+	for k, v := range map[string]interface{}{
+		jwt.JwtIDKey:      jti,
+		jwt.SubjectKey:    fmt.Sprintf("SUPPORT::USER::%s", userID),
+		jwt.AudienceKey:   actionAudience,
+		jwt.IssuerKey:     issuer,
+		jwt.IssuedAtKey:   now.Unix(),
+		jwt.ExpirationKey: now.Add(ttl).Unix(),
+		`id`:              userID,
+		`email`:           email,
+		`purpose`:         string(purpose),
+	} {
+		err := t.Set(k, v)
+		if err != nil {
+			return "", fmt.Errorf("failed to set %s on token: %w", k, err)
+		}
+	}
+
+	privateKey := s.key.GetPrivateJWK()
+
+	signed, err := jwt.Sign(t, jwa.SignatureAlgorithm(privateKey.Algorithm()), privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	// The token is only valid while its jti is stored, deleting the jti when it is consumed makes it single use
+	_, err = s.redis.Set(ctx, fmt.Sprintf(actionTokenKeyFmt, jti), userID, ttl).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to store action token: %w", err)
+	}
+
+	return string(signed), nil
+
+}
+
+// VerifyActionToken verifies that the token was issued for the purpose and has not been used
+// or revoked yet without consuming it
+func (s *service) VerifyActionToken(ctx context.Context, t string, purpose Purpose) (*ActionClaims, error) {
+
+	_, claims, err := s.verifyActionToken(ctx, t, purpose)
+
+	return claims, err
+
+}
+
+// ConsumeActionToken verifies that the token was issued for the purpose and has not been used
+// or revoked yet. The token cannot be consumed again once ConsumeActionToken has returned its claims
+func (s *service) ConsumeActionToken(ctx context.Context, t string, purpose Purpose) (*ActionClaims, error) {
+
+	jti, claims, err := s.verifyActionToken(ctx, t, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := s.redis.Del(ctx, fmt.Sprintf(actionTokenKeyFmt, jti)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume action token: %w", err)
+	}
+
+	if deleted == 0 {
+		return nil, fmt.Errorf("token has already been used")
+	}
+
+	return claims, nil
+
+}
+
+func (s *service) verifyActionToken(ctx context.Context, t string, purpose Purpose) (string, *ActionClaims, error) {
+
+	set, err := s.getSet()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to fetch jwk set from key service: %w", err)
+	}
+
+	token, err := jwt.ParseString(t, jwt.WithKeySet(set))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	if token.Issuer() == "" || len(token.Audience()) == 0 || token.Expiration().IsZero() || token.JwtID() == "" {
+		return "", nil, fmt.Errorf("token is missing one or more required claims")
+	}
+
+	err = jwt.Validate(token, jwt.WithIssuer(issuer), jwt.WithAudience(actionAudience))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to validate token: %w", err)
+	}
+
+	claim, _ := token.Get("purpose")
+	if p, _ := claim.(string); p != string(purpose) {
+		return "", nil, fmt.Errorf("token was not issued for %s", purpose)
+	}
+
+	userID, err := s.GetUserIDFromToken(token)
+	if err != nil {
+		return "", nil, err
+	}
+
+	email, _ := token.Get("email")
+
+	notBefore, err := s.userNotBefore(ctx, userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if token.IssuedAt().Before(notBefore) {
+		return "", nil, fmt.Errorf("token has been revoked")
+	}
+
+	stored, err := s.redis.Exists(ctx, fmt.Sprintf(actionTokenKeyFmt, token.JwtID())).Result()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to fetch action token: %w", err)
+	}
+
+	if stored == 0 {
+		return "", nil, fmt.Errorf("token has already been used")
+	}
+
+	claims := &ActionClaims{UserID: userID}
+	claims.Email, _ = email.(string)
+
+	return token.JwtID(), claims, nil
+
+}
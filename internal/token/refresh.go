@@ -0,0 +1,231 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/jwt"
+)
+
+const (
+	refreshTokenTTL = time.Hour * 24 * 30
+
+	revokedTokenKeyFmt  = "support::token::revoked::%s"
+	refreshTokenKeyFmt  = "support::refresh::%s"
+	refreshUsedKeyFmt   = "support::refresh::%s::used"
+	refreshFamilyKeyFmt = "support::refresh::family::%s"
+	userNotBeforeKeyFmt = "support::token::user::%s::notBefore"
+
+	familyRevoked = "revoked"
+)
+
+// ErrInvalidRefreshToken is returned when a refresh token does not exist, has expired
+// or does not belong to the user that presented it
+var ErrInvalidRefreshToken = errors.New("refresh token is invalid or has expired")
+
+// refreshToken is the record that is stored in redis for every refresh token that is issued.
+// Every token that descends from the same login shares a Family so that the entire chain
+// can be revoked if a token that has already been rotated is presented again
+type refreshToken struct {
+	UserID   string `json:"userID"`
+	Family   string `json:"family"`
+	IssuedAt int64  `json:"issuedAt"`
+}
+
+// IssueRefreshToken generates an opaque refresh token for the user. Only a hash of the token
+// is stored. An empty family starts a new family of tokens
+func (s *service) IssueRefreshToken(ctx context.Context, userID string, family string) (string, error) {
+
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	if family == "" {
+		family = uuid.New().String()
+	}
+
+	data, err := json.Marshal(refreshToken{UserID: userID, Family: family, IssuedAt: time.Now().Unix()})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode refresh token: %w", err)
+	}
+
+	_, err = s.redis.Set(ctx, fmt.Sprintf(refreshTokenKeyFmt, hashRefreshToken(token)), data, refreshTokenTTL).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return token, nil
+
+}
+
+// RotateRefreshToken exchanges a refresh token for a new token of the same family. Every refresh token
+// may only be used once. Presenting a token that has already been used is treated as a sign that the token
+// has been stolen and revokes every token in its family
+func (s *service) RotateRefreshToken(ctx context.Context, token string) (string, string, error) {
+
+	hash := hashRefreshToken(token)
+
+	record, err := s.refreshToken(ctx, hash)
+	if err != nil {
+		return "", "", err
+	}
+
+	status, err := s.redis.Get(ctx, fmt.Sprintf(refreshFamilyKeyFmt, record.Family)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", "", fmt.Errorf("failed to fetch refresh token family: %w", err)
+	}
+
+	if status == familyRevoked {
+		return "", "", fmt.Errorf("refresh token has been revoked")
+	}
+
+	notBefore, err := s.userNotBefore(ctx, record.UserID)
+	if err != nil {
+		return "", "", err
+	}
+
+	if time.Unix(record.IssuedAt, 0).Before(notBefore) {
+		return "", "", fmt.Errorf("refresh token has been revoked")
+	}
+
+	first, err := s.redis.SetNX(ctx, fmt.Sprintf(refreshUsedKeyFmt, hash), time.Now().Unix(), refreshTokenTTL).Result()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to mark refresh token as used: %w", err)
+	}
+
+	if !first {
+		err = s.revokeFamily(ctx, record.Family)
+		if err != nil {
+			return "", "", err
+		}
+
+		return "", "", fmt.Errorf("refresh token has already been used, all sessions derived from it have been revoked")
+	}
+
+	next, err := s.IssueRefreshToken(ctx, record.UserID, record.Family)
+	if err != nil {
+		return "", "", err
+	}
+
+	return record.UserID, next, nil
+
+}
+
+// RevokeRefreshToken revokes the family that the refresh token belongs to. The token is only revoked
+// when it was issued to the provided user, ErrInvalidRefreshToken is returned otherwise
+func (s *service) RevokeRefreshToken(ctx context.Context, token string, userID string) error {
+
+	record, err := s.refreshToken(ctx, hashRefreshToken(token))
+	if err != nil {
+		return err
+	}
+
+	if record.UserID != userID {
+		return ErrInvalidRefreshToken
+	}
+
+	return s.revokeFamily(ctx, record.Family)
+
+}
+
+// RevokeToken adds the jti of the access token to the revocation list until the token expires
+func (s *service) RevokeToken(ctx context.Context, t jwt.Token) error {
+
+	if t == nil || t.JwtID() == "" {
+		return fmt.Errorf("token does not have a jti and cannot be revoked")
+	}
+
+	ttl := time.Until(t.Expiration())
+	if ttl <= 0 {
+		return nil
+	}
+
+	_, err := s.redis.Set(ctx, fmt.Sprintf(revokedTokenKeyFmt, t.JwtID()), time.Now().Unix(), ttl).Result()
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	return nil
+
+}
+
+// RevokeUserTokens invalidates every access and refresh token that has been issued
+// to the user so far. Tokens are issued with second precision, so a token issued
+// during the same second as the revocation remains valid
+func (s *service) RevokeUserTokens(ctx context.Context, userID string) error {
+
+	now := time.Now().Unix()
+
+	_, err := s.redis.Set(ctx, fmt.Sprintf(userNotBeforeKeyFmt, userID), now, refreshTokenTTL).Result()
+	if err != nil {
+		return fmt.Errorf("failed to revoke tokens of user %s: %w", userID, err)
+	}
+
+	return nil
+
+}
+
+// userNotBefore returns the time before which every token issued to the user has been revoked.
+// The zero time is returned when the tokens of the user have never been revoked
+func (s *service) userNotBefore(ctx context.Context, userID string) (time.Time, error) {
+
+	value, err := s.redis.Get(ctx, fmt.Sprintf(userNotBeforeKeyFmt, userID)).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("failed to fetch token revocations of user %s: %w", userID, err)
+	}
+
+	return time.Unix(value, 0), nil
+
+}
+
+func (s *service) refreshToken(ctx context.Context, hash string) (*refreshToken, error) {
+
+	data, err := s.redis.Get(ctx, fmt.Sprintf(refreshTokenKeyFmt, hash)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("failed to fetch refresh token: %w", err)
+	}
+
+	var record = new(refreshToken)
+	err = json.Unmarshal(data, record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode refresh token: %w", err)
+	}
+
+	return record, nil
+
+}
+
+func (s *service) revokeFamily(ctx context.Context, family string) error {
+
+	_, err := s.redis.Set(ctx, fmt.Sprintf(refreshFamilyKeyFmt, family), familyRevoked, refreshTokenTTL).Result()
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
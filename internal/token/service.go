@@ -7,6 +7,7 @@ import (
 
 	"github.com/embersyndicate/support"
 	"github.com/embersyndicate/support/internal/key"
+	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"github.com/lestrrat-go/jwx/jwa"
 	"github.com/lestrrat-go/jwx/jwk"
@@ -14,24 +15,79 @@ import (
 	"github.com/newrelic/go-agent/v3/newrelic"
 )
 
+const (
+	issuer   = "Ember Syndicate"
+	audience = "Ember Syndicate Support Portal Users"
+
+	// AccessTokenTTL is the lifetime of an access token
+	AccessTokenTTL = time.Hour
+)
+
 type Service interface {
 	BuildAndSignUserKey(ctx context.Context, user *support.User) ([]byte, error)
 	ParseAndVerifyToken(context.Context, string) (jwt.Token, error)
 	GetUserIDFromToken(t jwt.Token) (string, error)
+	GetRoleFromToken(t jwt.Token) string
+	GetPermissionsFromToken(t jwt.Token) []string
+	RevokeToken(ctx context.Context, t jwt.Token) error
+	RevokeUserTokens(ctx context.Context, userID string) error
+
+	IssueTokens(ctx context.Context, user *support.User, refreshToken string) (*Tokens, error)
+	IssueRefreshToken(ctx context.Context, userID string, family string) (string, error)
+	RotateRefreshToken(ctx context.Context, refreshToken string) (userID string, next string, err error)
+	RevokeRefreshToken(ctx context.Context, refreshToken string, userID string) error
+
+	IssueActionToken(ctx context.Context, userID, email string, purpose Purpose, ttl time.Duration) (string, error)
+	VerifyActionToken(ctx context.Context, t string, purpose Purpose) (*ActionClaims, error)
+	ConsumeActionToken(ctx context.Context, t string, purpose Purpose) (*ActionClaims, error)
+}
+
+// Tokens is the pair of tokens that is handed to a user once they have been authenticated
+type Tokens struct {
+	AccessToken  string    `json:"accessToken"`
+	RefreshToken string    `json:"refreshToken"`
+	ExpiresAt    time.Time `json:"expiresAt"`
 }
 
 type service struct {
-	key key.Service
+	key   key.Service
+	redis *redis.Client
 }
 
 func New(
 	key key.Service,
+	redis *redis.Client,
 ) Service {
 	return &service{
-		key: key,
+		key:   key,
+		redis: redis,
 	}
 }
 
+// IssueTokens signs a new access token for the user and pairs it with the provided refresh token.
+// When refreshToken is empty, a refresh token that starts a new family is issued
+func (s *service) IssueTokens(ctx context.Context, user *support.User, refreshToken string) (*Tokens, error) {
+
+	access, err := s.BuildAndSignUserKey(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if refreshToken == "" {
+		refreshToken, err = s.IssueRefreshToken(ctx, user.ID.Hex(), "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Tokens{
+		AccessToken:  string(access),
+		RefreshToken: refreshToken,
+		ExpiresAt:    time.Now().Add(AccessTokenTTL).In(time.UTC),
+	}, nil
+
+}
+
 func (s *service) BuildAndSignUserKey(ctx context.Context, user *support.User) ([]byte, error) {
 
 	now := time.Now().In(time.UTC)
@@ -47,12 +103,12 @@ func (s *service) BuildAndSignUserKey(ctx context.Context, user *support.User) (
 		return nil, fmt.Errorf("failed to set %s on token: %w", jwt.SubjectKey, err)
 	}
 
-	err = t.Set(jwt.AudienceKey, "Ember Syndicate Support Portal Users")
+	err = t.Set(jwt.AudienceKey, audience)
 	if err != nil {
 		return nil, fmt.Errorf("failed to set %s on token: %w", jwt.AudienceKey, err)
 	}
 
-	err = t.Set(jwt.IssuerKey, "Ember Syndicate")
+	err = t.Set(jwt.IssuerKey, issuer)
 	if err != nil {
 		return nil, fmt.Errorf("failed to set %s on token: %w", jwt.IssuerKey, err)
 	}
@@ -62,7 +118,7 @@ func (s *service) BuildAndSignUserKey(ctx context.Context, user *support.User) (
 		return nil, fmt.Errorf("failed to set %s on token: %w", jwt.IssuedAtKey, err)
 	}
 
-	err = t.Set(jwt.ExpirationKey, now.Add(time.Hour*8).Unix())
+	err = t.Set(jwt.ExpirationKey, now.Add(AccessTokenTTL).Unix())
 	if err != nil {
 		return nil, fmt.Errorf("failed to set %s key  on token: %w", jwt.ExpirationKey, err)
 	}
@@ -77,7 +133,32 @@ func (s *service) BuildAndSignUserKey(ctx context.Context, user *support.User) (
 		return nil, fmt.Errorf("failed to set %s on token: %w", "user id", err)
 	}
 
-	signed, err := jwt.Sign(t, jwa.RS256, s.key.GetPrivateJWK())
+	role := user.Role
+	if role == "" {
+		role = support.RoleUser
+	}
+
+	err = t.Set(`role`, role.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to set %s on token: %w", "role", err)
+	}
+
+	effective := user.EffectivePermissions()
+	permissions := make([]string, len(effective))
+	for i, permission := range effective {
+		permissions[i] = permission.String()
+	}
+
+	err = t.Set(`permissions`, permissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set %s on token: %w", "permissions", err)
+	}
+
+	// The algorithm is taken from the key itself so that a key rotated
+	// by another process is always paired with its own algorithm
+	privateKey := s.key.GetPrivateJWK()
+
+	signed, err := jwt.Sign(t, jwa.SignatureAlgorithm(privateKey.Algorithm()), privateKey)
 	if err != nil {
 		return nil, err
 	}
@@ -101,6 +182,40 @@ func (s *service) ParseAndVerifyToken(ctx context.Context, t string) (jwt.Token,
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 
+	// jwt.Validate skips claims that are missing from the token,
+	// so confirm that each of the claims we rely on is present before validating them
+	if token.Issuer() == "" || len(token.Audience()) == 0 || token.Expiration().IsZero() || token.JwtID() == "" {
+		return nil, fmt.Errorf("token is missing one or more required claims")
+	}
+
+	err = jwt.Validate(token, jwt.WithIssuer(issuer), jwt.WithAudience(audience))
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate token: %w", err)
+	}
+
+	revoked, err := s.redis.Exists(ctx, fmt.Sprintf(revokedTokenKeyFmt, token.JwtID())).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check token revocation list: %w", err)
+	}
+
+	if revoked > 0 {
+		return nil, fmt.Errorf("token has been revoked")
+	}
+
+	userID, err := s.GetUserIDFromToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	notBefore, err := s.userNotBefore(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.IssuedAt().Before(notBefore) {
+		return nil, fmt.Errorf("token has been revoked")
+	}
+
 	return token, nil
 
 }
@@ -120,6 +235,42 @@ func (s *service) GetUserIDFromToken(t jwt.Token) (string, error) {
 
 }
 
+func (s *service) GetRoleFromToken(t jwt.Token) string {
+
+	role, ok := t.Get("role")
+	if !ok {
+		return ""
+	}
+
+	r, _ := role.(string)
+
+	return r
+
+}
+
+func (s *service) GetPermissionsFromToken(t jwt.Token) []string {
+
+	claim, ok := t.Get("permissions")
+	if !ok {
+		return nil
+	}
+
+	values, ok := claim.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	permissions := make([]string, 0, len(values))
+	for _, v := range values {
+		if permission, ok := v.(string); ok {
+			permissions = append(permissions, permission)
+		}
+	}
+
+	return permissions
+
+}
+
 // Returns a *jwk.Set that ParseToken uses to validate a JWT
 func (s *service) getSet() (*jwk.Set, error) {
 
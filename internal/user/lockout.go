@@ -0,0 +1,105 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/embersyndicate/support/pkg/middleware"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	loginFailuresKeyFmt = "support::login::failures::%s"
+	loginLockKeyFmt     = "support::login::lock::%s"
+
+	// lockoutThreshold is the number of consecutive failed logins within lockoutWindow that locks an account.
+	// Every further failure doubles the lockout, starting at lockoutBase and up to lockoutMax
+	lockoutThreshold = 5
+	lockoutWindow    = time.Minute * 15
+	lockoutBase      = time.Second * 30
+	lockoutMax       = time.Hour
+)
+
+// loginAccountLimit is the number of login attempts, successful or not, that may be made against a single account
+var loginAccountLimit = middleware.Limit{Requests: 20, Window: time.Hour}
+
+// newDummyHash returns the hash that passwords are compared against when the user does not exist,
+// so that logins for unknown users take as long as logins for users that exist
+func newDummyHash() ([]byte, error) {
+
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate dummy password: %w", err)
+	}
+
+	return bcrypt.GenerateFromPassword(buf, bcrypt.DefaultCost)
+
+}
+
+// lockedOut returns how long logins for the subject remain locked
+func (s *service) lockedOut(ctx context.Context, subject string) (time.Duration, error) {
+
+	ttl, err := s.redis.PTTL(ctx, fmt.Sprintf(loginLockKeyFmt, subject)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch login lock: %w", err)
+	}
+
+	// PTTL reports a negative duration when the key does not exist
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
+
+}
+
+// recordLoginFailure counts a failed login for the subject, locking the subject
+// once lockoutThreshold has been reached. Unknown identifiers are counted and locked
+// just like existing users so that lockouts do not reveal which accounts exist
+func (s *service) recordLoginFailure(ctx context.Context, subject string) error {
+
+	key := fmt.Sprintf(loginFailuresKeyFmt, subject)
+
+	pipe := s.redis.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, lockoutWindow)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	failures := incr.Val()
+	if failures < lockoutThreshold {
+		return nil
+	}
+
+	lockout := lockoutMax
+	if shift := failures - lockoutThreshold; shift < 16 {
+		lockout = lockoutBase << uint(shift)
+		if lockout > lockoutMax {
+			lockout = lockoutMax
+		}
+	}
+
+	_, err = s.redis.Set(ctx, fmt.Sprintf(loginLockKeyFmt, subject), failures, lockout).Result()
+	if err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+
+	return nil
+
+}
+
+func (s *service) clearLoginFailures(ctx context.Context, subject string) error {
+
+	_, err := s.redis.Del(ctx, fmt.Sprintf(loginFailuresKeyFmt, subject)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to clear login failures: %w", err)
+	}
+
+	return nil
+
+}
@@ -2,58 +2,99 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/embersyndicate/support"
+	"github.com/embersyndicate/support/internal"
+	"github.com/embersyndicate/support/internal/audit"
 	"github.com/embersyndicate/support/internal/key"
+	"github.com/embersyndicate/support/internal/mailer"
+	"github.com/embersyndicate/support/internal/password"
 	"github.com/embersyndicate/support/internal/token"
 	"github.com/embersyndicate/support/pkg/middleware"
-	"github.com/hesahesa/pwdbro"
-	"github.com/hesahesa/pwdbro/checker"
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Service interface {
-	Login(ctx context.Context, user *support.User) ([]byte, error)
+	Login(ctx context.Context, credentials *support.Credentials) (*token.Tokens, error)
+	Refresh(ctx context.Context, refreshToken string) (*token.Tokens, error)
+	Logout(ctx context.Context, refreshToken string) error
 	Register(ctx context.Context, user *support.User) (*support.User, error)
+
+	User(ctx context.Context, id string) (*support.User, error)
+	UpdateUser(ctx context.Context, id string, user *support.User) (*support.User, error)
+	ChangePassword(ctx context.Context, change *support.PasswordChange) error
+	DeleteUser(ctx context.Context, id string) error
+
+	RequestEmailVerification(ctx context.Context) error
+	ConfirmEmailVerification(ctx context.Context, token string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ConfirmPasswordReset(ctx context.Context, reset *support.PasswordReset) error
 }
 
+// errInvalidCredentials is returned for every failed login, whatever the reason
+var errInvalidCredentials = internal.NewInternalError(internal.LevelBad, "username/password combination is invalid")
+
+const (
+	verifyEmailTTL   = time.Hour * 24
+	resetPasswordTTL = time.Hour
+)
+
 type service struct {
-	pwdbro *pwdbro.PwdBro
-	client *http.Client
+	policy password.Policy
+
+	redis     *redis.Client
+	limiter   *middleware.RateLimiter
+	dummyHash []byte
 
-	key   key.Service
-	token token.Service
+	key    key.Service
+	token  token.Service
+	audit  audit.Service
+	mailer mailer.Mailer
+
+	// portalURL is the address of the portal that the links in emails point to
+	portalURL string
 
 	userStore support.UserRepository
 	// userCache support.UserRepository
 }
 
-func New(client *http.Client, key key.Service, token token.Service, user support.UserRepository) Service {
-
-	pwd := pwdbro.NewEmptyPwdBro()
+func New(policy password.Policy, key key.Service, token token.Service, audit audit.Service, mailer mailer.Mailer, portalURL string, redis *redis.Client, user support.UserRepository) (Service, error) {
 
-	// AddChecker always returns nil for err
-	_ = pwd.AddChecker(&checker.Pwnedpasswords{
-		HTTPClient: client,
-	})
+	dummyHash, err := newDummyHash()
+	if err != nil {
+		return nil, err
+	}
 
 	s := &service{
-		pwdbro: pwd,
-		client: client,
+		policy: policy,
+
+		redis:     redis,
+		limiter:   middleware.NewRateLimiter(redis),
+		dummyHash: dummyHash,
 
 		key:       key,
 		token:     token,
+		audit:     audit,
+		mailer:    mailer,
+		portalURL: strings.TrimSuffix(portalURL, "/"),
 		userStore: user,
 	}
 
-	return s
+	return s, nil
 }
 
-func (s *service) Login(ctx context.Context, user *support.User) ([]byte, error) {
+// Login authenticates the user whose username or email matches the identifier of the credentials.
+// Both are compared case-insensitively
+func (s *service) Login(ctx context.Context, credentials *support.Credentials) (*token.Tokens, error) {
 
-	err := user.VerifyLoginAttributes()
+	err := credentials.VerifyAttributes()
 	if err != nil {
 		return nil, err
 	}
@@ -61,9 +102,10 @@ func (s *service) Login(ctx context.Context, user *support.User) ([]byte, error)
 	users, err := s.userStore.Users(
 		ctx,
 		support.NewOrOperator(
-			support.NewEqualOperator(support.UserUsername, user.Username),
-			support.NewEqualOperator(support.UserEmail, user.Email),
+			support.NewEqualOperator(support.UserUsername, strings.TrimSpace(credentials.Identifier)),
+			support.NewEqualOperator(support.UserEmail, support.NormalizeEmail(credentials.Identifier)),
 		),
+		support.NewExistsOperator(support.UserDeletedAt, false),
 		support.NewLimitOperator(1),
 	)
 	if err != nil {
@@ -71,54 +113,148 @@ func (s *service) Login(ctx context.Context, user *support.User) ([]byte, error)
 		return nil, fmt.Errorf("failed to query for user")
 	}
 
-	if len(users) == 0 {
-		return nil, fmt.Errorf("username not found")
+	// Failures are counted against the user when they exist, so that alternating between their username
+	// and email does not extend the budget, and against the identifier when they do not
+	var local *support.User
+	hash := s.dummyHash
+	subject := fmt.Sprintf("unknown::%s", strings.ToLower(strings.TrimSpace(credentials.Identifier)))
+	if len(users) > 0 {
+		local = users[0]
+		hash = []byte(local.Password)
+		subject = local.ID.Hex()
+	}
+
+	locked, err := s.lockedOut(ctx, subject)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
 	}
 
-	local := users[0]
+	if locked > 0 {
+		return nil, internal.NewTooManyError("too many failed login attempts, try again later", locked)
+	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(local.Password), []byte(user.Password))
+	result, err := s.limiter.Allow(ctx, "login-account", subject, loginAccountLimit)
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
-		return nil, fmt.Errorf("username/password combination is invalid")
 	}
 
-	key, err := s.token.BuildAndSignUserKey(ctx, local)
+	if result != nil && !result.Allowed {
+		return nil, internal.NewTooManyError("too many login attempts, try again later", result.Reset)
+	}
+
+	// The password is compared even when the user does not exist so that
+	// the time taken to respond does not reveal whether the user exists
+	err = bcrypt.CompareHashAndPassword(hash, []byte(credentials.Password))
+	if err != nil || local == nil {
+		middleware.LogEntrySetError(ctx, fmt.Errorf("failed login for %s: %v", subject, err))
+
+		err = s.recordLoginFailure(ctx, subject)
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+		}
+
+		return nil, errInvalidCredentials
+	}
+
+	err = s.clearLoginFailures(ctx, subject)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+	}
+
+	tokens, err := s.token.IssueTokens(ctx, local, "")
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
 		return nil, fmt.Errorf("failed to generate token")
 	}
 
-	return key, nil
+	return tokens, nil
 
 }
 
-func (s *service) Register(ctx context.Context, user *support.User) (*support.User, error) {
+func (s *service) Refresh(ctx context.Context, refreshToken string) (*token.Tokens, error) {
 
-	if err := user.VerifyRegisterAttributes(); err != nil {
+	if refreshToken == "" {
+		return nil, fmt.Errorf("refresh token required, received empty value")
+	}
+
+	userID, next, err := s.token.RotateRefreshToken(ctx, refreshToken)
+	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
-		return nil, err
+		return nil, fmt.Errorf("refresh token is invalid")
 	}
 
-	// Confirm that the user does not exist
-	users, err := s.userStore.Users(ctx, support.NewOrOperator(support.NewEqualOperator(support.UserUsername, user.Username), support.NewEqualOperator(support.UserEmail, user.Email)))
+	user, err := s.userStore.User(ctx, userID)
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
-		return nil, fmt.Errorf("failed to query users for username")
+		return nil, fmt.Errorf("refresh token is invalid")
 	}
 
-	if len(users) > 0 {
-		return nil, fmt.Errorf("username is not unique")
+	if user.DeletedAt != nil {
+		return nil, fmt.Errorf("refresh token is invalid")
 	}
 
-	err = s.checkPassword(ctx, user.Password)
+	// The access token is rebuilt from the stored user so that changes to their role take effect on refresh
+	tokens, err := s.token.IssueTokens(ctx, user, next)
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
+		return nil, fmt.Errorf("failed to generate token")
+	}
+
+	return tokens, nil
+
+}
+
+// Logout revokes the access token on the context and, when provided,
+// every refresh token in the family of the provided refresh token. A refresh token that
+// is invalid, has expired or belongs to another user is ignored
+func (s *service) Logout(ctx context.Context, refreshToken string) error {
+
+	err := s.token.RevokeToken(ctx, middleware.GetTokenFromContext(ctx))
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return fmt.Errorf("failed to revoke token")
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	userID, _ := middleware.GetUserIDFromContext(ctx)
+
+	err = s.token.RevokeRefreshToken(ctx, refreshToken, userID)
+	if errors.Is(err, token.ErrInvalidRefreshToken) {
+		return nil
+	}
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return fmt.Errorf("failed to revoke refresh token")
+	}
+
+	return nil
+
+}
+
+func (s *service) Register(ctx context.Context, user *support.User) (*support.User, error) {
+
+	if err := user.VerifyRegisterAttributes(); err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, err
+	}
+
+	user.Username = strings.TrimSpace(user.Username)
+	user.Email = support.NormalizeEmail(user.Email)
+
+	err := s.checkPassword(ctx, user.Password, user)
+	if err != nil {
 		return nil, err
 	}
 
-	// If the username is unique and the password is not compromised or weak, lets replace the plain text password that was passed to us
-	// with a hashed password
+	// Elevated access is granted out of band, it can never be requested during registration
+	user.Role = support.RoleUser
+	user.Permissions = nil
+
+	// If the password is not compromised or weak, lets replace the plain text password that was passed to us
+	// with a hashed password. Uniqueness of the username and email is enforced by the indexes of the user store
 	user.Password, err = hashAndSaltPassword(ctx, user.Password)
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
@@ -128,49 +264,528 @@ func (s *service) Register(ctx context.Context, user *support.User) (*support.Us
 	user, err = s.userStore.CreateUser(ctx, user)
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
+		if conflict := uniqueUserConflict(err); conflict != nil {
+			return nil, conflict
+		}
 		return nil, fmt.Errorf("failed to register user")
 	}
 
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityUser,
+		EntityID: user.ID,
+		Action:   support.AuditActionCreate,
+	}, nil, user)
+
+	// Failing to deliver the verification email does not fail the registration,
+	// the user is able to request another email once they have logged in
+	err = s.sendEmailVerification(ctx, user)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+	}
+
 	// Sanitize the users password so it is not output upstream
 	user.Password = ""
 
-	return user, err
+	return user, nil
 }
 
-func hashAndSaltPassword(ctx context.Context, p string) (string, error) {
+func (s *service) User(ctx context.Context, id string) (*support.User, error) {
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(p), bcrypt.DefaultCost)
+	if !s.canManage(ctx, id) {
+		return nil, internal.NewInternalError(internal.LevelForbidden, "users may only be viewed by themselves or an administrator")
+	}
+
+	user, err := s.userStore.User(ctx, id)
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
-		return "", fmt.Errorf("failed to generate password hash")
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
 	}
 
-	return string(hash), nil
+	user.Password = ""
+
+	return user, nil
+
+}
+
+// UpdateUser applies the changes described by the provided user to the user identified by id. Non-empty
+// names, email and username replace the current values. Changing the role or permissions of a user requires
+// the user:manage permission and revokes the existing sessions of the user so that their access is reevaluated.
+// Passwords cannot be changed through UpdateUser, all other attributes of the provided user are ignored
+func (s *service) UpdateUser(ctx context.Context, id string, user *support.User) (*support.User, error) {
+
+	if !s.canManage(ctx, id) {
+		return nil, internal.NewInternalError(internal.LevelForbidden, "users may only be updated by themselves or an administrator")
+	}
+
+	current, err := s.userStore.User(ctx, id)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil, internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	if current.DeletedAt != nil {
+		return nil, internal.NewInternalError(internal.LevelBad, "user has been deleted")
+	}
+
+	before := audit.Snapshot(current)
+
+	if user.FirstName != "" {
+		current.FirstName = user.FirstName
+	}
+
+	if user.LastName != "" {
+		current.LastName = user.LastName
+	}
+
+	if user.Username != "" {
+		current.Username = strings.TrimSpace(user.Username)
+	}
+
+	// A changed email address has to be verified again
+	var reverify bool
+	if user.Email != "" && support.NormalizeEmail(user.Email) != current.Email {
+		current.Email = support.NormalizeEmail(user.Email)
+		current.EmailVerifiedAt = nil
+		reverify = true
+	}
+
+	var revoke bool
+
+	if user.Role != "" && user.Role != current.Role {
+		if !middleware.HasPermissionFromContext(ctx, support.PermissionManageUsers.String()) {
+			return nil, internal.NewInternalError(internal.LevelForbidden, "only administrators may change the role of a user")
+		}
+
+		if !user.Role.Valid() {
+			return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("invalid role %s", user.Role))
+		}
+
+		current.Role = user.Role
+		revoke = true
+	}
+
+	if user.Permissions != nil {
+		if !middleware.HasPermissionFromContext(ctx, support.PermissionManageUsers.String()) {
+			return nil, internal.NewInternalError(internal.LevelForbidden, "only administrators may change the permissions of a user")
+		}
+
+		for _, permission := range user.Permissions {
+			if !permission.Valid() {
+				return nil, internal.NewInternalError(internal.LevelBad, fmt.Sprintf("invalid permission %s", permission))
+			}
+		}
+
+		current.Permissions = user.Permissions
+		revoke = true
+	}
+
+	current, err = s.userStore.UpdateUser(ctx, id, current)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		if conflict := uniqueUserConflict(err); conflict != nil {
+			return nil, conflict
+		}
+		return nil, internal.NewInternalError(internal.LevelInternal, fmt.Sprintf("failed to update user %s", id))
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityUser,
+		EntityID: current.ID,
+		Action:   support.AuditActionUpdate,
+	}, before, current)
+
+	if revoke {
+		err = s.token.RevokeUserTokens(ctx, id)
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+			return nil, internal.NewInternalError(internal.LevelInternal, "failed to revoke existing sessions of user")
+		}
+	}
+
+	if reverify {
+		err = s.sendEmailVerification(ctx, current)
+		if err != nil {
+			middleware.LogEntrySetError(ctx, err)
+		}
+	}
+
+	current.Password = ""
+
+	return current, nil
 
 }
 
-func (s *service) checkPassword(ctx context.Context, password string) error {
+// ChangePassword replaces the password of the authenticated user once their current password has been
+// confirmed. Every session of the user, including the session making the request, is revoked
+func (s *service) ChangePassword(ctx context.Context, change *support.PasswordChange) error {
+
+	err := change.VerifyAttributes()
+	if err != nil {
+		return internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	userID, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("failed to retrieve user id from context")
+	}
+
+	user, err := s.userStore.User(ctx, userID)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, "failed to fetch user")
+	}
 
-	if len(password) < 12 {
-		err := fmt.Errorf("passwords must be atleast 12 chars long")
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(change.CurrentPassword))
+	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelBad, "current password is invalid")
+	}
+
+	err = s.checkPassword(ctx, change.NewPassword, user)
+	if err != nil {
+		return err
+	}
+
+	before := audit.Snapshot(user)
+
+	user.Password, err = hashAndSaltPassword(ctx, change.NewPassword)
+	if err != nil {
 		return err
 	}
 
-	// Check password strength
-	statuses, err := s.pwdbro.RunChecks(password)
+	_, err = s.userStore.UpdateUser(ctx, userID, user)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, "failed to update password")
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityUser,
+		EntityID: user.ID,
+		Action:   support.AuditActionChangePassword,
+	}, before, user)
+
+	err = s.token.RevokeUserTokens(ctx, userID)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, "failed to revoke existing sessions")
+	}
+
+	return nil
+
+}
+
+// DeleteUser soft deletes the user and revokes all of their sessions. Tickets
+// submitted by the user remain, attributed to the anonymised user
+func (s *service) DeleteUser(ctx context.Context, id string) error {
+
+	if !middleware.HasPermissionFromContext(ctx, support.PermissionManageUsers.String()) {
+		return internal.NewInternalError(internal.LevelForbidden, "only administrators may delete users")
+	}
+
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return internal.NewInternalError(internal.LevelBad, fmt.Sprintf("unable to cast %s to ObjectID", id))
+	}
+
+	err = s.userStore.DeleteUser(ctx, id)
 	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
-		return fmt.Errorf("failed to validate password")
+		return internal.NewInternalError(internal.LevelBad, fmt.Sprintf("failed to delete user %s: %s", id, err))
 	}
 
-	// Status is a slice of statuses whose length is equal to the number of checkers in teh instance of pwdbro.
-	// Since we only have one checker registered, lets grab the entry at index 0
-	status := statuses[0]
-	if !status.Safe {
+	// The personal details of the user are anonymised by the deletion, so the event does not record them
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityUser,
+		EntityID: _id,
+		Action:   support.AuditActionDelete,
+	}, nil, nil)
+
+	err = s.token.RevokeUserTokens(ctx, id)
+	if err != nil {
 		middleware.LogEntrySetError(ctx, err)
-		return fmt.Errorf("invalid or weak password detected")
+		return internal.NewInternalError(internal.LevelInternal, "failed to revoke sessions of deleted user")
 	}
 
 	return nil
+
+}
+
+// RequestEmailVerification emails a new verification link to the authenticated user
+func (s *service) RequestEmailVerification(ctx context.Context) error {
+
+	userID, ok := middleware.GetUserIDFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("failed to retrieve user id from context")
+	}
+
+	user, err := s.userStore.User(ctx, userID)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, "failed to fetch user")
+	}
+
+	if user.EmailVerified() {
+		return internal.NewInternalError(internal.LevelBad, "email address has already been verified")
+	}
+
+	err = s.sendEmailVerification(ctx, user)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, "failed to send verification email")
+	}
+
+	return nil
+
+}
+
+// ConfirmEmailVerification marks the email address that the token was sent to as verified,
+// provided that it is still the email address of the user
+func (s *service) ConfirmEmailVerification(ctx context.Context, t string) error {
+
+	if t == "" {
+		return internal.NewInternalError(internal.LevelBad, "token required, received empty value")
+	}
+
+	claims, err := s.token.ConsumeActionToken(ctx, t, token.PurposeVerifyEmail)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelBad, "verification token is invalid or has expired")
+	}
+
+	user, err := s.userStore.User(ctx, claims.UserID)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelBad, "verification token is invalid or has expired")
+	}
+
+	if user.DeletedAt != nil || user.Email != claims.Email {
+		return internal.NewInternalError(internal.LevelBad, "verification token is invalid or has expired")
+	}
+
+	if user.EmailVerified() {
+		return nil
+	}
+
+	before := audit.Snapshot(user)
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+
+	_, err = s.userStore.UpdateUser(ctx, claims.UserID, user)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, "failed to verify email address")
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityUser,
+		EntityID: user.ID,
+		Action:   support.AuditActionVerifyEmail,
+	}, before, user)
+
+	return nil
+
+}
+
+// RequestPasswordReset emails a password reset link to the user that owns the email address.
+// The outcome is the same whether or not a user owns the email address so that the request
+// cannot be used to discover which addresses are registered. For the same reason a failure to
+// generate or deliver the email is only logged
+func (s *service) RequestPasswordReset(ctx context.Context, email string) error {
+
+	if email == "" {
+		return internal.NewInternalError(internal.LevelBad, "email address required, received empty value")
+	}
+
+	users, err := s.userStore.Users(
+		ctx,
+		support.NewEqualOperator(support.UserEmail, support.NormalizeEmail(email)),
+		support.NewExistsOperator(support.UserDeletedAt, false),
+		support.NewLimitOperator(1),
+	)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, "failed to query for user")
+	}
+
+	if len(users) == 0 {
+		return nil
+	}
+
+	user := users[0]
+
+	t, err := s.token.IssueActionToken(ctx, user.ID.Hex(), user.Email, token.PurposeResetPassword, resetPasswordTTL)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil
+	}
+
+	err = s.mailer.Send(ctx, &mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nA password reset was requested for your account. Use the link below to choose a new password, the link expires in %s.\n\n%s/reset-password?token=%s\n\nIf you did not request a password reset you can ignore this email.\n",
+			user.FirstName, resetPasswordTTL, s.portalURL, url.QueryEscape(t),
+		),
+	})
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return nil
+	}
+
+	return nil
+
+}
+
+// ConfirmPasswordReset replaces the password of the user that the reset token was issued to
+// and revokes every session of the user. A successful reset also verifies the email address
+// of the user, as the token could only have been received through it
+func (s *service) ConfirmPasswordReset(ctx context.Context, reset *support.PasswordReset) error {
+
+	err := reset.VerifyAttributes()
+	if err != nil {
+		return internal.NewInternalError(internal.LevelBad, err.Error())
+	}
+
+	claims, err := s.token.VerifyActionToken(ctx, reset.Token, token.PurposeResetPassword)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelBad, "reset token is invalid or has expired")
+	}
+
+	user, err := s.userStore.User(ctx, claims.UserID)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelBad, "reset token is invalid or has expired")
+	}
+
+	if user.DeletedAt != nil || user.Email != claims.Email {
+		return internal.NewInternalError(internal.LevelBad, "reset token is invalid or has expired")
+	}
+
+	// The password is checked before the token is consumed so that a rejected password does not burn the token
+	err = s.checkPassword(ctx, reset.Password, user)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.token.ConsumeActionToken(ctx, reset.Token, token.PurposeResetPassword)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelBad, "reset token is invalid or has expired")
+	}
+
+	before := audit.Snapshot(user)
+
+	user.Password, err = hashAndSaltPassword(ctx, reset.Password)
+	if err != nil {
+		return err
+	}
+
+	if !user.EmailVerified() {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	_, err = s.userStore.UpdateUser(ctx, claims.UserID, user)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, "failed to update password")
+	}
+
+	s.audit.Record(ctx, &support.AuditEvent{
+		Entity:   support.AuditEntityUser,
+		EntityID: user.ID,
+		Action:   support.AuditActionResetPassword,
+	}, before, user)
+
+	err = s.token.RevokeUserTokens(ctx, claims.UserID)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, "failed to revoke existing sessions")
+	}
+
+	return nil
+
+}
+
+func (s *service) sendEmailVerification(ctx context.Context, user *support.User) error {
+
+	t, err := s.token.IssueActionToken(ctx, user.ID.Hex(), user.Email, token.PurposeVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return fmt.Errorf("failed to generate verification token: %w", err)
+	}
+
+	return s.mailer.Send(ctx, &mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm that this is your email address by following the link below, the link expires in %s.\n\n%s/verify-email?token=%s\n",
+			user.FirstName, verifyEmailTTL, s.portalURL, url.QueryEscape(t),
+		),
+	})
+
+}
+
+// canManage reports whether the authenticated user may view and edit the user identified by id
+func (s *service) canManage(ctx context.Context, id string) bool {
+
+	userID, _ := middleware.GetUserIDFromContext(ctx)
+
+	return userID == id || middleware.HasPermissionFromContext(ctx, support.PermissionManageUsers.String())
+
+}
+
+// uniqueUserConflict translates a violation of the unique indexes of the user store
+// into a conflict naming the field whose value is taken. Other errors return nil
+func uniqueUserConflict(err error) error {
+
+	if !internal.IsUniqueConstrainViolation(err) {
+		return nil
+	}
+
+	switch internal.DuplicateKeyIndex(err) {
+	case support.UserUsernameIndex:
+		return internal.NewConflictError("username is already in use", support.UserUsername)
+	case support.UserEmailIndex:
+		return internal.NewConflictError("email is already in use", support.UserEmail)
+	}
+
+	return internal.NewInternalError(internal.LevelConflict, "username or email is already in use")
+
+}
+
+func hashAndSaltPassword(ctx context.Context, p string) (string, error) {
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(p), bcrypt.DefaultCost)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return "", fmt.Errorf("failed to generate password hash")
+	}
+
+	return string(hash), nil
+
+}
+
+// checkPassword checks the password against the password policy, returning a validation
+// error that lists every rule of the policy that the password does not satisfy
+func (s *service) checkPassword(ctx context.Context, password string, user *support.User) error {
+
+	unmet, err := s.policy.Check(ctx, password, user.Username, user.Email, user.FirstName, user.LastName)
+	if err != nil {
+		middleware.LogEntrySetError(ctx, err)
+		return internal.NewInternalError(internal.LevelInternal, "failed to validate password")
+	}
+
+	if len(unmet) == 0 {
+		return nil
+	}
+
+	errs := make([]internal.FieldError, len(unmet))
+	for i, rule := range unmet {
+		errs[i] = internal.FieldError{Field: "password", Message: rule}
+	}
+
+	return internal.NewValidationError("password does not satisfy the password policy", errs)
 }
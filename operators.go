@@ -19,6 +19,12 @@ const (
 	LessThanEqualToOp    Operation = "<="
 	InOp                 Operation = "in"
 	NotInOp              Operation = "not in"
+	RegexOp              Operation = "regex"
+	InsensitiveRegexOp   Operation = "iregex"
+	PrefixOp             Operation = "prefix"
+	EqualFoldOp          Operation = "equal fold"
+	SizeOp               Operation = "size"
+	ElemMatchOp          Operation = "elem match"
 
 	LimitOp  Operation = "limit"
 	OrderOp  Operation = "order"
@@ -37,6 +43,12 @@ var AllOperations = []Operation{
 	LessThanEqualToOp,
 	InOp,
 	NotInOp,
+	RegexOp,
+	InsensitiveRegexOp,
+	PrefixOp,
+	EqualFoldOp,
+	SizeOp,
+	ElemMatchOp,
 	LimitOp,
 	OrderOp,
 	SkipOp,
@@ -50,6 +62,8 @@ func (o Operation) IsValid() bool {
 	case EqualOp, NotEqualOp,
 		GreaterThanOp, LessThanOp, GreaterThanEqualToOp, LessThanEqualToOp,
 		InOp, NotInOp,
+		RegexOp, InsensitiveRegexOp, PrefixOp, EqualFoldOp,
+		SizeOp, ElemMatchOp,
 		LimitOp, OrderOp, SkipOp, OrOp, AndOp, ExistsOp:
 		return true
 	}
@@ -205,3 +219,59 @@ func NewExistsOperator(column string, value bool) *Operator {
 		Value:     value,
 	}
 }
+
+// NewRegexOperator matches values of the column against the provided regular expression
+func NewRegexOperator(column string, pattern string) *Operator {
+	return &Operator{
+		Column:    column,
+		Operation: RegexOp,
+		Value:     pattern,
+	}
+}
+
+// NewInsensitiveRegexOperator matches values of the column against the provided regular expression, ignoring case
+func NewInsensitiveRegexOperator(column string, pattern string) *Operator {
+	return &Operator{
+		Column:    column,
+		Operation: InsensitiveRegexOp,
+		Value:     pattern,
+	}
+}
+
+// NewPrefixOperator matches values of the column that begin with the provided value.
+// The value is matched literally, it is not interpreted as a regular expression
+func NewPrefixOperator(column string, value string) *Operator {
+	return &Operator{
+		Column:    column,
+		Operation: PrefixOp,
+		Value:     value,
+	}
+}
+
+// NewEqualFoldOperator matches values of the column that are equal to the provided value, ignoring case
+func NewEqualFoldOperator(column string, value string) *Operator {
+	return &Operator{
+		Column:    column,
+		Operation: EqualFoldOp,
+		Value:     value,
+	}
+}
+
+// NewSizeOperator matches array columns that contain exactly the provided number of elements
+func NewSizeOperator(column string, value int64) *Operator {
+	return &Operator{
+		Column:    column,
+		Operation: SizeOp,
+		Value:     value,
+	}
+}
+
+// NewElemMatchOperator matches array columns that contain at least one element that matches all of the provided operators.
+// The columns of the provided operators are relative to the array element
+func NewElemMatchOperator(column string, value ...*Operator) *Operator {
+	return &Operator{
+		Column:    column,
+		Operation: ElemMatchOp,
+		Value:     value,
+	}
+}
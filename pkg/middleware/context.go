@@ -18,6 +18,8 @@ const (
 	contextKeyRequestID contextKey = iota
 	contextKeyUserID
 	contextKeyToken
+	contextKeyRole
+	contextKeyPermissions
 )
 
 func RequestID(next http.Handler) http.Handler {
@@ -88,3 +90,43 @@ func GetUserObjectIDFromContext(ctx context.Context) (primitive.ObjectID, error)
 
 	return primitive.NilObjectID, fmt.Errorf("invalid id returns from context")
 }
+
+func SetRoleOnContext(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, contextKeyRole, role)
+}
+
+func GetRoleFromContext(ctx context.Context) string {
+
+	req := ctx.Value(contextKeyRole)
+
+	if role, ok := req.(string); ok {
+		return role
+	}
+
+	return ""
+
+}
+
+func SetPermissionsOnContext(ctx context.Context, permissions []string) context.Context {
+	return context.WithValue(ctx, contextKeyPermissions, permissions)
+}
+
+// HasPermissionFromContext reports whether the user making the request has been granted the provided permission
+func HasPermissionFromContext(ctx context.Context, permission string) bool {
+
+	req := ctx.Value(contextKeyPermissions)
+
+	permissions, ok := req.([]string)
+	if !ok {
+		return false
+	}
+
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+
+}
@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const rateLimitKeyFmt = "support::ratelimit::%s::%s"
+
+// slidingWindow records the request in a sorted set scored by the time of each request and
+// counts the requests that fall within the window, all in a single round trip so that concurrent
+// requests cannot exceed the budget. It returns whether the request is allowed, the requests that
+// remain in the window and the milliseconds until the oldest request leaves the window
+var slidingWindow = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+
+local count = redis.call("ZCARD", KEYS[1])
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	redis.call("PEXPIRE", KEYS[1], window)
+	return {1, limit - count - 1, window}
+end
+
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+return {0, 0, tonumber(oldest[2]) + window - now}
+`)
+
+// Limit is a budget of Requests that may be made within any Window
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// RateLimitResult describes the outcome of counting a request against a Limit
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until a request leaves the window and frees up budget
+	Reset time.Duration
+}
+
+// RateLimiter counts requests against sliding windows that are stored in redis
+type RateLimiter struct {
+	redis *redis.Client
+}
+
+func NewRateLimiter(redis *redis.Client) *RateLimiter {
+	return &RateLimiter{
+		redis: redis,
+	}
+}
+
+// Allow counts a request by the client identified by key against the named limit
+func (l *RateLimiter) Allow(ctx context.Context, name, key string, limit Limit) (*RateLimitResult, error) {
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	result, err := slidingWindow.Run(
+		ctx,
+		l.redis,
+		[]string{fmt.Sprintf(rateLimitKeyFmt, name, key)},
+		now, limit.Window.Milliseconds(), limit.Requests, uuid.New().String(),
+	).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count request against %s limit: %w", name, err)
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 3 {
+		return nil, fmt.Errorf("unexpected response counting request against %s limit", name)
+	}
+
+	var counts [3]int64
+	for i, v := range values {
+		counts[i], ok = v.(int64)
+		if !ok {
+			return nil, fmt.Errorf("unexpected response counting request against %s limit", name)
+		}
+	}
+
+	return &RateLimitResult{
+		Allowed:   counts[0] == 1,
+		Limit:     limit.Requests,
+		Remaining: int(counts[1]),
+		Reset:     time.Duration(counts[2]) * time.Millisecond,
+	}, nil
+
+}
+
+// KeyFunc identifies the client that a request is counted against
+type KeyFunc func(r *http.Request) string
+
+// ClientIP identifies clients by the address of the connection. Deployments behind a proxy should
+// install a middleware such as chi's RealIP ahead of the rate limit so that RemoteAddr is the client
+func ClientIP(r *http.Request) string {
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+
+}
+
+// ClientUser identifies clients by the authenticated user, falling back to their address for anonymous requests
+func ClientUser(r *http.Request) string {
+
+	if id, ok := GetUserIDFromContext(r.Context()); ok {
+		return id
+	}
+
+	return ClientIP(r)
+
+}
+
+// RateLimit returns a middleware that refuses requests with a 429 once the client identified by key has
+// exhausted the named limit. Every response carries the X-RateLimit-* headers, refusals carry Retry-After.
+// Requests are allowed when redis is unavailable so that an outage of the limiter does not take down the routes
+func RateLimit(limiter *RateLimiter, name string, limit Limit, key KeyFunc) func(http.Handler) http.Handler {
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			var ctx = r.Context()
+
+			result, err := limiter.Allow(ctx, name, key(r), limit)
+			if err != nil {
+				LogEntrySetError(ctx, err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			SetRateLimitHeaders(w, result)
+
+			if !result.Allowed {
+				w.WriteHeader(http.StatusTooManyRequests)
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"message": fmt.Sprintf("rate limit exceeded, retry in %s", result.Reset.Round(time.Second)),
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+
+		})
+	}
+
+}
+
+// SetRateLimitHeaders describes the result to the client. Retry-After is only set when the request was refused
+func SetRateLimitHeaders(w http.ResponseWriter, result *RateLimitResult) {
+
+	reset := strconv.Itoa(int(math.Ceil(result.Reset.Seconds())))
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("X-RateLimit-Reset", reset)
+
+	if !result.Allowed {
+		w.Header().Set("Retry-After", reset)
+	}
+
+}
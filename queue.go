@@ -0,0 +1,124 @@
+package support
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type QueueRepository interface {
+	Queue(ctx context.Context, id string) (*Queue, error)
+	Queues(ctx context.Context, operators ...*Operator) ([]*Queue, error)
+	CreateQueue(ctx context.Context, queue *Queue) (*Queue, error)
+	UpdateQueue(ctx context.Context, id string, queue *Queue) (*Queue, error)
+	DeleteQueue(ctx context.Context, id string) error
+	// AdvanceQueue increments the round robin cursor of the queue and returns its new value.
+	// The increment is atomic, so concurrent callers never receive the same value
+	AdvanceQueue(ctx context.Context, id primitive.ObjectID) (int64, error)
+}
+
+// Assignment is the strategy that a queue uses to assign newly created tickets to its agents
+type Assignment string
+
+const (
+	// AssignmentManual leaves new tickets unassigned until an agent claims them or they are assigned
+	AssignmentManual Assignment = "manual"
+	// AssignmentRoundRobin assigns new tickets to each agent of the queue in turn
+	AssignmentRoundRobin Assignment = "roundRobin"
+	// AssignmentLeastLoaded assigns new tickets to the agent of the queue with the fewest open tickets
+	AssignmentLeastLoaded Assignment = "leastLoaded"
+)
+
+type Assignments []Assignment
+
+var AllAssignments = Assignments{
+	AssignmentManual,
+	AssignmentRoundRobin,
+	AssignmentLeastLoaded,
+}
+
+func (a Assignments) Slice() []string {
+	out := make([]string, len(a))
+	for i, v := range a {
+		out[i] = v.String()
+	}
+	return out
+}
+
+func (a Assignment) Valid() bool {
+	for _, v := range AllAssignments {
+		if v == a {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a Assignment) String() string {
+	return string(a)
+}
+
+// Queue is a pool of tickets that is handled by a group of agents. A queue holds the tickets
+// of its categories and of every category nested beneath them
+type Queue struct {
+	ID         primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	Name       string               `json:"name" bson:"name"`
+	Categories []primitive.ObjectID `json:"categories" bson:"categories"`
+	Agents     []primitive.ObjectID `json:"agents" bson:"agents"`
+	Assignment Assignment           `json:"assignment" bson:"assignment"`
+	// Cursor counts the tickets that have been assigned round robin and is only written by AdvanceQueue
+	Cursor    int64              `json:"-" bson:"cursor,omitempty"`
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedBy primitive.ObjectID `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
+	UpdatedAt time.Time          `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// QueueListing is a queue along with the unassigned tickets that are waiting in it, oldest first
+type QueueListing struct {
+	*Queue
+	Tickets []*Ticket `json:"tickets"`
+}
+
+func (o *Queue) ValidateAttributes() error {
+
+	if o.Name == "" {
+		return fmt.Errorf("name is required, received empty value")
+	}
+
+	if len(o.Categories) == 0 {
+		return fmt.Errorf("categories is required, received empty array")
+	}
+
+	if o.Assignment == "" {
+		o.Assignment = AssignmentManual
+	}
+
+	if !o.Assignment.Valid() {
+		return fmt.Errorf("invalid value for assignment provided, got %s, expected one of %s", o.Assignment, strings.Join(AllAssignments.Slice(), ", "))
+	}
+
+	if o.Assignment != AssignmentManual && len(o.Agents) == 0 {
+		return fmt.Errorf("agents cannot be empty when assignment is %s", o.Assignment)
+	}
+
+	return nil
+
+}
+
+// HasAgent reports whether the user is one of the agents of the queue
+func (o *Queue) HasAgent(id primitive.ObjectID) bool {
+
+	for _, agent := range o.Agents {
+		if agent == id {
+			return true
+		}
+	}
+
+	return false
+
+}
@@ -0,0 +1,146 @@
+package support
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JSONSchemaDraft is the JSON Schema dialect that generated schemas declare
+const JSONSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// objectIDPattern matches the hex encoding of an ObjectID
+const objectIDPattern = "^[0-9a-fA-F]{24}$"
+
+// JSONSchema is the subset of JSON Schema needed to describe the submission of a ticket
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Const                interface{}            `json:"const,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	Contains             *JSONSchema            `json:"contains,omitempty"`
+	AllOf                []*JSONSchema          `json:"allOf,omitempty"`
+	AnyOf                []*JSONSchema          `json:"anyOf,omitempty"`
+	OneOf                []*JSONSchema          `json:"oneOf,omitempty"`
+	Not                  *JSONSchema            `json:"not,omitempty"`
+}
+
+// ExpandTicketDefinition pairs the definition with the field definitions that it references, in the order of
+// definition.Fields. Field definitions that are not referenced by the definition are ignored
+func ExpandTicketDefinition(definition *TicketDefinition, fields []*FieldDefinition) *ExpandedTicketDefinition {
+
+	byID := make(map[primitive.ObjectID]*FieldDefinition, len(fields))
+	for _, field := range fields {
+		byID[field.ID] = field
+	}
+
+	expanded := &ExpandedTicketDefinition{
+		TicketDefinition: definition,
+		FieldDefinitions: make([]*FieldDefinition, 0, len(definition.Fields)),
+	}
+	for _, fieldID := range definition.Fields {
+		if field, ok := byID[fieldID]; ok {
+			expanded.FieldDefinitions = append(expanded.FieldDefinitions, field)
+		}
+	}
+
+	return expanded
+
+}
+
+// Schema describes the body of a request that submits a ticket using this definition. Every entry of
+// fields must reference one of the fields of the definition and hold a value of the kind of that field,
+// while the fields that are required must be present with a non null value
+func (o *ExpandedTicketDefinition) Schema() *JSONSchema {
+
+	closed := false
+	entries := make([]*JSONSchema, 0, len(o.FieldDefinitions))
+	required := make([]*JSONSchema, 0)
+	for _, field := range o.FieldDefinitions {
+		entries = append(entries, &JSONSchema{
+			Title:       field.Name,
+			Description: field.Description,
+			Type:        "object",
+			Properties: map[string]*JSONSchema{
+				"id": {Const: field.ID.Hex()},
+				"value": {
+					AnyOf: []*JSONSchema{{Type: "null"}, field.ValueSchema()},
+				},
+			},
+			Required:             []string{"id"},
+			AdditionalProperties: &closed,
+		})
+
+		if field.Required {
+			required = append(required, &JSONSchema{
+				Contains: &JSONSchema{
+					Properties: map[string]*JSONSchema{
+						"id":    {Const: field.ID.Hex()},
+						"value": {Not: &JSONSchema{Type: "null"}},
+					},
+					Required: []string{"id", "value"},
+				},
+			})
+		}
+	}
+
+	// oneOf may not be empty, so a definition without fields accepts no entries at all
+	items := &JSONSchema{Not: &JSONSchema{}}
+	if len(entries) > 0 {
+		items = &JSONSchema{OneOf: entries}
+	}
+
+	fields := &JSONSchema{
+		Type:  "array",
+		Items: items,
+	}
+	if len(required) > 0 {
+		fields.AllOf = required
+	}
+
+	return &JSONSchema{
+		Schema: JSONSchemaDraft,
+		Title:  o.Name,
+		Type:   "object",
+		Properties: map[string]*JSONSchema{
+			"definitionID": {Const: o.ID.Hex()},
+			"categoryID":   {Type: "string", Pattern: objectIDPattern},
+			"fields":       fields,
+		},
+		Required: []string{"definitionID", "categoryID", "fields"},
+	}
+
+}
+
+// ValueSchema describes the values that are accepted by ValidateValue
+func (o *FieldDefinition) ValueSchema() *JSONSchema {
+
+	switch o.Kind {
+	case FieldString:
+		return &JSONSchema{Type: "string"}
+	case FieldNumber:
+		return &JSONSchema{Type: "number"}
+	case FieldBoolean:
+		return &JSONSchema{Type: "boolean"}
+	case FieldList:
+		one := 1
+		return &JSONSchema{
+			AnyOf: []*JSONSchema{
+				{Enum: o.Options},
+				{Type: "array", MinItems: &one, Items: &JSONSchema{Enum: o.Options}},
+			},
+		}
+	case FieldFile:
+		return &JSONSchema{Type: "string", Pattern: objectIDPattern}
+	}
+
+	// Values of an unsupported kind are rejected by ValidateValue, so nothing matches
+	return &JSONSchema{Not: &JSONSchema{}}
+
+}
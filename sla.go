@@ -0,0 +1,464 @@
+package support
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SLARepository interface {
+	SLAPolicy(ctx context.Context, id string) (*SLAPolicy, error)
+	SLAPolicies(ctx context.Context, operators ...*Operator) ([]*SLAPolicy, error)
+	CreateSLAPolicy(ctx context.Context, policy *SLAPolicy) (*SLAPolicy, error)
+	UpdateSLAPolicy(ctx context.Context, id string, policy *SLAPolicy) (*SLAPolicy, error)
+	DeleteSLAPolicy(ctx context.Context, id string) error
+}
+
+// SLABreachChannel is the redis channel that an SLABreach is published to every time a ticket misses one of its targets
+const SLABreachChannel = "sla:breach"
+
+// businessHoursHorizon is the number of days that business hours are searched for open time before giving up
+const businessHoursHorizon = 3660
+
+// SLATarget is one of the time targets that an SLA policy promises to meet
+type SLATarget string
+
+const (
+	// SLATargetFirstResponse is met once an agent first replies to the submitter of a ticket
+	SLATargetFirstResponse SLATarget = "firstResponse"
+	// SLATargetResolution is met once a ticket is placed into a locked status
+	SLATargetResolution SLATarget = "resolution"
+)
+
+var AllSLATargets = []SLATarget{
+	SLATargetFirstResponse,
+	SLATargetResolution,
+}
+
+func (t SLATarget) String() string {
+	return string(t)
+}
+
+// SLAPolicy describes the time targets that we promise to meet for the tickets of its categories and definitions.
+// Targets elapse during business hours only, or around the clock when the policy has no business hours,
+// and they stop elapsing while a ticket is in one of the pause statuses of the policy
+type SLAPolicy struct {
+	ID   primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name string             `json:"name" bson:"name"`
+
+	// Categories and Definitions are the tickets that the policy applies to. Policies that name the definition
+	// of a ticket take precedence over those that name its category, and categories are inherited, so the
+	// policy of a category applies to every category nested beneath it that does not have a policy of its own
+	Categories  []primitive.ObjectID `json:"categories" bson:"categories"`
+	Definitions []primitive.ObjectID `json:"definitions" bson:"definitions"`
+
+	// FirstResponseMinutes and ResolutionMinutes are the targets of the policy. A target of 0 is not tracked
+	FirstResponseMinutes int `json:"firstResponseMinutes" bson:"firstResponseMinutes"`
+	ResolutionMinutes    int `json:"resolutionMinutes" bson:"resolutionMinutes"`
+
+	BusinessHours *BusinessHours       `json:"businessHours,omitempty" bson:"businessHours,omitempty"`
+	PauseStatuses []primitive.ObjectID `json:"pauseStatuses" bson:"pauseStatuses"`
+
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedBy primitive.ObjectID `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
+	UpdatedAt time.Time          `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// BusinessHours is the calendar that SLA targets elapse on. Days and holidays are interpreted in Timezone
+type BusinessHours struct {
+	Timezone string         `json:"timezone" bson:"timezone"`
+	Days     []*BusinessDay `json:"days" bson:"days"`
+	// Holidays are dates formatted as 2006-01-02 on which the business is closed
+	Holidays []string `json:"holidays" bson:"holidays"`
+}
+
+// BusinessDay is the opening hours of a day of the week, formatted as 15:04. A close of 24:00 closes at midnight
+type BusinessDay struct {
+	Weekday time.Weekday `json:"weekday" bson:"weekday"`
+	Open    string       `json:"open" bson:"open"`
+	Close   string       `json:"close" bson:"close"`
+}
+
+// TicketSLA tracks the targets of the SLA policy that applies to a ticket. A due date is only set for
+// the targets of the policy, and a target is met once its matching timestamp is set
+type TicketSLA struct {
+	PolicyID         primitive.ObjectID `json:"policyID" bson:"policyID"`
+	FirstResponseDue *time.Time         `json:"firstResponseDue,omitempty" bson:"firstResponseDue,omitempty"`
+	ResolutionDue    *time.Time         `json:"resolutionDue,omitempty" bson:"resolutionDue,omitempty"`
+	FirstRespondedAt *time.Time         `json:"firstRespondedAt,omitempty" bson:"firstRespondedAt,omitempty"`
+	ResolvedAt       *time.Time         `json:"resolvedAt,omitempty" bson:"resolvedAt,omitempty"`
+
+	// FirstResponseBreachedAt and ResolutionBreachedAt record when a target was found to have been missed
+	FirstResponseBreachedAt *time.Time `json:"firstResponseBreachedAt,omitempty" bson:"firstResponseBreachedAt,omitempty"`
+	ResolutionBreachedAt    *time.Time `json:"resolutionBreachedAt,omitempty" bson:"resolutionBreachedAt,omitempty"`
+
+	// PausedAt is set while the ticket is in one of the pause statuses of the policy.
+	// The due dates of the ticket are pushed back by the time it spent paused once it is resumed
+	PausedAt *time.Time `json:"pausedAt,omitempty" bson:"pausedAt,omitempty"`
+}
+
+// SLABreach is the event that is emitted when a ticket misses one of its targets
+type SLABreach struct {
+	TicketID   primitive.ObjectID `json:"ticketID"`
+	PolicyID   primitive.ObjectID `json:"policyID"`
+	Target     SLATarget          `json:"target"`
+	DueAt      time.Time          `json:"dueAt"`
+	BreachedAt time.Time          `json:"breachedAt"`
+}
+
+// SLA columns are the attributes of the SLA of a ticket, named as they are stored on the ticket
+const (
+	SLAColumnPolicyID                = "sla.policyID"
+	SLAColumnFirstResponseDue        = "sla.firstResponseDue"
+	SLAColumnResolutionDue           = "sla.resolutionDue"
+	SLAColumnFirstRespondedAt        = "sla.firstRespondedAt"
+	SLAColumnResolvedAt              = "sla.resolvedAt"
+	SLAColumnFirstResponseBreachedAt = "sla.firstResponseBreachedAt"
+	SLAColumnResolutionBreachedAt    = "sla.resolutionBreachedAt"
+	SLAColumnPausedAt                = "sla.pausedAt"
+)
+
+// DueColumn is the attribute of the SLA of a ticket that records when the target is due
+func (t SLATarget) DueColumn() string {
+	if t == SLATargetFirstResponse {
+		return SLAColumnFirstResponseDue
+	}
+	return SLAColumnResolutionDue
+}
+
+// MetColumn is the attribute of the SLA of a ticket that records when the target was met
+func (t SLATarget) MetColumn() string {
+	if t == SLATargetFirstResponse {
+		return SLAColumnFirstRespondedAt
+	}
+	return SLAColumnResolvedAt
+}
+
+// BreachedColumn is the attribute of the SLA of a ticket that records when the target was missed
+func (t SLATarget) BreachedColumn() string {
+	if t == SLATargetFirstResponse {
+		return SLAColumnFirstResponseBreachedAt
+	}
+	return SLAColumnResolutionBreachedAt
+}
+
+// NewBreachedOperator matches the tickets that are running and missed the target at or before now
+// without the breach having been recorded yet
+func NewBreachedOperator(target SLATarget, now time.Time) *Operator {
+
+	return NewAndOperator(
+		NewLessThanEqualToOperator(target.DueColumn(), now),
+		NewExistsOperator(target.MetColumn(), false),
+		NewExistsOperator(target.BreachedColumn(), false),
+		NewExistsOperator(SLAColumnResolvedAt, false),
+		NewExistsOperator(SLAColumnPausedAt, false),
+	)
+
+}
+
+// NewBreachingSoonOperator matches the tickets that are running and will miss one of their targets
+// after now but no later than within from now. Tickets that have already missed a target are not matched
+func NewBreachingSoonOperator(now time.Time, within time.Duration) *Operator {
+
+	targets := make([]*Operator, 0, len(AllSLATargets))
+	for _, target := range AllSLATargets {
+		targets = append(targets, NewAndOperator(
+			NewGreaterThanOperator(target.DueColumn(), now),
+			NewLessThanEqualToOperator(target.DueColumn(), now.Add(within)),
+			NewExistsOperator(target.MetColumn(), false),
+		))
+	}
+
+	return NewAndOperator(
+		NewOrOperator(targets...),
+		NewExistsOperator(SLAColumnResolvedAt, false),
+		NewExistsOperator(SLAColumnPausedAt, false),
+	)
+
+}
+
+func (o *SLAPolicy) ValidateAttributes() error {
+
+	if o.Name == "" {
+		return fmt.Errorf("name is required, received empty value")
+	}
+
+	if len(o.Categories) == 0 && len(o.Definitions) == 0 {
+		return fmt.Errorf("categories or definitions is required, received empty arrays")
+	}
+
+	if o.FirstResponseMinutes < 0 || o.ResolutionMinutes < 0 {
+		return fmt.Errorf("firstResponseMinutes and resolutionMinutes cannot be negative")
+	}
+
+	if o.FirstResponseMinutes == 0 && o.ResolutionMinutes == 0 {
+		return fmt.Errorf("firstResponseMinutes or resolutionMinutes is required, received empty values")
+	}
+
+	if o.BusinessHours != nil {
+		err := o.BusinessHours.ValidateAttributes()
+		if err != nil {
+			return fmt.Errorf("invalid businessHours: %w", err)
+		}
+	}
+
+	return nil
+
+}
+
+// Pauses reports whether the targets of the policy stop elapsing while a ticket is in the status
+func (o *SLAPolicy) Pauses(statusID primitive.ObjectID) bool {
+
+	for _, id := range o.PauseStatuses {
+		if id == statusID {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+// Start computes the due dates of the targets of the policy for a ticket that was created at the provided time
+// and placed into the provided status
+func (o *SLAPolicy) Start(at time.Time, statusID primitive.ObjectID) (*TicketSLA, error) {
+
+	sla := &TicketSLA{PolicyID: o.ID}
+
+	if o.FirstResponseMinutes > 0 {
+		due, err := o.BusinessHours.Add(at, time.Duration(o.FirstResponseMinutes)*time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		sla.FirstResponseDue = &due
+	}
+
+	if o.ResolutionMinutes > 0 {
+		due, err := o.BusinessHours.Add(at, time.Duration(o.ResolutionMinutes)*time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		sla.ResolutionDue = &due
+	}
+
+	if o.Pauses(statusID) {
+		sla.PausedAt = &at
+	}
+
+	return sla, nil
+
+}
+
+// Resume restarts the targets of a paused SLA at the provided time. Every target that had not been met
+// keeps the business time that it had left when it was paused, so its due date is pushed back
+func (o *TicketSLA) Resume(at time.Time, hours *BusinessHours) error {
+
+	if o.PausedAt == nil {
+		return nil
+	}
+
+	for _, target := range []struct {
+		due *time.Time
+		met *time.Time
+	}{
+		{o.FirstResponseDue, o.FirstRespondedAt},
+		{o.ResolutionDue, o.ResolvedAt},
+	} {
+		if target.due == nil || target.met != nil || !target.due.After(*o.PausedAt) {
+			continue
+		}
+
+		remaining, err := hours.Between(*o.PausedAt, *target.due)
+		if err != nil {
+			return err
+		}
+
+		due, err := hours.Add(at, remaining)
+		if err != nil {
+			return err
+		}
+
+		*target.due = due
+	}
+
+	o.PausedAt = nil
+
+	return nil
+
+}
+
+func (o *BusinessHours) ValidateAttributes() error {
+
+	_, err := time.LoadLocation(o.Timezone)
+	if err != nil {
+		return fmt.Errorf("unknown timezone %s", o.Timezone)
+	}
+
+	if len(o.Days) == 0 {
+		return fmt.Errorf("days is required, received empty array")
+	}
+
+	seen := make(map[time.Weekday]bool, len(o.Days))
+	for _, day := range o.Days {
+		if day == nil {
+			return fmt.Errorf("days cannot contain empty values")
+		}
+
+		if day.Weekday < time.Sunday || day.Weekday > time.Saturday {
+			return fmt.Errorf("invalid weekday %d, expected a value from 0 (Sunday) to 6 (Saturday)", day.Weekday)
+		}
+
+		if seen[day.Weekday] {
+			return fmt.Errorf("%s is listed more than once", day.Weekday)
+		}
+		seen[day.Weekday] = true
+
+		open, err := parseClock(day.Open)
+		if err != nil {
+			return fmt.Errorf("invalid open time for %s: %w", day.Weekday, err)
+		}
+
+		close, err := parseClock(day.Close)
+		if err != nil {
+			return fmt.Errorf("invalid close time for %s: %w", day.Weekday, err)
+		}
+
+		if close <= open {
+			return fmt.Errorf("close time for %s must be later than its open time", day.Weekday)
+		}
+	}
+
+	for _, holiday := range o.Holidays {
+		_, err := time.Parse("2006-01-02", holiday)
+		if err != nil {
+			return fmt.Errorf("invalid holiday %s, expected a date formatted as 2006-01-02", holiday)
+		}
+	}
+
+	return nil
+
+}
+
+// Add returns the time at which d of business time has elapsed after start.
+// A nil calendar is open around the clock
+func (o *BusinessHours) Add(start time.Time, d time.Duration) (time.Time, error) {
+
+	if o == nil || d <= 0 {
+		return start.Add(d), nil
+	}
+
+	loc, err := time.LoadLocation(o.Timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown timezone %s", o.Timezone)
+	}
+
+	t := start.In(loc)
+	for i := 0; i < businessHoursHorizon; i++ {
+		open, close, ok := o.hours(t, loc)
+		if ok && t.Before(close) {
+			if t.Before(open) {
+				t = open
+			}
+
+			if available := close.Sub(t); d <= available {
+				return t.Add(d), nil
+			}
+
+			d -= close.Sub(t)
+		}
+
+		y, m, day := t.Date()
+		t = time.Date(y, m, day+1, 0, 0, 0, 0, loc)
+	}
+
+	return time.Time{}, fmt.Errorf("business hours are not open for long enough to fit the target")
+
+}
+
+// Between returns the business time that elapses from from to to.
+// A nil calendar is open around the clock
+func (o *BusinessHours) Between(from, to time.Time) (time.Duration, error) {
+
+	if !to.After(from) {
+		return 0, nil
+	}
+
+	if o == nil {
+		return to.Sub(from), nil
+	}
+
+	loc, err := time.LoadLocation(o.Timezone)
+	if err != nil {
+		return 0, fmt.Errorf("unknown timezone %s", o.Timezone)
+	}
+
+	var total time.Duration
+	for t := from.In(loc); t.Before(to); {
+		open, close, ok := o.hours(t, loc)
+		if ok {
+			if open.Before(t) {
+				open = t
+			}
+			if close.After(to) {
+				close = to
+			}
+			if close.After(open) {
+				total += close.Sub(open)
+			}
+		}
+
+		y, m, day := t.Date()
+		t = time.Date(y, m, day+1, 0, 0, 0, 0, loc)
+	}
+
+	return total, nil
+
+}
+
+// hours returns the opening hours of the day that t falls on. ok is false when the business is closed all day
+func (o *BusinessHours) hours(t time.Time, loc *time.Location) (open, close time.Time, ok bool) {
+
+	date := t.Format("2006-01-02")
+	for _, holiday := range o.Holidays {
+		if holiday == date {
+			return time.Time{}, time.Time{}, false
+		}
+	}
+
+	for _, day := range o.Days {
+		if day == nil || day.Weekday != t.Weekday() {
+			continue
+		}
+
+		// Business hours are validated when the policy is saved
+		openAt, _ := parseClock(day.Open)
+		closeAt, _ := parseClock(day.Close)
+
+		// Minutes past midnight are normalised by time.Date, so opening hours follow the wall clock across DST changes
+		y, m, d := t.Date()
+
+		return time.Date(y, m, d, 0, int(openAt/time.Minute), 0, 0, loc), time.Date(y, m, d, 0, int(closeAt/time.Minute), 0, 0, loc), true
+	}
+
+	return time.Time{}, time.Time{}, false
+
+}
+
+// parseClock converts a time of day formatted as 15:04 into the time since midnight. 24:00 is accepted as midnight
+func parseClock(value string) (time.Duration, error) {
+
+	if value == "24:00" {
+		return 24 * time.Hour, nil
+	}
+
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a time formatted as 15:04", value)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+
+}
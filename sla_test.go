@@ -0,0 +1,302 @@
+package support
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// weekdays is open from 09:00 to 17:00 on weekdays and closed on Christmas Day, which falls on a Friday in 2020.
+// The clocks in London went forward an hour on Sunday 29 March 2020
+var weekdays = &BusinessHours{
+	Timezone: "Europe/London",
+	Days: []*BusinessDay{
+		{Weekday: time.Monday, Open: "09:00", Close: "17:00"},
+		{Weekday: time.Tuesday, Open: "09:00", Close: "17:00"},
+		{Weekday: time.Wednesday, Open: "09:00", Close: "17:00"},
+		{Weekday: time.Thursday, Open: "09:00", Close: "17:00"},
+		{Weekday: time.Friday, Open: "09:00", Close: "17:00"},
+	},
+	Holidays: []string{"2020-12-25"},
+}
+
+// lateSaturdays is only open on Saturday evenings, until midnight
+var lateSaturdays = &BusinessHours{
+	Timezone: "Europe/London",
+	Days: []*BusinessDay{
+		{Weekday: time.Saturday, Open: "18:00", Close: "24:00"},
+	},
+}
+
+// sundays is open all day on Sundays, so the Sunday that the clocks go forward is open for 23 hours
+var sundays = &BusinessHours{
+	Timezone: "Europe/London",
+	Days: []*BusinessDay{
+		{Weekday: time.Sunday, Open: "00:00", Close: "24:00"},
+	},
+}
+
+func TestBusinessHoursAdd(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		hours    *BusinessHours
+		start    time.Time
+		d        time.Duration
+		expected time.Time
+		err      string
+	}{
+		{name: "within the day", hours: weekdays, start: london(2020, 12, 1, 10, 0), d: 2 * time.Hour, expected: london(2020, 12, 1, 12, 0)},
+		{name: "before opening", hours: weekdays, start: london(2020, 12, 1, 7, 0), d: time.Hour, expected: london(2020, 12, 1, 10, 0)},
+		{name: "ends at closing", hours: weekdays, start: london(2020, 12, 1, 16, 0), d: time.Hour, expected: london(2020, 12, 1, 17, 0)},
+		{name: "overnight", hours: weekdays, start: london(2020, 12, 1, 16, 0), d: 2 * time.Hour, expected: london(2020, 12, 2, 10, 0)},
+		{name: "after closing", hours: weekdays, start: london(2020, 12, 1, 18, 0), d: time.Hour, expected: london(2020, 12, 2, 10, 0)},
+		{name: "over a weekend", hours: weekdays, start: london(2020, 12, 4, 16, 0), d: 2 * time.Hour, expected: london(2020, 12, 7, 10, 0)},
+		{name: "starting on a weekend", hours: weekdays, start: london(2020, 12, 5, 12, 0), d: time.Hour, expected: london(2020, 12, 7, 10, 0)},
+		{name: "over a holiday and a weekend", hours: weekdays, start: london(2020, 12, 24, 16, 0), d: 2 * time.Hour, expected: london(2020, 12, 28, 10, 0)},
+		{name: "over several days", hours: weekdays, start: london(2020, 12, 1, 9, 0), d: 20 * time.Hour, expected: london(2020, 12, 3, 13, 0)},
+		{name: "over the clocks going forward", hours: weekdays, start: london(2020, 3, 27, 16, 0), d: 2 * time.Hour, expected: london(2020, 3, 30, 10, 0)},
+		{name: "over the clocks going back", hours: weekdays, start: london(2020, 10, 23, 16, 0), d: 2 * time.Hour, expected: london(2020, 10, 26, 10, 0)},
+		{name: "day the clocks go forward is 23 hours long", hours: sundays, start: london(2020, 3, 29, 0, 0), d: 23 * time.Hour, expected: london(2020, 3, 30, 0, 0)},
+		{name: "past the end of the day the clocks go forward", hours: sundays, start: london(2020, 3, 29, 0, 0), d: 24 * time.Hour, expected: london(2020, 4, 5, 1, 0)},
+		{name: "ends at midnight", hours: lateSaturdays, start: london(2020, 12, 5, 23, 0), d: time.Hour, expected: london(2020, 12, 6, 0, 0)},
+		{name: "past midnight", hours: lateSaturdays, start: london(2020, 12, 5, 23, 0), d: 2 * time.Hour, expected: london(2020, 12, 12, 19, 0)},
+		{name: "zero duration", hours: weekdays, start: london(2020, 12, 5, 12, 0), d: 0, expected: london(2020, 12, 5, 12, 0)},
+		{name: "nil calendar", hours: nil, start: london(2020, 12, 5, 12, 0), d: 2 * time.Hour, expected: london(2020, 12, 5, 14, 0)},
+		{name: "longer than the horizon", hours: sundays, start: london(2020, 12, 1, 0, 0), d: businessHoursHorizon * 24 * time.Hour, err: "business hours are not open for long enough to fit the target"},
+		{name: "unknown timezone", hours: &BusinessHours{Timezone: "Europe/Atlantis"}, start: london(2020, 12, 1, 0, 0), d: time.Hour, err: "unknown timezone Europe/Atlantis"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			actual, err := test.hours.Add(test.start, test.d)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !actual.Equal(test.expected) {
+				t.Errorf("expected %s, got %s", test.expected, actual)
+			}
+
+		})
+	}
+
+}
+
+func TestBusinessHoursBetween(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		hours    *BusinessHours
+		from     time.Time
+		to       time.Time
+		expected time.Duration
+	}{
+		{name: "within the day", hours: weekdays, from: london(2020, 12, 1, 10, 0), to: london(2020, 12, 1, 12, 0), expected: 2 * time.Hour},
+		{name: "outside of opening hours", hours: weekdays, from: london(2020, 12, 1, 7, 0), to: london(2020, 12, 1, 19, 0), expected: 8 * time.Hour},
+		{name: "overnight", hours: weekdays, from: london(2020, 12, 1, 16, 0), to: london(2020, 12, 2, 10, 0), expected: 2 * time.Hour},
+		{name: "over a weekend", hours: weekdays, from: london(2020, 12, 4, 16, 0), to: london(2020, 12, 7, 10, 0), expected: 2 * time.Hour},
+		{name: "within a weekend", hours: weekdays, from: london(2020, 12, 5, 10, 0), to: london(2020, 12, 6, 18, 0), expected: 0},
+		{name: "over a holiday and a weekend", hours: weekdays, from: london(2020, 12, 24, 16, 0), to: london(2020, 12, 28, 10, 0), expected: 2 * time.Hour},
+		{name: "over the clocks going forward", hours: weekdays, from: london(2020, 3, 27, 16, 0), to: london(2020, 3, 30, 10, 0), expected: 2 * time.Hour},
+		{name: "day the clocks go forward is 23 hours long", hours: sundays, from: london(2020, 3, 29, 0, 0), to: london(2020, 3, 30, 0, 0), expected: 23 * time.Hour},
+		{name: "day the clocks go back is 25 hours long", hours: sundays, from: london(2020, 10, 25, 0, 0), to: london(2020, 10, 26, 0, 0), expected: 25 * time.Hour},
+		{name: "past midnight", hours: lateSaturdays, from: london(2020, 12, 5, 23, 0), to: london(2020, 12, 6, 1, 0), expected: time.Hour},
+		{name: "backwards", hours: weekdays, from: london(2020, 12, 1, 12, 0), to: london(2020, 12, 1, 10, 0), expected: 0},
+		{name: "nil calendar", hours: nil, from: london(2020, 12, 5, 10, 0), to: london(2020, 12, 6, 18, 0), expected: 32 * time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			actual, err := test.hours.Between(test.from, test.to)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if actual != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, actual)
+			}
+
+		})
+	}
+
+	// Add and Between are inverses of each other from any time that the business is open
+	for _, d := range []time.Duration{time.Minute, time.Hour, 8 * time.Hour, 30 * time.Hour, 200 * time.Hour} {
+		start := london(2020, 3, 26, 11, 30)
+
+		due, err := weekdays.Add(start, d)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		between, err := weekdays.Between(start, due)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if between != d {
+			t.Errorf("expected %s between %s and %s, got %s", d, start, due, between)
+		}
+	}
+
+}
+
+func TestTicketSLAResume(t *testing.T) {
+
+	tests := []struct {
+		name             string
+		hours            *BusinessHours
+		pausedAt         *time.Time
+		firstResponseDue *time.Time
+		resolutionDue    *time.Time
+		firstRespondedAt *time.Time
+		resumedAt        time.Time
+		expectedFirst    *time.Time
+		expectedResolve  *time.Time
+	}{
+		{
+			name:             "paused within the day",
+			hours:            weekdays,
+			pausedAt:         londonPtr(2020, 12, 1, 10, 0),
+			firstResponseDue: londonPtr(2020, 12, 1, 14, 0),
+			resolutionDue:    londonPtr(2020, 12, 2, 14, 0),
+			resumedAt:        london(2020, 12, 1, 12, 0),
+			expectedFirst:    londonPtr(2020, 12, 1, 16, 0),
+			expectedResolve:  londonPtr(2020, 12, 2, 16, 0),
+		},
+		{
+			name:             "paused across a weekend",
+			hours:            weekdays,
+			pausedAt:         londonPtr(2020, 12, 4, 16, 0),
+			firstResponseDue: londonPtr(2020, 12, 7, 10, 0),
+			resumedAt:        london(2020, 12, 7, 11, 0),
+			expectedFirst:    londonPtr(2020, 12, 7, 13, 0),
+		},
+		{
+			name:             "paused and resumed while closed",
+			hours:            weekdays,
+			pausedAt:         londonPtr(2020, 12, 5, 12, 0),
+			firstResponseDue: londonPtr(2020, 12, 7, 10, 0),
+			resumedAt:        london(2020, 12, 6, 12, 0),
+			expectedFirst:    londonPtr(2020, 12, 7, 10, 0),
+		},
+		{
+			name:             "paused across a holiday",
+			hours:            weekdays,
+			pausedAt:         londonPtr(2020, 12, 24, 16, 0),
+			firstResponseDue: londonPtr(2020, 12, 28, 10, 0),
+			resumedAt:        london(2020, 12, 29, 9, 0),
+			expectedFirst:    londonPtr(2020, 12, 29, 11, 0),
+		},
+		{
+			name:             "paused across the clocks going forward",
+			hours:            weekdays,
+			pausedAt:         londonPtr(2020, 3, 27, 16, 0),
+			firstResponseDue: londonPtr(2020, 3, 30, 10, 0),
+			resumedAt:        london(2020, 3, 30, 12, 0),
+			expectedFirst:    londonPtr(2020, 3, 30, 14, 0),
+		},
+		{
+			name:             "met target is left alone",
+			hours:            weekdays,
+			pausedAt:         londonPtr(2020, 12, 1, 10, 0),
+			firstResponseDue: londonPtr(2020, 12, 1, 14, 0),
+			firstRespondedAt: londonPtr(2020, 12, 1, 9, 30),
+			resolutionDue:    londonPtr(2020, 12, 1, 16, 0),
+			resumedAt:        london(2020, 12, 2, 9, 0),
+			expectedFirst:    londonPtr(2020, 12, 1, 14, 0),
+			expectedResolve:  londonPtr(2020, 12, 2, 15, 0),
+		},
+		{
+			name:             "missed target is left alone",
+			hours:            weekdays,
+			pausedAt:         londonPtr(2020, 12, 1, 15, 0),
+			firstResponseDue: londonPtr(2020, 12, 1, 14, 0),
+			resumedAt:        london(2020, 12, 2, 9, 0),
+			expectedFirst:    londonPtr(2020, 12, 1, 14, 0),
+		},
+		{
+			name:             "nil calendar",
+			hours:            nil,
+			pausedAt:         londonPtr(2020, 12, 5, 12, 0),
+			firstResponseDue: londonPtr(2020, 12, 5, 14, 0),
+			resumedAt:        london(2020, 12, 6, 12, 0),
+			expectedFirst:    londonPtr(2020, 12, 6, 14, 0),
+		},
+		{
+			name:             "not paused",
+			hours:            weekdays,
+			firstResponseDue: londonPtr(2020, 12, 1, 14, 0),
+			resumedAt:        london(2020, 12, 2, 9, 0),
+			expectedFirst:    londonPtr(2020, 12, 1, 14, 0),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			sla := &TicketSLA{
+				FirstResponseDue: test.firstResponseDue,
+				ResolutionDue:    test.resolutionDue,
+				FirstRespondedAt: test.firstRespondedAt,
+				PausedAt:         test.pausedAt,
+			}
+
+			err := sla.Resume(test.resumedAt, test.hours)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if sla.PausedAt != nil {
+				t.Errorf("expected the SLA to be resumed, still paused at %s", sla.PausedAt)
+			}
+
+			assertTime(t, "first response due", sla.FirstResponseDue, test.expectedFirst)
+			assertTime(t, "resolution due", sla.ResolutionDue, test.expectedResolve)
+
+		})
+	}
+
+}
+
+func assertTime(t *testing.T, name string, actual, expected *time.Time) {
+
+	t.Helper()
+
+	if actual == nil || expected == nil {
+		if actual != expected {
+			t.Errorf("expected %s to be %v, got %v", name, expected, actual)
+		}
+		return
+	}
+
+	if !actual.Equal(*expected) {
+		t.Errorf("expected %s to be %s, got %s", name, expected, actual)
+	}
+
+}
+
+func london(year int, month time.Month, day, hour, minute int) time.Time {
+
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		panic(err)
+	}
+
+	return time.Date(year, month, day, hour, minute, 0, 0, loc)
+
+}
+
+func londonPtr(year int, month time.Month, day, hour, minute int) *time.Time {
+	t := london(year, month, day, hour, minute)
+	return &t
+}
@@ -3,6 +3,7 @@ package support
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
@@ -20,14 +21,41 @@ type ticketRepository interface {
 	Ticket(ctx context.Context, id string) (*Ticket, error)
 	Tickets(ctx context.Context, operators ...*Operator) ([]*Ticket, error)
 	CreateTicket(ctx context.Context, ticket *Ticket) (*Ticket, error)
+	// UpdateTicket persists the changes that may be made to a submitted ticket, its field values, status
+	// and the due dates, pause and resolution of its SLA.
+	// The assignee of a ticket is only ever changed through AssignTicket, UnassignTicket and ClaimTicket
 	UpdateTicket(ctx context.Context, id string, ticket *Ticket) (*Ticket, error)
+	ReassignTicketCategory(ctx context.Context, from, to primitive.ObjectID) error
+	TouchTicket(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	// ClaimTicket assigns the oldest unassigned ticket that matches the operators to the assignee and returns it.
+	// The ticket is found and assigned in a single operation, so a ticket is never claimed twice.
+	// A nil ticket is returned when no ticket matches
+	ClaimTicket(ctx context.Context, assignee primitive.ObjectID, at time.Time, operators ...*Operator) (*Ticket, error)
+	// AssignTicket assigns the ticket to the assignee and returns the ticket as it was stored
+	AssignTicket(ctx context.Context, id primitive.ObjectID, assignee primitive.ObjectID, at time.Time) (*Ticket, error)
+	// UnassignTicket removes the assignee of the ticket and returns the ticket as it was stored
+	UnassignTicket(ctx context.Context, id primitive.ObjectID, at time.Time) (*Ticket, error)
+	// AssignedTicketCounts returns the number of tickets matching the operators that are assigned to each of the assignees
+	AssignedTicketCounts(ctx context.Context, assignees []primitive.ObjectID, operators ...*Operator) (map[primitive.ObjectID]int64, error)
+	// StampTicketSLA records the time on the attribute of the SLA of the ticket unless it has already been recorded
+	// or the ticket no longer matches the operators, reporting whether this call recorded it.
+	// Concurrent callers never both record the same attribute
+	StampTicketSLA(ctx context.Context, id primitive.ObjectID, column string, at time.Time, operators ...*Operator) (bool, error)
+	// CategoryTicketDefinitions returns the distinct ticket definitions that the tickets matching the operators
+	// were submitted with, grouped by the category of the tickets
+	CategoryTicketDefinitions(ctx context.Context, operators ...*Operator) (map[primitive.ObjectID][]primitive.ObjectID, error)
 }
 
 type ticketDefinitionRepository interface {
 	TicketDefinition(ctx context.Context, id string) (*TicketDefinition, error)
 	TicketDefinitions(ctx context.Context, operators ...*Operator) ([]*TicketDefinition, error)
 	CreateTicketDefinition(ctx context.Context, ticket *TicketDefinition) (*TicketDefinition, error)
-	UpdateTicketDefinition(ctx context.Context, id string, ticket *TicketDefinition) (*TicketDefinition, error)
+	// ReplaceTicketDefinition replaces the definition identified by id as long as it is still at the provided version.
+	// A nil definition is returned when the definition was at another version, so concurrent writes never overwrite each other
+	ReplaceTicketDefinition(ctx context.Context, id string, version int, ticket *TicketDefinition) (*TicketDefinition, error)
+	TicketDefinitionVersions(ctx context.Context, operators ...*Operator) ([]*TicketDefinitionVersion, error)
+	CreateTicketDefinitionVersion(ctx context.Context, version *TicketDefinitionVersion) (*TicketDefinitionVersion, error)
+	DeleteTicketDefinitionVersion(ctx context.Context, id primitive.ObjectID) error
 }
 
 type ticketStatusRepository interface {
@@ -52,24 +80,190 @@ type Ticket struct {
 	AssignedTo   *primitive.ObjectID `json:"assignedTo,omitempty" bson:"assignedTo,omitempty"`
 	StatusID     primitive.ObjectID  `json:"statusID" bson:"statusID"`
 	DefinitionID primitive.ObjectID  `json:"definitionID" bson:"definitionID"`
-	CategoryID   primitive.ObjectID  `json:"categoryID" bson:"categoryID"`
-	Fields       []*FieldValue       `json:"fields" bson:"fields"`
-	CreatedAt    time.Time           `json:"createdAt" bson:"createdAt"`
-	UpdateAt     *time.Time          `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	// DefinitionVersion is the version of the definition that the ticket was submitted under.
+	// Tickets submitted before definitions were versioned have a value of 0, which refers to the first version
+	DefinitionVersion int                `json:"definitionVersion" bson:"definitionVersion"`
+	CategoryID        primitive.ObjectID `json:"categoryID" bson:"categoryID"`
+	Fields            []*FieldValue      `json:"fields" bson:"fields"`
+	// SLA tracks the targets of the SLA policy that applied to the ticket when it was created.
+	// It is nil for tickets that no policy applied to
+	SLA       *TicketSLA `json:"sla,omitempty" bson:"sla,omitempty"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt"`
+	UpdateAt  *time.Time `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+func (o *Ticket) ValidateAttributes() error {
+
+	if o.DefinitionID.IsZero() {
+		return fmt.Errorf("definitionID is required, received empty value")
+	}
+
+	if o.CategoryID.IsZero() {
+		return fmt.Errorf("categoryID is required, received empty value")
+	}
+
+	return nil
+
 }
 
 // TicketType represents a type of ticket and the fields that the ticket has
 type TicketDefinition struct {
-	ID         primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
-	Name       string               `json:"name" bson:"name"`
-	Fields     []primitive.ObjectID `json:"fields" bson:"fields"`
-	Disabled   bool                 `json:"disabled" bson:"disabled"`
-	DisabledBy *primitive.ObjectID  `json:"disabledBy,omitempty" bson:"disabledBy,omitempty"`
-	DisabledAt *time.Time           `json:"disabledAt,omitempty" bson:"disabledAt,omitempty"`
-	CreatedBy  primitive.ObjectID   `json:"createdBy" bson:"createdBy"`
-	CreatedAt  time.Time            `json:"createdAt" bson:"createdAt"`
-	UpdatedBy  primitive.ObjectID   `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
-	UpdatedAt  time.Time            `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	ID     primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	Name   string               `json:"name" bson:"name"`
+	Fields []primitive.ObjectID `json:"fields" bson:"fields"`
+	// Version is incremented every time the name or fields of the definition change.
+	// Definitions created before definitions were versioned have a value of 0
+	Version    int                 `json:"version" bson:"version"`
+	Disabled   bool                `json:"disabled" bson:"disabled"`
+	DisabledBy *primitive.ObjectID `json:"disabledBy,omitempty" bson:"disabledBy,omitempty"`
+	DisabledAt *time.Time          `json:"disabledAt,omitempty" bson:"disabledAt,omitempty"`
+	CreatedBy  primitive.ObjectID  `json:"createdBy" bson:"createdBy"`
+	CreatedAt  time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedBy  primitive.ObjectID  `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
+	UpdatedAt  time.Time           `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// ExpandedTicketDefinition is a ticket definition along with the definitions of its fields, in the order of Fields
+type ExpandedTicketDefinition struct {
+	*TicketDefinition
+	FieldDefinitions []*FieldDefinition `json:"fieldDefinitions"`
+}
+
+// TicketDefinitionVersion is an immutable snapshot of the form that a ticket definition described.
+// A version is recorded every time a definition is created and every time its name or fields change
+type TicketDefinitionVersion struct {
+	ID           primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	DefinitionID primitive.ObjectID   `json:"definitionID" bson:"definitionID"`
+	Version      int                  `json:"version" bson:"version"`
+	Name         string               `json:"name" bson:"name"`
+	Fields       []primitive.ObjectID `json:"fields" bson:"fields"`
+	CreatedBy    primitive.ObjectID   `json:"createdBy" bson:"createdBy"`
+	CreatedAt    time.Time            `json:"createdAt" bson:"createdAt"`
+}
+
+// TicketDefinitionChanges describes how a version of a ticket definition differs from the version before it
+type TicketDefinitionChanges struct {
+	PreviousName  string               `json:"previousName,omitempty"`
+	AddedFields   []primitive.ObjectID `json:"addedFields"`
+	RemovedFields []primitive.ObjectID `json:"removedFields"`
+	Reordered     bool                 `json:"reordered"`
+}
+
+// TicketDefinitionRevision is a version of a ticket definition along with the changes
+// it made to the previous version. Changes is nil for the first version of a definition
+type TicketDefinitionRevision struct {
+	*TicketDefinitionVersion
+	Changes *TicketDefinitionChanges `json:"changes,omitempty"`
+}
+
+// CurrentVersion returns the version of the form that the definition currently describes
+func (o *TicketDefinition) CurrentVersion() int {
+
+	if o.Version < 1 {
+		return 1
+	}
+
+	return o.Version
+
+}
+
+// FormChanged reports whether the name or fields of the definition differ from those of the provided definition
+func (o *TicketDefinition) FormChanged(other *TicketDefinition) bool {
+
+	if o.Name != other.Name || len(o.Fields) != len(other.Fields) {
+		return true
+	}
+
+	for i := range o.Fields {
+		if o.Fields[i] != other.Fields[i] {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+// Snapshot records the current form of the definition as an immutable version
+func (o *TicketDefinition) Snapshot(createdBy primitive.ObjectID, createdAt time.Time) *TicketDefinitionVersion {
+
+	fields := make([]primitive.ObjectID, len(o.Fields))
+	copy(fields, o.Fields)
+
+	return &TicketDefinitionVersion{
+		DefinitionID: o.ID,
+		Version:      o.CurrentVersion(),
+		Name:         o.Name,
+		Fields:       fields,
+		CreatedBy:    createdBy,
+		CreatedAt:    createdAt,
+	}
+
+}
+
+// AtVersion returns a copy of the definition that describes the form recorded by the provided version
+func (o *TicketDefinition) AtVersion(version *TicketDefinitionVersion) *TicketDefinition {
+
+	definition := *o
+	definition.Version = version.Version
+	definition.Name = version.Name
+	definition.Fields = version.Fields
+	definition.UpdatedBy = version.CreatedBy
+	definition.UpdatedAt = version.CreatedAt
+
+	return &definition
+
+}
+
+// Diff describes how this version differs from the previous version
+func (o *TicketDefinitionVersion) Diff(previous *TicketDefinitionVersion) *TicketDefinitionChanges {
+
+	changes := &TicketDefinitionChanges{
+		AddedFields:   make([]primitive.ObjectID, 0),
+		RemovedFields: make([]primitive.ObjectID, 0),
+	}
+
+	if o.Name != previous.Name {
+		changes.PreviousName = previous.Name
+	}
+
+	before := make(map[primitive.ObjectID]bool, len(previous.Fields))
+	for _, field := range previous.Fields {
+		before[field] = true
+	}
+
+	after := make(map[primitive.ObjectID]bool, len(o.Fields))
+	for _, field := range o.Fields {
+		after[field] = true
+		if !before[field] {
+			changes.AddedFields = append(changes.AddedFields, field)
+		}
+	}
+
+	// The fields that both versions share are compared in order to detect a reordering
+	retained := make([]primitive.ObjectID, 0, len(previous.Fields))
+	for _, field := range previous.Fields {
+		if !after[field] {
+			changes.RemovedFields = append(changes.RemovedFields, field)
+			continue
+		}
+		retained = append(retained, field)
+	}
+
+	i := 0
+	for _, field := range o.Fields {
+		if !before[field] {
+			continue
+		}
+		if retained[i] != field {
+			changes.Reordered = true
+			break
+		}
+		i++
+	}
+
+	return changes
+
 }
 
 func (o *TicketDefinition) ValidateAttributes() error {
@@ -95,6 +289,13 @@ type TicketStatus struct {
 	// Thought process is once a ticket has been closed it can't be reopened.
 	Locked bool `json:"locked" bson:"locked"`
 
+	// Default marks the status that newly created tickets are placed into.
+	Default bool `json:"default" bson:"default"`
+
+	// Transitions lists the statuses that a ticket in this status may be moved to.
+	// An empty list places no restriction on the next status of a ticket.
+	Transitions []primitive.ObjectID `json:"transitions" bson:"transitions"`
+
 	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
 	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
 	UpdatedBy primitive.ObjectID `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
@@ -111,6 +312,23 @@ func (o *TicketStatus) ValidateAttributes() error {
 
 }
 
+// CanTransitionTo reports whether a ticket in this status may be moved to the provided status
+func (o *TicketStatus) CanTransitionTo(id primitive.ObjectID) bool {
+
+	if len(o.Transitions) == 0 {
+		return true
+	}
+
+	for _, transition := range o.Transitions {
+		if transition == id {
+			return true
+		}
+	}
+
+	return false
+
+}
+
 type FieldKind string
 
 const (
@@ -118,6 +336,8 @@ const (
 	FieldNumber  FieldKind = "number"
 	FieldBoolean FieldKind = "boolean"
 	FieldList    FieldKind = "list"
+	// FieldFile values are the id of an attachment that was uploaded ahead of the ticket or to the ticket itself
+	FieldFile FieldKind = "file"
 )
 
 type Kinds []FieldKind
@@ -125,6 +345,7 @@ type Kinds []FieldKind
 var AllKinds = Kinds{
 	FieldString, FieldNumber,
 	FieldBoolean, FieldList,
+	FieldFile,
 }
 
 func (a Kinds) Slice() []string {
@@ -151,21 +372,21 @@ func (f FieldKind) String() string {
 
 // Field represents a field that is apart of a ticket
 type FieldDefinition struct {
-	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Name        string             `json:"name" bson:"name"`
-	Description string             `json:"description" bson:"description"`
-	Required    bool               `json:"required" bson:"required"`
-	Hidden      bool               `json:"hidden" bson:"hidden"`
-	Hash        bool               `json:"hash" bson:"hash"`
-	Kind        FieldKind          `json:"kind" bson:"kind"`
-	Options     []interface{}      `json:"options,omitempty" bson:"options,omitempty"`
-	Disabled    bool               `json:"disabled" bson:"disabled"`
-	DisabledBy  primitive.ObjectID `json:"disabledBy,omitempty" bson:"disabledBy,omitempty"`
-	DisabledAt  time.Time          `json:"disabledAt,omitempty" bson:"disabledAt,omitempty"`
-	CreatedBy   primitive.ObjectID `json:"createdBy" bson:"createdBy"`
-	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
-	UpdatedBy   primitive.ObjectID `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
-	UpdatedAt   time.Time          `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	ID          primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Name        string              `json:"name" bson:"name"`
+	Description string              `json:"description" bson:"description"`
+	Required    bool                `json:"required" bson:"required"`
+	Hidden      bool                `json:"hidden" bson:"hidden"`
+	Hash        bool                `json:"hash" bson:"hash"`
+	Kind        FieldKind           `json:"kind" bson:"kind"`
+	Options     []interface{}       `json:"options,omitempty" bson:"options,omitempty"`
+	Disabled    bool                `json:"disabled" bson:"disabled"`
+	DisabledBy  *primitive.ObjectID `json:"disabledBy,omitempty" bson:"disabledBy,omitempty"`
+	DisabledAt  *time.Time          `json:"disabledAt,omitempty" bson:"disabledAt,omitempty"`
+	CreatedBy   primitive.ObjectID  `json:"createdBy" bson:"createdBy"`
+	CreatedAt   time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedBy   primitive.ObjectID  `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
+	UpdatedAt   time.Time           `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
 }
 
 func (o *FieldDefinition) ValidateAttributes() error {
@@ -190,10 +411,112 @@ func (o *FieldDefinition) ValidateAttributes() error {
 		return fmt.Errorf("options cannot be empty with kind is %s", FieldList)
 	}
 
+	if o.Kind == FieldFile && o.Hash {
+		return fmt.Errorf("hash cannot be enabled when kind is %s", FieldFile)
+	}
+
 	return nil
 
 }
 
+// ValidateValue confirms that the provided value is of the type dictated by the Kind
+// of this definition. Values for a FieldList definition may either be a single option
+// or an array of options, each of which must be present in Options
+func (o *FieldDefinition) ValidateValue(value interface{}) error {
+
+	if value == nil {
+		return fmt.Errorf("value is required, received empty value")
+	}
+
+	switch o.Kind {
+	case FieldString:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("expected value of kind %s, got %T", o.Kind, value)
+		}
+	case FieldNumber:
+		if _, ok := toFloat(value); !ok {
+			return fmt.Errorf("expected value of kind %s, got %T", o.Kind, value)
+		}
+	case FieldBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("expected value of kind %s, got %T", o.Kind, value)
+		}
+	case FieldList:
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+
+		if len(values) == 0 {
+			return fmt.Errorf("at least one option must be selected")
+		}
+
+		for _, v := range values {
+			if !o.hasOption(v) {
+				return fmt.Errorf("%v is not a valid option", v)
+			}
+		}
+	case FieldFile:
+		id, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected value of kind %s, got %T", o.Kind, value)
+		}
+
+		if _, err := primitive.ObjectIDFromHex(id); err != nil {
+			return fmt.Errorf("expected the id of an attachment, got %s", id)
+		}
+	default:
+		return fmt.Errorf("definition has unsupported kind %s", o.Kind)
+	}
+
+	return nil
+
+}
+
+func (o *FieldDefinition) hasOption(value interface{}) bool {
+
+	for _, option := range o.Options {
+		if optionsEqual(option, value) {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+// optionsEqual compares two option values, treating all numeric types
+// as equal when they hold the same value since options that round trip through
+// mongo may not decode into the same type that was submitted over json
+func optionsEqual(a, b interface{}) bool {
+
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	if aok && bok {
+		return af == bf
+	}
+
+	return reflect.DeepEqual(a, b)
+
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+
+	return 0, false
+}
+
 type FieldValue struct {
 	ID    primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Value interface{}        `json:"value" bson:"value"`
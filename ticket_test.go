@@ -0,0 +1,63 @@
+package support
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFieldDefinitionValidateValue(t *testing.T) {
+
+	priorities := &FieldDefinition{Kind: FieldList, Options: []interface{}{"low", "high", float64(3)}}
+
+	tests := []struct {
+		name       string
+		definition *FieldDefinition
+		value      interface{}
+		err        string
+	}{
+		{name: "nil value", definition: &FieldDefinition{Kind: FieldString}, value: nil, err: "value is required, received empty value"},
+		{name: "string", definition: &FieldDefinition{Kind: FieldString}, value: "printer is on fire"},
+		{name: "empty string", definition: &FieldDefinition{Kind: FieldString}, value: ""},
+		{name: "string given a number", definition: &FieldDefinition{Kind: FieldString}, value: float64(1), err: "expected value of kind string, got float64"},
+		{name: "number", definition: &FieldDefinition{Kind: FieldNumber}, value: 1.5},
+		{name: "integer number", definition: &FieldDefinition{Kind: FieldNumber}, value: int32(2)},
+		{name: "number given a string", definition: &FieldDefinition{Kind: FieldNumber}, value: "1", err: "expected value of kind number, got string"},
+		{name: "boolean", definition: &FieldDefinition{Kind: FieldBoolean}, value: false},
+		{name: "boolean given a string", definition: &FieldDefinition{Kind: FieldBoolean}, value: "true", err: "expected value of kind boolean, got string"},
+		{name: "list single option", definition: priorities, value: "low"},
+		{name: "list numeric option of another type", definition: priorities, value: int64(3)},
+		{name: "list multiple options", definition: priorities, value: []interface{}{"low", "high"}},
+		{name: "list single unknown option", definition: priorities, value: "urgent", err: "urgent is not a valid option"},
+		{name: "list multiple with an unknown option", definition: priorities, value: []interface{}{"low", "urgent"}, err: "urgent is not a valid option"},
+		{name: "list without options selected", definition: priorities, value: []interface{}{}, err: "at least one option must be selected"},
+		{name: "list option of the wrong type", definition: priorities, value: true, err: "true is not a valid option"},
+		{name: "file", definition: &FieldDefinition{Kind: FieldFile}, value: primitive.NewObjectID().Hex()},
+		{name: "file given an invalid id", definition: &FieldDefinition{Kind: FieldFile}, value: "report.pdf", err: "expected the id of an attachment, got report.pdf"},
+		{name: "file given a number", definition: &FieldDefinition{Kind: FieldFile}, value: float64(1), err: "expected value of kind file, got float64"},
+		{name: "unsupported kind", definition: &FieldDefinition{Kind: FieldKind("date")}, value: "2020-12-01", err: "definition has unsupported kind date"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			err := test.definition.ValidateValue(test.value)
+			if test.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("expected error %q, got none", test.err)
+			}
+
+			if err.Error() != test.err {
+				t.Fatalf("expected error %q, got %q", test.err, err.Error())
+			}
+
+		})
+	}
+
+}
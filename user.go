@@ -3,6 +3,7 @@ package support
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -19,25 +20,217 @@ type UserRepository interface {
 // The following is a const list of the column name
 // for each user struct filed that we tell mongo to use
 const (
-	UserUsername = "username"
-	UserEmail    = "email"
+	UserUsername  = "username"
+	UserEmail     = "email"
+	UserDeletedAt = "deletedAt"
 )
 
+// The names of the unique indexes on the users collection. Both indexes compare
+// values case-insensitively, so "Alice" and "alice" are the same username
+const (
+	UserUsernameIndex = "uniqueUserUsername"
+	UserEmailIndex    = "uniqueUserEmail"
+)
+
+// NormalizeEmail returns the canonical form of an email address that is stored and looked up
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Role dictates the set of permissions that a user is granted
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAgent Role = "agent"
+	RoleAdmin Role = "admin"
+)
+
+var AllRoles = []Role{
+	RoleUser, RoleAgent, RoleAdmin,
+}
+
+func (r Role) Valid() bool {
+	for _, v := range AllRoles {
+		if v == r {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r Role) String() string {
+	return string(r)
+}
+
+// Permission allows a user to perform an action that is otherwise refused
+type Permission string
+
+const (
+	PermissionManageCategories        Permission = "category:manage"
+	PermissionManageTicketDefinitions Permission = "ticket:definition:manage"
+	PermissionManageTicketStatuses    Permission = "ticket:status:manage"
+	PermissionReadAllTickets          Permission = "ticket:read:all"
+	PermissionUpdateAllTickets        Permission = "ticket:update:all"
+	PermissionAssignTickets           Permission = "ticket:assign"
+	PermissionChangeTicketStatus      Permission = "ticket:status:change"
+	PermissionViewHiddenFields        Permission = "ticket:field:hidden"
+	PermissionVerifyHashedFields      Permission = "ticket:field:verify"
+	PermissionInternalComments        Permission = "ticket:comment:internal"
+	PermissionManageUsers             Permission = "user:manage"
+	PermissionManageQueues            Permission = "queue:manage"
+	PermissionManageSLAPolicies       Permission = "sla:manage"
+	PermissionReadAudit               Permission = "audit:read"
+
+	// PermissionOverrideLockedStatus allows the status of a ticket in a locked status to be changed.
+	// It is not granted by any role and must be given to a user explicitly
+	PermissionOverrideLockedStatus Permission = "ticket:status:override"
+)
+
+var AllPermissions = []Permission{
+	PermissionManageCategories,
+	PermissionManageTicketDefinitions,
+	PermissionManageTicketStatuses,
+	PermissionReadAllTickets,
+	PermissionUpdateAllTickets,
+	PermissionAssignTickets,
+	PermissionChangeTicketStatus,
+	PermissionViewHiddenFields,
+	PermissionVerifyHashedFields,
+	PermissionInternalComments,
+	PermissionManageUsers,
+	PermissionManageQueues,
+	PermissionManageSLAPolicies,
+	PermissionReadAudit,
+	PermissionOverrideLockedStatus,
+}
+
+func (p Permission) Valid() bool {
+	for _, v := range AllPermissions {
+		if v == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p Permission) String() string {
+	return string(p)
+}
+
+var agentPermissions = []Permission{
+	PermissionReadAllTickets,
+	PermissionUpdateAllTickets,
+	PermissionAssignTickets,
+	PermissionChangeTicketStatus,
+	PermissionViewHiddenFields,
+	PermissionVerifyHashedFields,
+	PermissionInternalComments,
+}
+
+// RolePermissions is the set of permissions that is granted to each role
+var RolePermissions = map[Role][]Permission{
+	RoleUser:  {},
+	RoleAgent: agentPermissions,
+	RoleAdmin: append([]Permission{
+		PermissionManageCategories,
+		PermissionManageTicketDefinitions,
+		PermissionManageTicketStatuses,
+		PermissionManageUsers,
+		PermissionManageQueues,
+		PermissionManageSLAPolicies,
+		PermissionReadAudit,
+	}, agentPermissions...),
+}
+
 type User struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	FirstName string             `json:"first_name" bson:"first_name"`
-	LastName  string             `json:"last_name" bson:"last_name"`
-	Email     string             `json:"email" bson:"email"`
-	Username  string             `json:"username" bson:"username"`
-	Password  string             `json:"password,omitempty" bson:"password"`
-	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
-	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	FirstName   string             `json:"first_name" bson:"first_name"`
+	LastName    string             `json:"last_name" bson:"last_name"`
+	Email       string             `json:"email" bson:"email"`
+	Username    string             `json:"username" bson:"username"`
+	Password    string             `json:"password,omitempty" bson:"password"`
+	Role        Role               `json:"role" bson:"role"`
+	Permissions []Permission       `json:"permissions,omitempty" bson:"permissions,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
+
+	// EmailVerifiedAt is set once the user has proven that they own their email address
+	// and is cleared whenever their email address changes
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty" bson:"emailVerifiedAt,omitempty"`
+
+	// DeletedAt is set once the user has been deleted. Deleted users are kept so that
+	// the tickets they submitted remain attributable, but their personal details are anonymised
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
 }
 
-func (o *User) VerifyLoginAttributes() error {
+// Credentials are presented by a user to login. The identifier is either their username or their email address
+type Credentials struct {
+	Identifier string `json:"identifier"`
+	Password   string `json:"password"`
+}
 
-	if o.Username == "" {
-		return fmt.Errorf("username required, received empty value")
+// PasswordReset is the body of a request to replace a forgotten password using the token that was emailed to the user
+type PasswordReset struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// PasswordChange is the body of a request to change the password of the authenticated user
+type PasswordChange struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// EffectivePermissions returns the permissions granted by the role of the user
+// combined with the permissions that have been granted to the user explicitly.
+// Users that predate roles are treated as having RoleUser
+func (o *User) EffectivePermissions() []Permission {
+
+	role := o.Role
+	if role == "" {
+		role = RoleUser
+	}
+
+	permissions := make([]Permission, 0, len(RolePermissions[role])+len(o.Permissions))
+	seen := make(map[Permission]bool)
+	for _, set := range [][]Permission{RolePermissions[role], o.Permissions} {
+		for _, permission := range set {
+			if !seen[permission] {
+				seen[permission] = true
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+
+	return permissions
+
+}
+
+// HasPermission reports whether the permission is one of the effective permissions of the user
+func (o *User) HasPermission(permission Permission) bool {
+
+	for _, p := range o.EffectivePermissions() {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+// EmailVerified reports whether the user has verified their current email address
+func (o *User) EmailVerified() bool {
+	return o.EmailVerifiedAt != nil
+}
+
+func (o *Credentials) VerifyAttributes() error {
+
+	if o.Identifier == "" {
+		return fmt.Errorf("identifier required, received empty value")
 	}
 
 	if o.Password == "" {
@@ -48,6 +241,34 @@ func (o *User) VerifyLoginAttributes() error {
 
 }
 
+func (o *PasswordReset) VerifyAttributes() error {
+
+	if o.Token == "" {
+		return fmt.Errorf("token required, received empty value")
+	}
+
+	if o.Password == "" {
+		return fmt.Errorf("password required, received empty value")
+	}
+
+	return nil
+
+}
+
+func (o *PasswordChange) VerifyAttributes() error {
+
+	if o.CurrentPassword == "" {
+		return fmt.Errorf("current password required, received empty value")
+	}
+
+	if o.NewPassword == "" {
+		return fmt.Errorf("new password required, received empty value")
+	}
+
+	return nil
+
+}
+
 func (o *User) VerifyRegisterAttributes() error {
 
 	if o.FirstName == "" {